@@ -0,0 +1,252 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+type gqlAuditEntryRsp struct {
+	ID         string
+	ActorID    model.ID
+	Timestamp  time.Time
+	EntityType utils.AuditEntityTypeEnum
+	EntityID   string
+	Operation  utils.AuditOperationEnum
+	Changes    []*gqlAuditChangeRsp
+}
+
+// gqlAuditChangeRsp has the values of the change formatted as strings, as a field can hold values of any type.
+type gqlAuditChangeRsp struct {
+	Field  string
+	Before *string
+	After  *string
+}
+
+func gqlAuditEntryFromModel(entry *model.AuditEntry) *gqlAuditEntryRsp {
+	result := &gqlAuditEntryRsp{
+		ID:         entry.ID.ToString(),
+		ActorID:    entry.ActorID,
+		Timestamp:  entry.Timestamp,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID.ToString(),
+		Operation:  entry.Operation,
+		Changes:    []*gqlAuditChangeRsp{},
+	}
+
+	for _, change := range entry.Changes {
+		result.Changes = append(result.Changes, &gqlAuditChangeRsp{
+			Field:  change.Field,
+			Before: auditValueString(change.Before),
+			After:  auditValueString(change.After),
+		})
+	}
+
+	return result
+}
+
+func gqlAuditEntryListFromModel(entries model.AuditEntryList) []*gqlAuditEntryRsp {
+	result := []*gqlAuditEntryRsp{}
+
+	for _, entry := range entries {
+		result = append(result, gqlAuditEntryFromModel(entry))
+	}
+
+	return result
+}
+
+// auditValueString formats the values the same way they are sent in the other fields of the schema. nil is null.
+func auditValueString(value interface{}) *string {
+	var result string
+
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		result = value
+	case float64:
+		result = strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		result = strconv.FormatBool(value)
+	case time.Time:
+		result = value.UTC().Format(time.RFC3339)
+	default:
+		result = fmt.Sprint(value)
+	}
+
+	return &result
+}
+
+// newAuditTypes creates the AuditEntry type, the auditLog query and the history field of projects and customers.
+// Only admins can read the audit log.
+func newAuditTypes(UserType, ProjectType, CustomerType *graphql.Object) *graphql.Field {
+	AuditEntityTypeType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "AuditEntityType",
+		Values: graphql.EnumValueConfigMap{
+			"USER":     &graphql.EnumValueConfig{Value: utils.AuditEntityTypeEnum(utils.AUDIT_USER)},
+			"PROJECT":  &graphql.EnumValueConfig{Value: utils.AuditEntityTypeEnum(utils.AUDIT_PROJECT)},
+			"CUSTOMER": &graphql.EnumValueConfig{Value: utils.AuditEntityTypeEnum(utils.AUDIT_CUSTOMER)},
+		},
+	})
+
+	AuditOperationType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "AuditOperation",
+		Values: graphql.EnumValueConfigMap{
+			"CREATE":  &graphql.EnumValueConfig{Value: utils.AuditOperationEnum(utils.AUDIT_CREATE)},
+			"UPDATE":  &graphql.EnumValueConfig{Value: utils.AuditOperationEnum(utils.AUDIT_UPDATE)},
+			"DELETE":  &graphql.EnumValueConfig{Value: utils.AuditOperationEnum(utils.AUDIT_DELETE)},
+			"RESTORE": &graphql.EnumValueConfig{Value: utils.AuditOperationEnum(utils.AUDIT_RESTORE)},
+		},
+	})
+
+	AuditChangeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuditChange",
+		Fields: graphql.Fields{
+			"field": &graphql.Field{
+				Type: graphql.String,
+				Description: "Name of the field. The custom fields of the projects are named fields.<name>, the " +
+					"owner and the customer of a project are owner_id and customer_id.",
+			},
+			"before": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Value before the change, null when the entity was created.",
+			},
+			"after": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Value after the change, null when the entity was deleted.",
+			},
+		},
+		Description: "Value of a field changed by an operation. Dates are formatted as RFC 3339.",
+	})
+
+	AuditEntryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuditEntry",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.ID,
+			},
+			"actorId": &graphql.Field{
+				Type:        graphql.ID,
+				Description: "User who made the change, null for anonymous requests.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if entry, ok := p.Source.(*gqlAuditEntryRsp); ok && entry.ActorID != nil {
+						return entry.ActorID.ToString(), nil
+					}
+
+					return nil, nil
+				},
+			},
+			"actor": &graphql.Field{
+				Type:        UserType,
+				Description: "User who made the change, null for anonymous requests and for the users deleted since.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					entry, ok := p.Source.(*gqlAuditEntryRsp)
+					if !ok || entry.ActorID == nil {
+						return nil, nil
+					}
+
+					load := loaders(p).users.Load(entry.ActorID)
+					return func() (interface{}, error) {
+						if user, err := load(); err != nil {
+							return nil, nil
+						} else {
+							return gqlUserFromModel(user.(*model.User)), nil
+						}
+					}, nil
+				},
+			},
+			"timestamp": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"entityType": &graphql.Field{
+				Type: AuditEntityTypeType,
+			},
+			"entityId": &graphql.Field{
+				Type: graphql.ID,
+			},
+			"operation": &graphql.Field{
+				Type: AuditOperationType,
+			},
+			"changes": &graphql.Field{
+				Type:        &graphql.List{OfType: AuditChangeType},
+				Description: "Fields changed by the operation, sorted by name.",
+			},
+		},
+		Description: "Change recorded in the audit log.",
+	})
+
+	historyField := func(entity string) *graphql.Field {
+		return &graphql.Field{
+			Type:        &graphql.List{OfType: AuditEntryType},
+			Description: fmt.Sprintf("Changes of the %s in chronological order. Only admins can read them.", entity),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				var id string
+				switch source := p.Source.(type) {
+				case *gqlProjectRsp:
+					id = source.ID
+				case *gqlCustomerRsp:
+					id = source.ID
+				default:
+					return nil, nil
+				}
+
+				load := loaders(p).history.Load(service.Instance().CreateModelIDFromString(id))
+				return func() (interface{}, error) {
+					if entries, err := load(); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlAuditEntryListFromModel(entries.(model.AuditEntryList)), nil
+					}
+				}, nil
+			},
+		}
+	}
+
+	ProjectType.AddFieldConfig("history", historyField("project"))
+	CustomerType.AddFieldConfig("history", historyField("customer"))
+
+	return &graphql.Field{
+		Type: &graphql.List{OfType: AuditEntryType},
+		Args: graphql.FieldConfigArgument{
+			"entityId": &graphql.ArgumentConfig{
+				Type:        graphql.ID,
+				Description: "Only return the changes of this entity.",
+			},
+			"entityType": &graphql.ArgumentConfig{
+				Type:        AuditEntityTypeType,
+				Description: "Only return the changes of this type of entity.",
+			},
+			"since": &graphql.ArgumentConfig{
+				Type:        graphql.DateTime,
+				Description: "Changes made at or after this date.",
+			},
+			"until": &graphql.ArgumentConfig{
+				Type:        graphql.DateTime,
+				Description: "Changes made before this date.",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			filter := &model.AuditFilter{}
+			if id, ok := p.Args["entityId"].(string); ok {
+				filter.EntityIDs = model.IDList{service.Instance().CreateModelIDFromString(id)}
+			}
+			if entityType, ok := p.Args["entityType"].(utils.AuditEntityTypeEnum); ok {
+				filter.EntityType = &entityType
+			}
+			filter.Since, _ = p.Args["since"].(time.Time)
+			filter.Until, _ = p.Args["until"].(time.Time)
+
+			if entries, err := service.Instance().AuditLog(p.Context, currentUser(p), filter); err != nil {
+				return nil, serviceError(err)
+			} else {
+				return gqlAuditEntryListFromModel(entries), nil
+			}
+		},
+		Description: "Changes recorded in the audit log in chronological order. Only admins can read it.",
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/auth"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+const bearerPrefix = "Bearer "
+
+// authMiddleware resolves the bearer token of the request into the current user and stores it in the request
+// context. Requests without token go through as anonymous, requests with an invalid token are rejected.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		header := request.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		if !strings.HasPrefix(header, bearerPrefix) {
+			writeUnauthorized(response, "invalid Authorization header. Expected a Bearer token")
+			return
+		}
+
+		user, err := service.Instance().Authenticate(request.Context(), strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix)))
+		if err != nil {
+			loggerObj := utils.ContextLogger(request.Context())
+			loggerObj.Errorf("Rejected request from %s: %s", request.RemoteAddr, err.Error())
+			writeUnauthorized(response, err.Error())
+			return
+		}
+
+		next.ServeHTTP(response, request.WithContext(auth.WithUser(request.Context(), user)))
+	})
+}
+
+func writeUnauthorized(response http.ResponseWriter, msg string) {
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("WWW-Authenticate", "Bearer")
+	response.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(response).Encode(map[string]interface{}{
+		"errors": []interface{}{
+			map[string]interface{}{
+				"message":    msg,
+				"extensions": map[string]interface{}{"code": UNAUTHENTICATED_ERROR_CODE},
+			},
+		},
+	})
+}
+
+// currentUser returns the authenticated user of the request being resolved, or nil for anonymous requests.
+func currentUser(p graphql.ResolveParams) *model.User {
+	return auth.UserFromContext(p.Context)
+}
+
+// requireAuthentication wraps every field resolver of the object so anonymous requests are rejected, except for the
+// fields listed as public. It does nothing when authentication is disabled in settings.json.
+func requireAuthentication(object *graphql.Object, publicFields ...string) {
+	if !settings.SettingsObj().AuthSettings().Required() {
+		return
+	}
+
+	public := map[string]bool{}
+	for _, name := range publicFields {
+		public[name] = true
+	}
+
+	for name, field := range object.Fields() {
+		if public[name] || field.Resolve == nil {
+			continue
+		}
+
+		resolve := field.Resolve
+		field.Resolve = func(p graphql.ResolveParams) (interface{}, error) {
+			if currentUser(p) == nil {
+				return nil, newGqlError(UNAUTHENTICATED_ERROR_CODE, "authentication required", nil)
+			}
+
+			return resolve(p)
+		}
+	}
+}
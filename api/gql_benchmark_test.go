@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/graphql-go/graphql"
+)
+
+// benchmarkQuery is a query that does not reach the database, so the benchmarks only measure the GraphQL work.
+const benchmarkQuery = `query ProjectType {
+	__type(name: "Project") {
+		name
+		fields { name type { name kind ofType { name kind } } }
+	}
+}`
+
+// setTestEnv sets an environment variable and returns the function that restores its previous value.
+func setTestEnv(name, value string) func() {
+	previous, set := os.LookupEnv(name)
+	os.Setenv(name, value)
+
+	return func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// testSchema loads the settings and builds the schema with the in-memory database, which the tests and the
+// benchmarks can run without a cluster.
+func testSchema(tb testing.TB) *graphql.Schema {
+	defer setTestEnv("PICNIC_DB_DRIVER", "memory")()
+
+	if err := settings.Load(); err != nil {
+		tb.Fatal(err)
+	}
+
+	schema, err := GetSchema()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return schema
+}
+
+// testServer returns a server with the shared schema, the query cache, the persisted queries in memory and no
+// limits, which is enough to serve the requests of getGqlHandler.
+func testServer(tb testing.TB) *gqlServerImp {
+	schema := testSchema(tb)
+	queries := newQueryCache(schema, 100)
+	return &gqlServerImp{
+		schema:    schema,
+		queries:   queries,
+		persisted: newTestPersistedQueries(queries, false, map[string]string{}),
+		limits:    &queryLimits{schema: schema},
+	}
+}
+
+func checkBenchmarkResult(b *testing.B, result *graphql.Result) {
+	if result.HasErrors() {
+		b.Fatal(result.Errors)
+	}
+}
+
+// BenchmarkGetSchema measures the cost of building the schema, which was paid by every request.
+func BenchmarkGetSchema(b *testing.B) {
+	testSchema(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := GetSchema(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkQuerySchemaPerRequest runs the query the way the server did before the schema was shared.
+func BenchmarkQuerySchemaPerRequest(b *testing.B) {
+	testSchema(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		schema, _ := GetSchema()
+		checkBenchmarkResult(b, graphql.Do(graphql.Params{Schema: *schema, RequestString: benchmarkQuery}))
+	}
+}
+
+// BenchmarkQuerySharedSchema runs the query with the shared schema, parsing and validating it every time.
+func BenchmarkQuerySharedSchema(b *testing.B) {
+	schema := testSchema(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		checkBenchmarkResult(b, graphql.Do(graphql.Params{Schema: *schema, RequestString: benchmarkQuery}))
+	}
+}
+
+// BenchmarkQueryCached runs the query the way the server does, with the shared schema and the query cache.
+func BenchmarkQueryCached(b *testing.B) {
+	server := testServer(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		result, _ := server.processQuery(context.Background(), reqBody{Query: benchmarkQuery})
+		checkBenchmarkResult(b, result)
+	}
+}
+
+// BenchmarkQueryCachedParallel measures the throughput of concurrent requests sharing the schema and the cache.
+func BenchmarkQueryCachedParallel(b *testing.B) {
+	server := testServer(b)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			result, _ := server.processQuery(context.Background(), reqBody{Query: benchmarkQuery})
+			checkBenchmarkResult(b, result)
+		}
+	})
+}
+
+// BenchmarkHandler serves the query through the HTTP handler, which decodes the request, looks up the type of the
+// operation and executes it.
+func BenchmarkHandler(b *testing.B) {
+	handler := testServer(b).getGqlHandler()
+	content, _ := json.Marshal(reqBody{Query: benchmarkQuery})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		request := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(content))
+		request.Header.Set("Content-Type", jsonMediaType)
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+		if response.Code != http.StatusOK {
+			b.Fatal(response.Body.String())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/freddy311082/picnic-server/metrics"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+var gqlQueryCacheLookups = metrics.NewCounter(
+	"picnic_graphql_query_cache_lookups_total",
+	"Lookups of parsed queries in the query cache per result (hit or miss).",
+	"result")
+
+// lruCache keeps the most recently used values up to its capacity. It is safe for concurrent use.
+type lruCache struct {
+	mutex    sync.Mutex
+	capacity int
+	items    *list.List
+	index    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLruCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		items:    list.New(),
+		index:    map[string]*list.Element{},
+	}
+}
+
+func (cache *lruCache) get(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.index[key]; ok {
+		cache.items.MoveToFront(element)
+		return element.Value.(*lruEntry).value, true
+	}
+
+	return nil, false
+}
+
+func (cache *lruCache) add(key string, value interface{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.index[key]; ok {
+		element.Value.(*lruEntry).value = value
+		cache.items.MoveToFront(element)
+		return
+	}
+
+	cache.index[key] = cache.items.PushFront(&lruEntry{key: key, value: value})
+	if cache.items.Len() > cache.capacity {
+		oldest := cache.items.Back()
+		cache.items.Remove(oldest)
+		delete(cache.index, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (cache *lruCache) len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.items.Len()
+}
+
+// parsedQuery is a query already parsed and validated against the schema. Invalid queries are cached with their
+// errors, so they are not parsed again either.
+type parsedQuery struct {
+	document *ast.Document
+	errors   []gqlerrors.FormattedError
+}
+
+// queryCache keeps the parsed queries by their text, so the queries that clients send over and over are only parsed
+// and validated once.
+type queryCache struct {
+	schema  *graphql.Schema
+	queries *lruCache
+}
+
+func newQueryCache(schema *graphql.Schema, capacity int) *queryCache {
+	return &queryCache{schema: schema, queries: newLruCache(capacity)}
+}
+
+func (cache *queryCache) parse(query string) *parsedQuery {
+	if cached, ok := cache.queries.get(query); ok {
+		gqlQueryCacheLookups.Inc("hit")
+		return cached.(*parsedQuery)
+	}
+	gqlQueryCacheLookups.Inc("miss")
+
+	result := &parsedQuery{}
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"}),
+	})
+
+	if err != nil {
+		result.errors = gqlerrors.FormatErrors(err)
+	} else if validation := graphql.ValidateDocument(cache.schema, document, nil); !validation.IsValid {
+		result.errors = validation.Errors
+	} else {
+		result.document = document
+	}
+
+	cache.queries.add(query, result)
+	return result
+}
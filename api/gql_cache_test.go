@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestLruCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLruCache(2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+	cache.get("a")
+	cache.add("c", 3)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("The least recently used value was not evicted")
+	} else if value, ok := cache.get("a"); !ok || value != 1 {
+		t.Error("A recently used value was evicted")
+	} else if cache.len() != 2 {
+		t.Error("The cache is over its capacity. Length: ", cache.len())
+	}
+}
+
+func TestQueryCacheParsesEveryQueryOnce(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: graphql.Fields{"hello": &graphql.Field{Type: graphql.String}},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newQueryCache(&schema, 10)
+	if query := cache.parse("{ hello }"); query.document == nil || len(query.errors) > 0 {
+		t.Error("The valid query was not parsed: ", query.errors)
+	} else if cache.parse("{ hello }") != query {
+		t.Error("The parsed query was not reused")
+	}
+
+	if query := cache.parse("{ goodbye }"); query.document != nil || len(query.errors) == 0 {
+		t.Error("The invalid query was not rejected")
+	} else if query = cache.parse("{ hello"); len(query.errors) == 0 {
+		t.Error("The syntax error was not returned")
+	}
+}
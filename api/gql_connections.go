@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/graphql-go/graphql"
+)
+
+// Relay connections (https://relay.dev/graphql/connections.htm). The cursors are the base64 encoding of the
+// ObjectID of the node, so the pages are read by the database with keyset pagination instead of skip.
+
+const DEFAULT_PAGE_SIZE = 20
+const MAX_PAGE_SIZE = 100
+
+const cursorPrefix = "cursor:"
+
+type gqlEdgeRsp struct {
+	Node   interface{}
+	Cursor string
+}
+
+type gqlPageInfoRsp struct {
+	HasNextPage     bool
+	HasPreviousPage bool
+	StartCursor     *string
+	EndCursor       *string
+}
+
+type gqlConnectionRsp struct {
+	Edges    []*gqlEdgeRsp
+	PageInfo *gqlPageInfoRsp
+	count    func(ctx context.Context) (int64, error)
+}
+
+func encodeCursor(id model.ID) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + id.ToString()))
+}
+
+func decodeCursor(argName, cursor string) (model.ID, error) {
+	value, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(value), cursorPrefix) {
+		return nil, badUserInputError(argName, "invalid cursor")
+	}
+
+	id := strings.TrimPrefix(string(value), cursorPrefix)
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 24 {
+		return nil, badUserInputError(argName, "invalid cursor")
+	}
+
+	return service.Instance().CreateModelIDFromString(id), nil
+}
+
+// newGqlConnection builds the connection of a page. The ids are the ids of the nodes, in the same order.
+func newGqlConnection(
+	nodes []interface{},
+	ids model.IDList,
+	pageInfo *model.PageInfo,
+	count func(ctx context.Context) (int64, error)) *gqlConnectionRsp {
+
+	result := &gqlConnectionRsp{
+		Edges: []*gqlEdgeRsp{},
+		PageInfo: &gqlPageInfoRsp{
+			HasNextPage:     pageInfo.HasNextPage,
+			HasPreviousPage: pageInfo.HasPreviousPage,
+		},
+		count: count,
+	}
+
+	for i, node := range nodes {
+		result.Edges = append(result.Edges, &gqlEdgeRsp{
+			Node:   node,
+			Cursor: encodeCursor(ids[i]),
+		})
+	}
+
+	if len(result.Edges) > 0 {
+		result.PageInfo.StartCursor = &result.Edges[0].Cursor
+		result.PageInfo.EndCursor = &result.Edges[len(result.Edges)-1].Cursor
+	}
+
+	return result
+}
+
+func connectionArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+			Description: "Number of items after the \"after\" cursor. By default 20 items are returned and at most " +
+				"100 items can be requested.",
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Return only the items after this cursor.",
+		},
+		"last": &graphql.ArgumentConfig{
+			Type:        graphql.Int,
+			Description: "Number of items before the \"before\" cursor. It cannot be used together with \"first\".",
+		},
+		"before": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Return only the items before this cursor.",
+		},
+	}
+}
+
+// pageRequestFromArgs reads the connection arguments of a query.
+func pageRequestFromArgs(args map[string]interface{}) (*model.PageRequest, error) {
+	page := &model.PageRequest{}
+	page.First, _ = args["first"].(int)
+	page.Last, _ = args["last"].(int)
+
+	if page.First < 0 {
+		return nil, badUserInputError("first", "first cannot be a negative number")
+	} else if page.Last < 0 {
+		return nil, badUserInputError("last", "last cannot be a negative number")
+	} else if page.First > 0 && page.Last > 0 {
+		return nil, badUserInputError("last", "first and last cannot be used at the same time")
+	} else if page.First > MAX_PAGE_SIZE || page.Last > MAX_PAGE_SIZE {
+		return nil, badUserInputError("first", "at most 100 items can be requested")
+	} else if page.First == 0 && page.Last == 0 {
+		page.First = DEFAULT_PAGE_SIZE
+	}
+
+	if cursor, ok := args["after"].(string); ok {
+		if id, err := decodeCursor("after", cursor); err != nil {
+			return nil, err
+		} else {
+			page.After = id
+		}
+	}
+
+	if cursor, ok := args["before"].(string); ok {
+		if id, err := decodeCursor("before", cursor); err != nil {
+			return nil, err
+		} else {
+			page.Before = id
+		}
+	}
+
+	return page, nil
+}
+
+var PageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{
+			Type: &graphql.NonNull{OfType: graphql.Boolean},
+		},
+		"hasPreviousPage": &graphql.Field{
+			Type: &graphql.NonNull{OfType: graphql.Boolean},
+		},
+		"startCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+		"endCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+	Description: "Information about the page of a connection.",
+})
+
+// newConnectionType creates the <name>Connection and <name>Edge types of a node type.
+func newConnectionType(name string, nodeType *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"node": &graphql.Field{
+				Type: nodeType,
+			},
+			"cursor": &graphql.Field{
+				Type: &graphql.NonNull{OfType: graphql.String},
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: &graphql.List{OfType: edgeType},
+			},
+			"pageInfo": &graphql.Field{
+				Type: &graphql.NonNull{OfType: PageInfoType},
+			},
+			"totalCount": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Total number of items in the collection, regardless of the page.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if connection, ok := p.Source.(*gqlConnectionRsp); ok && connection.count != nil {
+						if count, err := connection.count(p.Context); err != nil {
+							return nil, err
+						} else {
+							return int(count), nil
+						}
+					}
+
+					return nil, nil
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/freddy311082/picnic-server/service"
+)
+
+// GraphQL error codes returned in the "extensions" entry of every error raised by the resolvers.
+const (
+	BAD_USER_INPUT_ERROR_CODE    = "BAD_USER_INPUT"
+	NOT_FOUND_ERROR_CODE         = "NOT_FOUND"
+	INTERNAL_ERROR_CODE          = "INTERNAL_ERROR"
+	UNAUTHENTICATED_ERROR_CODE   = "UNAUTHENTICATED"
+	FORBIDDEN_ERROR_CODE         = "FORBIDDEN"
+	BAD_REQUEST_ERROR_CODE       = "BAD_REQUEST"
+	CONFLICT_ERROR_CODE          = "CONFLICT"
+	TOO_MANY_REQUESTS_ERROR_CODE = "TOO_MANY_REQUESTS"
+
+	PERSISTED_QUERY_NOT_FOUND_ERROR_CODE   = "PERSISTED_QUERY_NOT_FOUND"
+	PERSISTED_QUERY_NOT_ALLOWED_ERROR_CODE = "PERSISTED_QUERY_NOT_ALLOWED"
+	QUERY_TOO_DEEP_ERROR_CODE              = "QUERY_TOO_DEEP"
+	QUERY_TOO_COMPLEX_ERROR_CODE           = "QUERY_TOO_COMPLEX"
+)
+
+// gqlError is an error with extensions, so clients get a machine readable code besides the message.
+type gqlError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (err *gqlError) Error() string {
+	return err.message
+}
+
+func (err *gqlError) Extensions() map[string]interface{} {
+	return err.extensions
+}
+
+func newGqlError(code, message string, extensions map[string]interface{}) *gqlError {
+	result := &gqlError{
+		message:    message,
+		extensions: map[string]interface{}{"code": code},
+	}
+
+	for key, value := range extensions {
+		result.extensions[key] = value
+	}
+
+	return result
+}
+
+func badUserInputError(field, message string) *gqlError {
+	return newGqlError(BAD_USER_INPUT_ERROR_CODE, message, map[string]interface{}{"field": field})
+}
+
+func notFoundError(entity, id string, err error) *gqlError {
+	return newGqlError(NOT_FOUND_ERROR_CODE, err.Error(), map[string]interface{}{"entity": entity, "id": id})
+}
+
+func internalError(err error) *gqlError {
+	return newGqlError(INTERNAL_ERROR_CODE, err.Error(), nil)
+}
+
+// serviceError translates the typed errors returned by the service layer into GraphQL errors.
+func serviceError(err error) *gqlError {
+	var forbidden *service.ForbiddenError
+	if errors.As(err, &forbidden) {
+		return newGqlError(FORBIDDEN_ERROR_CODE, err.Error(), map[string]interface{}{
+			"action":   forbidden.Action,
+			"resource": forbidden.Resource,
+			"id":       forbidden.ID,
+		})
+	}
+
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		return badUserInputError(invalid.Field, err.Error())
+	}
+
+	var conflict *service.ConflictError
+	if errors.As(err, &conflict) {
+		return newGqlError(CONFLICT_ERROR_CODE, err.Error(), map[string]interface{}{
+			"resource": conflict.Resource,
+			"id":       conflict.ID,
+			"version":  conflict.Version,
+			"current":  conflictCurrent(conflict),
+		})
+	}
+
+	var referenced *service.ReferencedError
+	if errors.As(err, &referenced) {
+		projects := []string{}
+		for _, id := range referenced.Projects {
+			projects = append(projects, id.ToString())
+		}
+
+		return newGqlError(CONFLICT_ERROR_CODE, err.Error(), map[string]interface{}{
+			"resource": referenced.Resource,
+			"id":       referenced.ID,
+			"projects": projects,
+		})
+	}
+
+	return internalError(err)
+}
+
+// conflictCurrent returns the current state of the entity of a conflict, with the names and the formats of the fields
+// of the schema.
+func conflictCurrent(conflict *service.ConflictError) map[string]interface{} {
+	if project := conflict.Project; project != nil {
+		fields := []map[string]interface{}{}
+		for _, field := range gqlProjectFieldsFromModel(project.Fields) {
+			fields = append(fields, map[string]interface{}{"name": field.Name, "value": field.Value})
+		}
+
+		current := map[string]interface{}{
+			"id":          project.ID.ToString(),
+			"version":     project.Version,
+			"name":        project.Name,
+			"description": project.Description,
+			"owner_id":    nil,
+			"customer_id": nil,
+			"fields":      fields,
+		}
+		if project.Owner != nil && project.Owner.ID != nil {
+			current["owner_id"] = project.Owner.ID.ToString()
+		}
+		if project.Customer != nil && project.Customer.ID != nil {
+			current["customer_id"] = project.Customer.ID.ToString()
+		}
+
+		return current
+	} else if customer := conflict.Customer; customer != nil {
+		return map[string]interface{}{
+			"id":      customer.ID.ToString(),
+			"version": customer.Version,
+			"name":    customer.Name,
+			"cuit":    customer.Cuit,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/freddy311082/picnic-server/service"
+)
+
+func TestValidationErrorsAreBadUserInput(t *testing.T) {
+	err := serviceError(&service.ValidationError{Field: "name", Message: "cannot be empty"})
+
+	if err.Extensions()["code"] != BAD_USER_INPUT_ERROR_CODE || err.Extensions()["field"] != "name" {
+		t.Error("A validation error must be reported as a bad input of its field: ", err.Extensions())
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+var SortDirectionType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SortDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC": &graphql.EnumValueConfig{
+			Value: utils.SortDirectionEnum(utils.SORT_ASC),
+		},
+		"DESC": &graphql.EnumValueConfig{
+			Value: utils.SortDirectionEnum(utils.SORT_DESC),
+		},
+	},
+})
+
+// newOrderByType creates the <name>OrderField enum and the <name>OrderBy input of a list. fields maps every enum
+// value to one of the utils.SORT_FIELD_* fields.
+func newOrderByType(name string, fields map[string]string) *graphql.InputObject {
+	values := graphql.EnumValueConfigMap{}
+	for enumName, field := range fields {
+		values[enumName] = &graphql.EnumValueConfig{Value: field}
+	}
+
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: name + "OrderBy",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": &graphql.InputObjectFieldConfig{
+				Type: &graphql.NonNull{OfType: graphql.NewEnum(graphql.EnumConfig{
+					Name:   name + "OrderField",
+					Values: values,
+				})},
+			},
+			"direction": &graphql.InputObjectFieldConfig{
+				Type:        SortDirectionType,
+				Description: "ASC by default.",
+			},
+		},
+		Description: "Sorts the list by a field. Items with the same value are sorted by id.",
+	})
+}
+
+var UserOrderByType = newOrderByType("User", map[string]string{
+	"ID":        utils.SORT_FIELD_ID,
+	"NAME":      utils.SORT_FIELD_NAME,
+	"LAST_NAME": utils.SORT_FIELD_LASTNAME,
+	"EMAIL":     utils.SORT_FIELD_EMAIL,
+})
+
+var ProjectOrderByType = newOrderByType("Project", map[string]string{
+	"ID":         utils.SORT_FIELD_ID,
+	"NAME":       utils.SORT_FIELD_NAME,
+	"CREATED_AT": utils.SORT_FIELD_CREATED_AT,
+})
+
+var CustomerOrderByType = newOrderByType("Customer", map[string]string{
+	"ID":   utils.SORT_FIELD_ID,
+	"NAME": utils.SORT_FIELD_NAME,
+	"CUIT": utils.SORT_FIELD_CUIT,
+})
+
+var UserFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"search": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Text contained in the name, last name or email of the user. Case insensitive.",
+		},
+	},
+})
+
+var ProjectFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProjectFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"nameContains": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Text contained in the name of the project. Case insensitive.",
+		},
+		"customerId": &graphql.InputObjectFieldConfig{
+			Type: graphql.ID,
+		},
+		"ownerId": &graphql.InputObjectFieldConfig{
+			Type: graphql.ID,
+		},
+		"createdAfter": &graphql.InputObjectFieldConfig{
+			Type:        graphql.DateTime,
+			Description: "Projects created at or after this date.",
+		},
+		"createdBefore": &graphql.InputObjectFieldConfig{
+			Type:        graphql.DateTime,
+			Description: "Projects created before this date.",
+		},
+	},
+})
+
+var CustomerFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CustomerFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"search": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Text contained in the name or the CUIT of the customer. Case insensitive.",
+		},
+	},
+})
+
+func orderByFromArgs(args map[string]interface{}) *model.OrderBy {
+	value, ok := args["orderBy"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	orderBy := &model.OrderBy{Direction: utils.SORT_ASC}
+	orderBy.Field, _ = value["field"].(string)
+	if direction, ok := value["direction"].(utils.SortDirectionEnum); ok {
+		orderBy.Direction = direction
+	}
+
+	return orderBy
+}
+
+func userFilterFromArgs(args map[string]interface{}) *model.UserFilter {
+	value, ok := args["filter"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	filter := &model.UserFilter{}
+	filter.Search, _ = value["search"].(string)
+	return filter
+}
+
+func projectFilterFromArgs(args map[string]interface{}) *model.ProjectFilter {
+	value, ok := args["filter"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	filter := &model.ProjectFilter{}
+	filter.NameContains, _ = value["nameContains"].(string)
+	filter.CreatedAfter, _ = value["createdAfter"].(time.Time)
+	filter.CreatedBefore, _ = value["createdBefore"].(time.Time)
+
+	if id, ok := value["customerId"].(string); ok {
+		filter.CustomerID = service.Instance().CreateModelIDFromString(id)
+	}
+
+	if id, ok := value["ownerId"].(string); ok {
+		filter.OwnerID = service.Instance().CreateModelIDFromString(id)
+	}
+
+	return filter
+}
+
+func customerFilterFromArgs(args map[string]interface{}) *model.CustomerFilter {
+	value, ok := args["filter"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	filter := &model.CustomerFilter{}
+	filter.Search, _ = value["search"].(string)
+	return filter
+}
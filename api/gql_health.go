@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/freddy311082/picnic-server/metrics"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+const anonymousOperation = "anonymous"
+
+var gqlRequests = metrics.NewCounter(
+	"picnic_graphql_requests_total",
+	"GraphQL requests per operation name.",
+	"operation")
+
+var gqlRequestDuration = metrics.NewHistogram(
+	"picnic_graphql_request_duration_seconds",
+	"Duration of the GraphQL requests per operation name.",
+	metrics.DefaultBuckets,
+	"operation")
+
+var gqlResolverErrors = metrics.NewCounter(
+	"picnic_graphql_resolver_errors_total",
+	"Errors returned by the GraphQL resolvers per operation name.",
+	"operation")
+
+var gqlRejectedRequests = metrics.NewCounter(
+	"picnic_graphql_rejected_requests_total",
+	"GraphQL requests rejected before execution, because they do not parse or validate or are over the limits, "+
+		"per operation name.",
+	"operation")
+
+// recordQueryMetrics counts a GraphQL request and the errors of its result. The errors of a request that was not
+// executed are parse, validation or limit errors, so the request is counted as rejected instead.
+func recordQueryMetrics(operationName string, start time.Time, result *graphql.Result, executed bool) {
+	if operationName == "" {
+		operationName = anonymousOperation
+	}
+
+	gqlRequests.Inc(operationName)
+	gqlRequestDuration.Observe(time.Since(start).Seconds(), operationName)
+	if !executed {
+		gqlRejectedRequests.Inc(operationName)
+	} else if len(result.Errors) > 0 {
+		gqlResolverErrors.Add(float64(len(result.Errors)), operationName)
+	}
+}
+
+// metricsHandler serves the metrics to the requests that send token as bearer token.
+func metricsHandler(token string) http.Handler {
+	next := metrics.Handler()
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		header := request.Header.Get("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))), []byte(token)) != 1 {
+			writeUnauthorized(response, "invalid metrics token")
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+type healthRsp struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthHandler answers while the process is alive.
+func healthHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		writeHealth(response, request, nil)
+	})
+}
+
+// readyHandler answers when the settings were loaded and the database answers, so the server can take traffic.
+func readyHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if !settings.Loaded() {
+			writeHealth(response, request, errSettingsNotLoaded)
+		} else {
+			writeHealth(response, request, service.Instance().Ping(request.Context()))
+		}
+	})
+}
+
+var errSettingsNotLoaded = errors.New("settings were not loaded")
+
+func writeHealth(response http.ResponseWriter, request *http.Request, err error) {
+	result := healthRsp{Status: "ok"}
+	status := http.StatusOK
+
+	if err != nil {
+		loggerObj := utils.ContextLogger(request.Context())
+		loggerObj.Error("Server is not ready: ", err.Error())
+
+		result = healthRsp{Status: "unavailable", Error: err.Error()}
+		status = http.StatusServiceUnavailable
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(result)
+}
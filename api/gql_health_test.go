@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+func TestHealthHandler(t *testing.T) {
+	response := httptest.NewRecorder()
+	healthHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status %d. Value received: %d", http.StatusOK, response.Code)
+	} else if !strings.Contains(response.Body.String(), `"status":"ok"`) {
+		t.Error("The process is alive, but the response is: ", response.Body.String())
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	defer setTestEnv("PICNIC_DB_DRIVER", "memory")()
+
+	if err := settings.Load(); err != nil {
+		t.Fatal(err)
+	} else if err := service.Instance().Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	response := httptest.NewRecorder()
+	readyHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected status %d with the database open. Value received: %d", http.StatusOK, response.Code)
+	}
+
+	if err := service.Instance().Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	response = httptest.NewRecorder()
+	readyHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d with the database closed. Value received: %d",
+			http.StatusServiceUnavailable, response.Code)
+	} else if !strings.Contains(response.Body.String(), "database is not open") {
+		t.Error("The response must report the database error: ", response.Body.String())
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"without token", "", http.StatusUnauthorized},
+		{"basic credentials", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"wrong token", "Bearer other", http.StatusUnauthorized},
+		{"token", "Bearer secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+
+		response := httptest.NewRecorder()
+		metricsHandler("secret").ServeHTTP(response, request)
+		if response.Code != test.status {
+			t.Errorf("%s: expected status %d. Value received: %d", test.name, test.status, response.Code)
+		} else if test.status == http.StatusOK && !strings.Contains(response.Body.String(), "picnic_graphql_requests_total") {
+			t.Errorf("%s: the response must have the GraphQL metrics: %s", test.name, response.Body.String())
+		}
+	}
+}
+
+func TestRecordQueryMetricsCountsRejectedRequestsApart(t *testing.T) {
+	// the counters live as long as the process, so every run counts operations of its own
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	rejected, executed := "RejectedOperation"+suffix, "ExecutedOperation"+suffix
+
+	result := &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "Syntax Error"}}}
+	recordQueryMetrics(rejected, time.Now(), result, false)
+	recordQueryMetrics(executed, time.Now(), result, true)
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	metricsHandler("secret").ServeHTTP(response, request)
+	body := response.Body.String()
+
+	expected := []string{
+		`picnic_graphql_rejected_requests_total{operation="` + rejected + `"} 1`,
+		`picnic_graphql_resolver_errors_total{operation="` + executed + `"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Line %s not found in:\n%s", line, body)
+		}
+	}
+
+	unexpected := []string{
+		`picnic_graphql_resolver_errors_total{operation="` + rejected + `"}`,
+		`picnic_graphql_rejected_requests_total{operation="` + executed + `"}`,
+	}
+	for _, line := range unexpected {
+		if strings.Contains(body, line) {
+			t.Errorf("Line %s must not be in:\n%s", line, body)
+		}
+	}
+}
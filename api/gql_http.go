@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Media types of the GraphQL-over-HTTP specification.
+const (
+	jsonMediaType            = "application/json"
+	graphqlMediaType         = "application/graphql"
+	graphqlResponseMediaType = "application/graphql-response+json"
+)
+
+// httpError is a request that cannot be executed, answered with its status code before running any operation.
+type httpError struct {
+	status  int
+	message string
+	allow   string
+}
+
+func (err *httpError) Error() string {
+	return err.message
+}
+
+func newHTTPError(status int, format string, args ...interface{}) *httpError {
+	return &httpError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// decodeRequest reads the operations of a request. GET requests send the operation in the query parameters and can only
+// run queries, which the handler checks once the query is parsed. POST requests send a JSON object, a JSON array with a
+// batch of operations, or the query itself with the application/graphql media type. The second value is true for
+// batches, which are answered with an array.
+func decodeRequest(request *http.Request, maxBodyBytes, maxBatchSize int) ([]reqBody, bool, *httpError) {
+	switch request.Method {
+	case http.MethodGet:
+		body, err := decodeQueryParameters(request, request.URL.Query().Get("query"))
+		if err != nil {
+			return nil, false, err
+		}
+		return []reqBody{body}, false, nil
+
+	case http.MethodPost:
+		return decodePostRequest(request, maxBodyBytes, maxBatchSize)
+
+	default:
+		return nil, false, &httpError{
+			status:  http.StatusMethodNotAllowed,
+			message: fmt.Sprintf("method %s is not allowed", request.Method),
+			allow:   http.MethodGet + ", " + http.MethodPost,
+		}
+	}
+}
+
+func mutationWithGetError() *httpError {
+	return &httpError{
+		status:  http.StatusMethodNotAllowed,
+		message: "mutations cannot be sent with GET requests",
+		allow:   http.MethodPost,
+	}
+}
+
+func decodePostRequest(request *http.Request, maxBodyBytes, maxBatchSize int) ([]reqBody, bool, *httpError) {
+	mediaType := jsonMediaType
+	if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, false, newHTTPError(http.StatusUnsupportedMediaType, "invalid Content-Type %s", contentType)
+		}
+	}
+
+	content, err := readBody(request, maxBodyBytes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch mediaType {
+	case jsonMediaType:
+		return decodeJSONBody(content, maxBatchSize)
+	case graphqlMediaType:
+		body, err := decodeQueryParameters(request, string(content))
+		if err != nil {
+			return nil, false, err
+		}
+		return []reqBody{body}, false, nil
+	default:
+		return nil, false, newHTTPError(http.StatusUnsupportedMediaType,
+			"Content-Type must be %s or %s", jsonMediaType, graphqlMediaType)
+	}
+}
+
+// readBody reads the whole body, rejecting the bodies larger than the limit without reading them completely.
+func readBody(request *http.Request, maxBodyBytes int) ([]byte, *httpError) {
+	content, err := ioutil.ReadAll(io.LimitReader(request.Body, int64(maxBodyBytes)+1))
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "cannot read the request body: %s", err.Error())
+	} else if len(content) > maxBodyBytes {
+		return nil, newHTTPError(http.StatusRequestEntityTooLarge,
+			"the request body is larger than %d bytes", maxBodyBytes)
+	}
+
+	return content, nil
+}
+
+func decodeJSONBody(content []byte, maxBatchSize int) ([]reqBody, bool, *httpError) {
+	content = bytes.TrimSpace(content)
+	batch := len(content) > 0 && content[0] == '['
+
+	var bodies []reqBody
+	if batch {
+		if err := json.Unmarshal(content, &bodies); err != nil {
+			return nil, false, newHTTPError(http.StatusBadRequest, "invalid JSON request body: %s", err.Error())
+		} else if len(bodies) == 0 {
+			return nil, false, newHTTPError(http.StatusBadRequest, "the batch does not have any operation")
+		} else if len(bodies) > maxBatchSize {
+			return nil, false, newHTTPError(http.StatusBadRequest,
+				"the batch has %d operations, the limit is %d", len(bodies), maxBatchSize)
+		}
+	} else {
+		var body reqBody
+		if err := json.Unmarshal(content, &body); err != nil {
+			return nil, false, newHTTPError(http.StatusBadRequest, "invalid JSON request body: %s", err.Error())
+		}
+		bodies = []reqBody{body}
+	}
+
+	for _, body := range bodies {
+		if strings.TrimSpace(body.Query) == "" && !body.persisted() {
+			return nil, false, newHTTPError(http.StatusBadRequest, "the request does not have a query")
+		}
+	}
+
+	return bodies, batch, nil
+}
+
+// decodeQueryParameters reads the variables, the operation name and the extensions of the query parameters, where
+// they are encoded in GET requests and in application/graphql requests.
+func decodeQueryParameters(request *http.Request, query string) (reqBody, *httpError) {
+	parameters := request.URL.Query()
+	body := reqBody{Query: query, OperationName: parameters.Get("operationName")}
+
+	if variables := parameters.Get("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &body.Variables); err != nil {
+			return body, newHTTPError(http.StatusBadRequest, "variables must be a JSON object: %s", err.Error())
+		}
+	}
+
+	if extensions := parameters.Get("extensions"); extensions != "" {
+		if err := json.Unmarshal([]byte(extensions), &body.Extensions); err != nil {
+			return body, newHTTPError(http.StatusBadRequest, "extensions must be a JSON object: %s", err.Error())
+		}
+	}
+
+	if strings.TrimSpace(body.Query) == "" && !body.persisted() {
+		return body, newHTTPError(http.StatusBadRequest, "the request does not have a query")
+	}
+
+	return body, nil
+}
+
+// operationType returns the type of the operation the request runs: query, mutation or subscription. The query is
+// taken from the query cache, so it is parsed once for the request. Requests that cannot be parsed or validated
+// return an empty string, and get the errors when they are executed.
+func (server *gqlServerImp) operationType(body reqBody) string {
+	query := server.queries.parse(body.Query)
+	if query.document == nil {
+		return ""
+	}
+
+	if operation := selectOperation(query.document, body.OperationName); operation != nil {
+		return operation.Operation
+	}
+
+	return ""
+}
+
+// selectOperation returns the operation of the document with the name, or the first one when the name is empty.
+func selectOperation(document *ast.Document, operationName string) *ast.OperationDefinition {
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		name := ""
+		if operation.Name != nil {
+			name = operation.Name.Value
+		}
+
+		if operationName == "" || operationName == name {
+			return operation
+		}
+	}
+
+	return nil
+}
+
+// responseMediaType returns application/graphql-response+json when the client accepts it, and application/json
+// otherwise, which is what the clients that predate the specification expect.
+func responseMediaType(request *http.Request) string {
+	for _, accepted := range strings.Split(request.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil &&
+			mediaType == graphqlResponseMediaType {
+			return graphqlResponseMediaType
+		}
+	}
+
+	return jsonMediaType
+}
+
+// resultStatus returns the status code of the result of a single operation. With application/json every request is
+// answered with 200. With application/graphql-response+json the requests that were not executed, like the ones with
+// syntax or validation errors, are answered with 400. Executed requests are answered with 200 even without data,
+// which happens when a non-null field fails.
+func resultStatus(mediaType string, result *graphql.Result, executed bool) int {
+	if mediaType == graphqlResponseMediaType && !executed && result.HasErrors() {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusOK
+}
+
+func writeGqlResponse(response http.ResponseWriter, mediaType string, status int, payload interface{}) {
+	response.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(payload)
+}
+
+func writeHTTPError(response http.ResponseWriter, mediaType string, err *httpError) {
+	if err.allow != "" {
+		response.Header().Set("Allow", err.allow)
+	}
+
+	writeGqlResponse(response, mediaType, err.status, map[string]interface{}{
+		"errors": []interface{}{
+			map[string]interface{}{
+				"message":    err.message,
+				"extensions": map[string]interface{}{"code": BAD_REQUEST_ERROR_CODE},
+			},
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		operations  int
+		batch       bool
+	}{
+		{"get query", http.MethodGet, "/graphql?query=" + url.QueryEscape("{ allUsers { id } }") +
+			"&variables=" + url.QueryEscape(`{"id": "1"}`), "", "", 0, 1, false},
+		{"get mutation", http.MethodGet, "/graphql?query=" + url.QueryEscape("mutation { deleteUser(id: 1) }"),
+			"", "", 0, 1, false},
+		{"get without query", http.MethodGet, "/graphql", "", "", http.StatusBadRequest, 0, false},
+		{"get with invalid variables", http.MethodGet, "/graphql?query=%7Bme%7D&variables=%5B", "", "",
+			http.StatusBadRequest, 0, false},
+		{"put", http.MethodPut, "/graphql", jsonMediaType, `{"query": "{ me }"}`,
+			http.StatusMethodNotAllowed, 0, false},
+		{"post json", http.MethodPost, "/graphql", "application/json; charset=utf-8", `{"query": "{ me }"}`,
+			0, 1, false},
+		{"post batch", http.MethodPost, "/graphql", jsonMediaType, `[{"query": "{ me }"}, {"query": "{ me }"}]`,
+			0, 2, true},
+		{"post empty batch", http.MethodPost, "/graphql", jsonMediaType, `[]`, http.StatusBadRequest, 0, false},
+		{"post batch over the limit", http.MethodPost, "/graphql", jsonMediaType,
+			`[{"query": "{ me }"}, {"query": "{ me }"}, {"query": "{ me }"}]`, http.StatusBadRequest, 0, false},
+		{"post invalid json", http.MethodPost, "/graphql", jsonMediaType, `{"query": `, http.StatusBadRequest, 0, false},
+		{"post without query", http.MethodPost, "/graphql", jsonMediaType, `{}`, http.StatusBadRequest, 0, false},
+		{"post graphql", http.MethodPost, "/graphql?operationName=Me", graphqlMediaType, "query Me { me }",
+			0, 1, false},
+		{"post unsupported media type", http.MethodPost, "/graphql", "text/plain", "{ me }",
+			http.StatusUnsupportedMediaType, 0, false},
+		{"post too large", http.MethodPost, "/graphql", jsonMediaType,
+			`{"query": "{ me }", "variables": {"text": "` + strings.Repeat("a", 100) + `"}}`,
+			http.StatusRequestEntityTooLarge, 0, false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.contentType != "" {
+			request.Header.Set("Content-Type", test.contentType)
+		}
+
+		bodies, batch, err := decodeRequest(request, 100, 2)
+		if test.status != 0 {
+			if err == nil || err.status != test.status {
+				t.Errorf("%s: expected status %d, received %v", test.name, test.status, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err.message)
+		} else if len(bodies) != test.operations || batch != test.batch {
+			t.Errorf("%s: expected %d operations, received %d", test.name, test.operations, len(bodies))
+		}
+	}
+}
+
+func TestDecodeRequestReadsQueryParameters(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/graphql?query=%7Bme%7D&operationName=Me&variables="+
+		url.QueryEscape(`{"id": "1"}`), nil)
+
+	bodies, _, err := decodeRequest(request, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if bodies[0].Query != "{me}" || bodies[0].OperationName != "Me" || bodies[0].Variables["id"] != "1" {
+		t.Error("The query parameters were not decoded. Value received: ", bodies[0])
+	}
+}
+
+func TestMutationsAreRejectedWithGet(t *testing.T) {
+	handler := testServer(t).getGqlHandler()
+	query := url.QueryEscape(`query Type { __typename } mutation Delete { deleteUser(email: "john@picnic.com") { count } }`)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/graphql?operationName=Type&query="+query, nil))
+	if response.Code != http.StatusOK {
+		t.Error("The query of a document with mutations was rejected: ", response.Body.String())
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/graphql?operationName=Delete&query="+query, nil))
+	if response.Code != http.StatusMethodNotAllowed || response.Header().Get("Allow") != http.MethodPost {
+		t.Error("The mutation was not rejected: ", response.Code)
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	failed := &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "Syntax Error"}}}
+	executed := &graphql.Result{Data: map[string]interface{}{"me": nil}, Errors: failed.Errors}
+	// a non-null field that fails nulls the whole data
+	withoutData := &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "user not found"}}}
+
+	if status := resultStatus(jsonMediaType, failed, false); status != http.StatusOK {
+		t.Error("application/json responses must be answered with 200. Value received: ", status)
+	} else if status = resultStatus(graphqlResponseMediaType, failed, false); status != http.StatusBadRequest {
+		t.Error("Requests that were not executed must be answered with 400. Value received: ", status)
+	} else if status = resultStatus(graphqlResponseMediaType, executed, true); status != http.StatusOK {
+		t.Error("Executed requests must be answered with 200. Value received: ", status)
+	} else if status = resultStatus(graphqlResponseMediaType, withoutData, true); status != http.StatusOK {
+		t.Error("Executed requests without data must be answered with 200. Value received: ", status)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	request.Header.Set("Accept", "application/graphql-response+json;charset=utf-8, application/json;q=0.9")
+	if mediaType := responseMediaType(request); mediaType != graphqlResponseMediaType {
+		t.Error("The accepted media type was not used. Value received: ", mediaType)
+	}
+}
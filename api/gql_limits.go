@@ -0,0 +1,340 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listSizeArguments are the arguments that set how many items a field returns, in order of preference.
+var listSizeArguments = []string{"first", "last", "offset"}
+
+// unboundedListArgument is the argument of allUsers and allProjects that, despite its name, is their page size. Its
+// default, 0, returns every item, so the lists without it are unbounded.
+const unboundedListArgument = "offset"
+
+// introspectionCost is the cost of an introspection field with a selection, like __schema or __type, whatever it
+// selects. The introspection lists are small and do not reach the database, but the query GraphiQL sends would be
+// over any complexity limit if they were multiplied like the lists of the schema.
+const introspectionCost = 10
+
+// queryLimits rejects the queries that are too deep or too expensive before they are executed. The schema is cyclic,
+// so without limits a small query can fan out into thousands of database lookups.
+//
+// Every field that returns an object costs 1, or the cost set for it in fieldCosts by "Type.field", and scalar fields
+// are free. The cost of the fields selected inside a list is multiplied by the number of items requested with the
+// first, last or offset arguments, or by defaultListSize when the query does not say it. first and last cannot be
+// over MAX_PAGE_SIZE, and an offset of 0 requests every item, so it is charged as unbounded. The complexity saturates
+// over maxComplexity, so huge sizes cannot overflow it. A zero limit is disabled.
+type queryLimits struct {
+	schema          *graphql.Schema
+	maxDepth        int
+	maxComplexity   int
+	defaultListSize int
+	fieldCosts      map[string]int
+}
+
+// queryAnalysis walks the selected operation of a query, with its fragments and its variables.
+type queryAnalysis struct {
+	limits    *queryLimits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+}
+
+// check returns the error sent to the client when the operation is over any of the limits.
+func (limits *queryLimits) check(document *ast.Document, body reqBody) *gqlError {
+	if limits == nil || (limits.maxDepth <= 0 && limits.maxComplexity <= 0) {
+		return nil
+	}
+
+	depth, complexity := limits.measure(document, body)
+	if limits.maxDepth > 0 && depth > limits.maxDepth {
+		return newGqlError(QUERY_TOO_DEEP_ERROR_CODE,
+			fmt.Sprintf("the query has depth %d, the limit is %d", depth, limits.maxDepth),
+			map[string]interface{}{"depth": depth, "maxDepth": limits.maxDepth})
+	} else if limits.maxComplexity > 0 && complexity > limits.maxComplexity {
+		return newGqlError(QUERY_TOO_COMPLEX_ERROR_CODE,
+			fmt.Sprintf("the query has complexity %d, the limit is %d", complexity, limits.maxComplexity),
+			map[string]interface{}{"complexity": complexity, "maxComplexity": limits.maxComplexity})
+	}
+
+	return nil
+}
+
+// complexityCap is the value the complexity saturates at, which is already over maxComplexity.
+func (limits *queryLimits) complexityCap() int {
+	if limits.maxComplexity > 0 {
+		return limits.maxComplexity + 1
+	}
+
+	return math.MaxInt32
+}
+
+// add returns first + second, saturated at the complexity cap.
+func (limits *queryLimits) add(first, second int) int {
+	if result := first + second; result < limits.complexityCap() {
+		return result
+	}
+
+	return limits.complexityCap()
+}
+
+// multiply returns first * second, saturated at the complexity cap. Both values are positive or zero.
+func (limits *queryLimits) multiply(first, second int) int {
+	if first == 0 || second == 0 {
+		return 0
+	} else if first > limits.complexityCap()/second {
+		return limits.complexityCap()
+	}
+
+	return limits.add(first*second, 0)
+}
+
+// measure returns the depth and the complexity of the operation of the request.
+func (limits *queryLimits) measure(document *ast.Document, body reqBody) (int, int) {
+	analysis := &queryAnalysis{
+		limits:    limits,
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: body.Variables,
+		defaults:  map[string]ast.Value{},
+	}
+
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			analysis.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	operation := selectOperation(document, body.OperationName)
+	if operation == nil {
+		// graphql-go reports the missing operation when the query is executed
+		return 0, 0
+	}
+
+	for _, variable := range operation.VariableDefinitions {
+		if variable.DefaultValue != nil {
+			analysis.defaults[variable.Variable.Name.Value] = variable.DefaultValue
+		}
+	}
+
+	var rootType *graphql.Object
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		rootType = limits.schema.MutationType()
+	case ast.OperationTypeSubscription:
+		rootType = limits.schema.SubscriptionType()
+	default:
+		rootType = limits.schema.QueryType()
+	}
+
+	if rootType == nil {
+		return 0, 0
+	}
+
+	return analysis.selectionSet(operation.SelectionSet, rootType, false)
+}
+
+// selectionSet returns the depth and the complexity of the fields selected in a type. sized is true when the size of
+// the list inside it was already taken from the arguments of the parent field, like in connections.
+func (analysis *queryAnalysis) selectionSet(
+	selectionSet *ast.SelectionSet,
+	parent graphql.Type,
+	sized bool) (int, int) {
+
+	if selectionSet == nil || parent == nil {
+		return 0, 0
+	}
+
+	maxDepth, complexity := 0, 0
+	for _, selection := range selectionSet.Selections {
+		var depth, cost int
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			depth, cost = analysis.field(selection, parent, sized)
+		case *ast.InlineFragment:
+			fragmentType := parent
+			if selection.TypeCondition != nil {
+				fragmentType = analysis.limits.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			depth, cost = analysis.selectionSet(selection.SelectionSet, fragmentType, sized)
+		case *ast.FragmentSpread:
+			if fragment, ok := analysis.fragments[selection.Name.Value]; ok {
+				fragmentType := analysis.limits.schema.Type(fragment.TypeCondition.Name.Value)
+				depth, cost = analysis.selectionSet(fragment.SelectionSet, fragmentType, sized)
+			}
+		}
+
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		complexity = analysis.limits.add(complexity, cost)
+	}
+
+	return maxDepth, complexity
+}
+
+func (analysis *queryAnalysis) field(field *ast.Field, parent graphql.Type, sized bool) (int, int) {
+	name := field.Name.Value
+	definition := fieldDefinition(parent, name)
+	if definition == nil {
+		// graphql-go reports the unknown field when the query is validated
+		return 0, 0
+	}
+
+	fieldType, isList := unwrapType(definition.Type)
+	if strings.HasPrefix(name, "__") {
+		return analysis.introspectionField(field, fieldType)
+	}
+
+	depth, childrenCost := 0, 0
+	size, hasSize := analysis.listSize(field, definition)
+
+	if field.SelectionSet != nil {
+		// the size of a list field is its own, the size of a connection is the one of the list inside it
+		depth, childrenCost = analysis.selectionSet(field.SelectionSet, fieldType, hasSize && !isList)
+	}
+
+	cost := 0
+	if field.SelectionSet != nil {
+		cost = 1
+		if fieldCost, ok := analysis.limits.fieldCosts[parent.Name()+"."+name]; ok {
+			cost = fieldCost
+		}
+	}
+
+	switch {
+	case hasSize:
+		childrenCost = analysis.limits.multiply(childrenCost, size)
+	case isList && !sized:
+		childrenCost = analysis.limits.multiply(childrenCost, analysis.limits.defaultListSize)
+	}
+
+	return depth + 1, analysis.limits.add(cost, childrenCost)
+}
+
+// introspectionField returns the depth of an introspection field and its fixed cost. The fields selected inside it
+// count for the depth, but not for the complexity.
+func (analysis *queryAnalysis) introspectionField(field *ast.Field, fieldType graphql.Type) (int, int) {
+	if field.SelectionSet == nil {
+		return 1, 0
+	}
+
+	depth, _ := analysis.selectionSet(field.SelectionSet, fieldType, false)
+	return depth + 1, introspectionCost
+}
+
+// listSize returns the number of items requested with the size arguments of the field. The sizes of first and last
+// are clamped to MAX_PAGE_SIZE, as the connections reject larger pages. An offset of 0, which is also its default,
+// returns every item and its size is the complexity cap.
+func (analysis *queryAnalysis) listSize(field *ast.Field, definition *graphql.FieldDefinition) (int, bool) {
+	for _, name := range listSizeArguments {
+		value, ok := argumentValue(field, name)
+		if !ok && (name != unboundedListArgument || !hasArgument(definition, name)) {
+			continue
+		}
+
+		size := analysis.intValue(value)
+		switch {
+		case name == unboundedListArgument && size <= 0:
+			return analysis.limits.complexityCap(), true
+		case size > MAX_PAGE_SIZE && name != unboundedListArgument:
+			return MAX_PAGE_SIZE, true
+		case size > 0:
+			return size, true
+		}
+		// zero or a missing variable select the default size
+		return analysis.limits.defaultListSize, true
+	}
+
+	return 0, false
+}
+
+// argumentValue returns the value of the argument of the field with the name, and whether the query sets it.
+func argumentValue(field *ast.Field, name string) (ast.Value, bool) {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value == name {
+			return argument.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func hasArgument(definition *graphql.FieldDefinition, name string) bool {
+	for _, argument := range definition.Args {
+		if argument.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (analysis *queryAnalysis) intValue(value ast.Value) int {
+	if value == nil {
+		return 0
+	}
+
+	switch value := value.(type) {
+	case *ast.IntValue:
+		// out of range values are parsed as the largest int
+		size, _ := strconv.Atoi(value.Value)
+		return size
+	case *ast.Variable:
+		name := value.Name.Value
+		switch size := analysis.variables[name].(type) {
+		case float64:
+			if size >= math.MaxInt32 {
+				return math.MaxInt32
+			}
+			return int(size)
+		case int:
+			return size
+		}
+		return analysis.intValue(analysis.defaults[name])
+	}
+
+	return 0
+}
+
+func fieldDefinition(parent graphql.Type, name string) *graphql.FieldDefinition {
+	switch name {
+	case graphql.SchemaMetaFieldDef.Name:
+		return graphql.SchemaMetaFieldDef
+	case graphql.TypeMetaFieldDef.Name:
+		return graphql.TypeMetaFieldDef
+	case graphql.TypeNameMetaFieldDef.Name:
+		return graphql.TypeNameMetaFieldDef
+	}
+
+	switch parent := parent.(type) {
+	case *graphql.Object:
+		return parent.Fields()[name]
+	case *graphql.Interface:
+		return parent.Fields()[name]
+	}
+
+	return nil
+}
+
+// unwrapType returns the named type of a field, and whether the field returns a list of it.
+func unwrapType(fieldType graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch wrapper := fieldType.(type) {
+		case *graphql.NonNull:
+			fieldType = wrapper.OfType
+		case *graphql.List:
+			fieldType = wrapper.OfType
+			isList = true
+		default:
+			return fieldType, isList
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// newTestLimitsSchema returns a cyclic schema like the one of the API: users have projects, and projects have owners.
+func newTestLimitsSchema(t *testing.T) *graphql.Schema {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "User",
+		Fields: graphql.Fields{"name": &graphql.Field{Type: graphql.String}},
+	})
+	projectType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Project",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.String},
+			"owner": &graphql.Field{Type: userType},
+		},
+	})
+	userType.AddFieldConfig("projects", &graphql.Field{Type: graphql.NewList(projectType)})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"users": &graphql.Field{
+					Type: graphql.NewList(userType),
+					Args: graphql.FieldConfigArgument{"first": &graphql.ArgumentConfig{Type: graphql.Int}},
+				},
+				"allUsers": &graphql.Field{
+					Type: graphql.NewList(userType),
+					Args: graphql.FieldConfigArgument{
+						"offset": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int), DefaultValue: 0},
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &schema
+}
+
+func measureTestQuery(t *testing.T, limits *queryLimits, body reqBody) (int, int) {
+	document, err := parser.Parse(parser.ParseParams{Source: body.Query})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return limits.measure(document, body)
+}
+
+func TestQueryDepthAndComplexity(t *testing.T) {
+	limits := &queryLimits{schema: newTestLimitsSchema(t), defaultListSize: 10, fieldCosts: map[string]int{}}
+
+	tests := []struct {
+		body       reqBody
+		depth      int
+		complexity int
+	}{
+		{reqBody{Query: "{ users { name } }"}, 2, 1},
+		{reqBody{Query: "{ users(first: 5) { projects { name } } }"}, 3, 1 + 5*(1+0)},
+		{reqBody{Query: "{ users(first: 5) { projects { owner { name } } } }"}, 4, 1 + 5*(1+10*1)},
+		{reqBody{Query: "query Users($n: Int) { users(first: $n) { projects { name } } }",
+			Variables: map[string]interface{}{"n": float64(2)}}, 3, 1 + 2*1},
+		{reqBody{Query: "query Users($n: Int = 3) { users(first: $n) { projects { name } } }"}, 3, 1 + 3*1},
+		{reqBody{Query: "{ users(first: 2) { ...UserProjects } } fragment UserProjects on User { projects { name } }"},
+			3, 1 + 2*1},
+		{reqBody{Query: "{ __schema { types { fields { type { ofType { name } } } } } }"}, 6, introspectionCost},
+		{reqBody{Query: "{ users(first: 2) { __typename projects { name } } }"}, 3, 1 + 2*1},
+		{reqBody{Query: "{ users(first: 1000) { projects { name } } }"}, 3, 1 + MAX_PAGE_SIZE*1},
+		{reqBody{Query: "{ allUsers(offset: 3) { projects { name } } }"}, 3, 1 + 3*1},
+	}
+
+	for _, test := range tests {
+		if depth, complexity := measureTestQuery(t, limits, test.body); depth != test.depth ||
+			complexity != test.complexity {
+			t.Errorf("%s: expected depth %d and complexity %d, received %d and %d",
+				test.body.Query, test.depth, test.complexity, depth, complexity)
+		}
+	}
+}
+
+func TestQueryComplexitySaturates(t *testing.T) {
+	limits := &queryLimits{
+		schema:          newTestLimitsSchema(t),
+		maxComplexity:   1000,
+		defaultListSize: 10,
+		fieldCosts:      map[string]int{},
+	}
+
+	tests := []reqBody{
+		{Query: "{ users(first: 4611686018427387904) { projects { owner { name } } } }"},
+		{Query: "{ users(first: 99999999999999999999999) { projects { owner { name } } } }"},
+		{Query: "query Users($n: Int) { users(first: $n) { projects { owner { name } } } }",
+			Variables: map[string]interface{}{"n": float64(1e300)}},
+		{Query: "{ allUsers { projects { name } } }"},
+		{Query: "{ allUsers(offset: 0) { projects { name } } }"},
+		{Query: "{ allUsers(offset: 4611686018427387904) { projects { owner { projects { name } } } } }"},
+	}
+
+	for _, test := range tests {
+		if _, complexity := measureTestQuery(t, limits, test); complexity <= limits.maxComplexity {
+			t.Errorf("%s: expected a complexity over %d, received %d", test.Query, limits.maxComplexity, complexity)
+		}
+	}
+}
+
+func TestQueryLimitsRejectQueries(t *testing.T) {
+	schema := newTestLimitsSchema(t)
+	limits := &queryLimits{
+		schema:          schema,
+		maxDepth:        3,
+		maxComplexity:   50,
+		defaultListSize: 10,
+		fieldCosts:      map[string]int{"User.projects": 5},
+	}
+
+	check := func(query string) *gqlError {
+		document, _ := parser.Parse(parser.ParseParams{Source: query})
+		return limits.check(document, reqBody{Query: query})
+	}
+
+	if err := check("{ users(first: 2) { projects { name } } }"); err != nil {
+		t.Error("A query under the limits was rejected: ", err)
+	} else if err = check("{ users { projects { owner { name } } } }"); err == nil ||
+		err.Extensions()["code"] != QUERY_TOO_DEEP_ERROR_CODE {
+		t.Error("A query over the depth limit was not rejected: ", err)
+	} else if err = check("{ users(first: 20) { projects { name } } }"); err == nil ||
+		err.Extensions()["code"] != QUERY_TOO_COMPLEX_ERROR_CODE {
+		t.Error("A query over the complexity limit was not rejected: ", err)
+	} else if err = check("{ __schema { types { fields { type { name } } } } }"); err == nil ||
+		err.Extensions()["code"] != QUERY_TOO_DEEP_ERROR_CODE {
+		t.Error("An introspection query over the depth limit was not rejected: ", err)
+	} else if err = check("{ users(first: 4611686018427387904) { projects { owner { name } } } }"); err == nil {
+		t.Error("A query with an overflowing list size was not rejected")
+	}
+}
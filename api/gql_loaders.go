@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/freddy311082/picnic-server/auth"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/graphql-go/graphql"
+)
+
+// Loaders batch and cache the objects read by the resolvers of a single request. A resolver calls Load and returns
+// the thunk it gets back to graphql-go, which runs the thunks only after every sibling field was resolved. The first
+// thunk that runs reads every pending id with one query, so a list of N projects loads its owners with one query
+// instead of N.
+
+type loadersCtxKey struct{}
+
+// batchFetchFunc reads the objects of a list of ids. The result must contain every id that exists.
+type batchFetchFunc func(ids model.IDList) (map[string]interface{}, error)
+
+type batchLoader struct {
+	mutex   sync.Mutex
+	name    string
+	fetch   batchFetchFunc
+	pending map[string]model.ID
+	cache   map[string]interface{}
+	errors  map[string]error
+}
+
+func newBatchLoader(name string, fetch batchFetchFunc) *batchLoader {
+	return &batchLoader{
+		name:    name,
+		fetch:   fetch,
+		pending: map[string]model.ID{},
+		cache:   map[string]interface{}{},
+		errors:  map[string]error{},
+	}
+}
+
+// Load schedules the id for the next batch and returns a thunk that returns its object.
+func (loader *batchLoader) Load(id model.ID) func() (interface{}, error) {
+	if id == nil {
+		return func() (interface{}, error) {
+			return nil, fmt.Errorf("cannot load %s without id", loader.name)
+		}
+	}
+
+	key := id.ToString()
+
+	loader.mutex.Lock()
+	if _, ok := loader.cache[key]; !ok {
+		loader.pending[key] = id
+	}
+	loader.mutex.Unlock()
+
+	return func() (interface{}, error) {
+		loader.mutex.Lock()
+		defer loader.mutex.Unlock()
+
+		if _, ok := loader.pending[key]; ok {
+			loader.dispatch()
+		}
+
+		if err, ok := loader.errors[key]; ok {
+			return nil, err
+		} else if value, ok := loader.cache[key]; ok {
+			return value, nil
+		}
+
+		return nil, fmt.Errorf("%s %s not found", loader.name, key)
+	}
+}
+
+// dispatch reads every pending id. It must be called with the mutex locked.
+func (loader *batchLoader) dispatch() {
+	var ids model.IDList
+	for _, id := range loader.pending {
+		ids = append(ids, id)
+	}
+
+	result, err := loader.fetch(ids)
+	for key := range loader.pending {
+		if err != nil {
+			loader.errors[key] = err
+		} else if value, ok := result[key]; ok {
+			loader.cache[key] = value
+		}
+	}
+
+	loader.pending = map[string]model.ID{}
+}
+
+type gqlLoaders struct {
+	users              *batchLoader
+	customers          *batchLoader
+	projects           *batchLoader
+	projectsByCustomer *batchLoader
+	projectsByOwner    *batchLoader
+	history            *batchLoader
+}
+
+func newGqlLoaders(ctx context.Context) *gqlLoaders {
+	return &gqlLoaders{
+		users: newBatchLoader("user", func(ids model.IDList) (map[string]interface{}, error) {
+			result := map[string]interface{}{}
+			users, err := service.Instance().AllUsersWhereIDIsIn(ctx, ids)
+			for _, user := range users {
+				result[user.ID.ToString()] = user
+			}
+			return result, err
+		}),
+		customers: newBatchLoader("customer", func(ids model.IDList) (map[string]interface{}, error) {
+			result := map[string]interface{}{}
+			customers, err := service.Instance().AllCustomersWhereIDIsIn(ctx, ids)
+			for _, customer := range customers {
+				result[customer.ID.ToString()] = customer
+			}
+			return result, err
+		}),
+		projects: newBatchLoader("project", func(ids model.IDList) (map[string]interface{}, error) {
+			result := map[string]interface{}{}
+			projects, err := service.Instance().AllProjectWhereIDIsIn(ctx, ids)
+			for _, project := range projects {
+				result[project.ID.ToString()] = project
+			}
+			return result, err
+		}),
+		projectsByCustomer: newBatchLoader("customer projects", func(ids model.IDList) (map[string]interface{}, error) {
+			projects, err := service.Instance().AllProjectsFromCustomers(ctx, ids)
+			return groupProjects(ids, projects, func(project *model.Project) model.ID {
+				return project.CustomerID()
+			}), err
+		}),
+		projectsByOwner: newBatchLoader("user projects", func(ids model.IDList) (map[string]interface{}, error) {
+			projects, err := service.Instance().AllProjectsFromUsers(ctx, ids)
+			return groupProjects(ids, projects, func(project *model.Project) model.ID {
+				return project.OwnerID()
+			}), err
+		}),
+		history: newBatchLoader("history", func(ids model.IDList) (map[string]interface{}, error) {
+			entries, err := service.Instance().AuditLog(ctx, auth.UserFromContext(ctx), &model.AuditFilter{EntityIDs: ids})
+			return groupAuditEntries(ids, entries), err
+		}),
+	}
+}
+
+// groupProjects returns the projects of every id, including an empty list for the ids without projects.
+func groupProjects(
+	ids model.IDList,
+	projects model.ProjectList,
+	groupId func(project *model.Project) model.ID) map[string]interface{} {
+
+	groups := map[string]model.ProjectList{}
+	for _, id := range ids {
+		groups[id.ToString()] = model.ProjectList{}
+	}
+
+	for _, project := range projects {
+		key := groupId(project).ToString()
+		groups[key] = append(groups[key], project)
+	}
+
+	result := map[string]interface{}{}
+	for key, group := range groups {
+		result[key] = group
+	}
+
+	return result
+}
+
+// groupAuditEntries returns the entries of every entity id, including an empty list for the ids without entries.
+func groupAuditEntries(ids model.IDList, entries model.AuditEntryList) map[string]interface{} {
+	groups := map[string]model.AuditEntryList{}
+	for _, id := range ids {
+		groups[id.ToString()] = model.AuditEntryList{}
+	}
+
+	for _, entry := range entries {
+		key := entry.EntityID.ToString()
+		groups[key] = append(groups[key], entry)
+	}
+
+	result := map[string]interface{}{}
+	for key, group := range groups {
+		result[key] = group
+	}
+
+	return result
+}
+
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersCtxKey{}, newGqlLoaders(ctx))
+}
+
+// loaders returns the loaders of the request. Queries executed without them, like the ones run by the tests, get
+// new loaders that only batch the fields of a single resolver.
+func loaders(p graphql.ResolveParams) *gqlLoaders {
+	if p.Context != nil {
+		if result, ok := p.Context.Value(loadersCtxKey{}).(*gqlLoaders); ok {
+			return result
+		}
+	}
+
+	return newGqlLoaders(p.Context)
+}
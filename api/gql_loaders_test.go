@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+type testId string
+
+func (id testId) ToString() string {
+	return string(id)
+}
+
+func TestBatchLoaderReadsPendingIdsWithOneFetch(t *testing.T) {
+	var batches []model.IDList
+	loader := newBatchLoader("user", func(ids model.IDList) (map[string]interface{}, error) {
+		batches = append(batches, ids)
+		result := map[string]interface{}{}
+		for _, id := range ids {
+			if id.ToString() != "missing" {
+				result[id.ToString()] = "user " + id.ToString()
+			}
+		}
+		return result, nil
+	})
+
+	first := loader.Load(testId("1"))
+	second := loader.Load(testId("2"))
+	missing := loader.Load(testId("missing"))
+
+	if value, err := second(); err != nil || value != "user 2" {
+		t.Error("Invalid value returned by the loader.")
+	}
+
+	if value, err := first(); err != nil || value != "user 1" {
+		t.Error("Invalid value returned by the loader.")
+	}
+
+	if _, err := missing(); err == nil {
+		t.Error("Loading an id that does not exist must fail.")
+	}
+
+	if value, _ := loader.Load(testId("1"))(); value != "user 1" || len(batches) != 1 {
+		t.Error("Every pending id must be read with one fetch and then cached.")
+		t.Log("Batches: ", batches)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+const redactedVariable = "*****"
+
+// sensitiveVariableNames are the parts of the names of the variables that are never logged.
+var sensitiveVariableNames = []string{"email", "password", "token", "code", "secret"}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// redactVariables returns a copy of the query variables without the values of the sensitive ones.
+func redactVariables(variables map[string]interface{}) map[string]interface{} {
+	if variables == nil {
+		return nil
+	}
+
+	result := map[string]interface{}{}
+	for name, value := range variables {
+		if isSensitiveVariable(name) {
+			result[name] = redactedVariable
+		} else {
+			result[name] = redactValue(value)
+		}
+	}
+
+	return result
+}
+
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return redactVariables(value)
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = redactValue(item)
+		}
+		return result
+	}
+
+	return value
+}
+
+func isSensitiveVariable(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitiveName := range sensitiveVariableNames {
+		if strings.Contains(name, sensitiveName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection over to the WebSocket connections of the subscriptions.
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response does not support hijacking")
+	}
+
+	recorder.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// requestIDMiddleware gives every request an ID, taken from the X-Request-ID header when the client sends a valid
+// one. The ID is returned in the response and added to the context, so every log line of the request contains it.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(utils.REQUEST_ID_HEADER)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		ctx := utils.WithRequestID(request.Context(), id)
+		response.Header().Set(utils.REQUEST_ID_HEADER, id)
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+
+		start := time.Now()
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		utils.ContextLogger(ctx).Infof("%s %s from %s answered %d in %s",
+			request.Method, request.URL.Path, request.RemoteAddr, recorder.status, time.Since(start))
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestRedactVariables(t *testing.T) {
+	variables := map[string]interface{}{
+		"email": "john@picnic.com",
+		"name":  "John",
+		"input": map[string]interface{}{
+			"loginCode": "123456",
+			"users":     []interface{}{map[string]interface{}{"userEmail": "jane@picnic.com"}},
+		},
+	}
+
+	result := redactVariables(variables)
+	input := result["input"].(map[string]interface{})
+	user := input["users"].([]interface{})[0].(map[string]interface{})
+
+	if result["email"] != redactedVariable || input["loginCode"] != redactedVariable ||
+		user["userEmail"] != redactedVariable {
+		t.Error("Sensitive variables were not redacted: ", result)
+	} else if result["name"] != "John" {
+		t.Error("Variables that are not sensitive were changed: ", result)
+	} else if variables["email"] != "john@picnic.com" {
+		t.Error("The variables of the request were changed")
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+const persistedQueryVersion = 1
+
+// persistedQueryNotFound is the message Apollo clients expect to send the full query again.
+const persistedQueryNotFound = "PersistedQueryNotFound"
+
+// persistedQueryExtension is the persistedQuery entry of the extensions of a request, sent by clients that support
+// automatic persisted queries.
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+type reqExtensions struct {
+	PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
+}
+
+// queryStore keeps the persisted queries by the sha256 hash of their text. Query returns an empty string when the
+// hash was not registered.
+type queryStore interface {
+	Query(ctx context.Context, hash string) (string, error)
+	SaveQuery(ctx context.Context, hash, query string) error
+}
+
+// memoryQueryStore keeps the most recently used queries in memory. The queries are lost when the server restarts,
+// and the clients register them again.
+type memoryQueryStore struct {
+	queries *lruCache
+}
+
+func (store *memoryQueryStore) Query(ctx context.Context, hash string) (string, error) {
+	if query, ok := store.queries.get(hash); ok {
+		return query.(string), nil
+	}
+
+	return "", nil
+}
+
+func (store *memoryQueryStore) SaveQuery(ctx context.Context, hash, query string) error {
+	store.queries.add(hash, query)
+	return nil
+}
+
+// dbQueryStore keeps the queries in the database, so every server instance knows them, with the most recently used
+// ones cached in memory.
+type dbQueryStore struct {
+	cache *memoryQueryStore
+}
+
+func (store *dbQueryStore) Query(ctx context.Context, hash string) (string, error) {
+	if query, _ := store.cache.Query(ctx, hash); query != "" {
+		return query, nil
+	}
+
+	query, err := service.Instance().GetPersistedQuery(ctx, hash)
+	if err != nil || query == "" {
+		return "", err
+	}
+
+	store.cache.SaveQuery(ctx, hash, query)
+	return query, nil
+}
+
+// SaveQuery only writes the queries that are not cached, as the cached ones were already registered.
+func (store *dbQueryStore) SaveQuery(ctx context.Context, hash, query string) error {
+	if cached, _ := store.cache.Query(ctx, hash); cached != "" {
+		return nil
+	} else if err := service.Instance().SavePersistedQuery(ctx, hash, query); err != nil {
+		return err
+	}
+
+	return store.cache.SaveQuery(ctx, hash, query)
+}
+
+// persistedQueries resolves the automatic persisted queries of the requests. Clients send the hash of a query, and
+// the query itself only when the server does not know the hash. Only the queries that parse and validate against the
+// schema are registered. In strict mode only the queries of the allowlist are executed and the clients cannot
+// register new ones.
+type persistedQueries struct {
+	store     queryStore
+	queries   *queryCache
+	strict    bool
+	allowlist map[string]string
+}
+
+func newPersistedQueries(
+	persistedSettings settings.PersistedQueriesSettings,
+	queries *queryCache) (*persistedQueries, error) {
+
+	result := &persistedQueries{
+		queries:   queries,
+		strict:    persistedSettings.Strict(),
+		allowlist: map[string]string{},
+	}
+
+	cache := &memoryQueryStore{queries: newLruCache(persistedSettings.CacheSize())}
+	if persistedSettings.Store() == utils.PERSISTED_QUERIES_STORE_MONGODB {
+		result.store = &dbQueryStore{cache: cache}
+	} else {
+		result.store = cache
+	}
+
+	if persistedSettings.AllowlistFile() != "" {
+		var err error
+		if result.allowlist, err = loadAllowlist(persistedSettings.AllowlistFile()); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// loadAllowlist reads a JSON object with the allowed queries by their sha256 hash.
+func loadAllowlist(filename string) (map[string]string, error) {
+	var allowlist map[string]string
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(content, &allowlist); err != nil {
+		return nil, fmt.Errorf("invalid allowlist file %s: %s", filename, err.Error())
+	}
+
+	result := map[string]string{}
+	for hash, query := range allowlist {
+		if queryHash(query) != strings.ToLower(hash) {
+			return nil, fmt.Errorf("invalid allowlist file %s: %s is not the sha256 hash of its query", filename, hash)
+		}
+		result[strings.ToLower(hash)] = query
+	}
+
+	return result, nil
+}
+
+func queryHash(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
+
+// resolve sets the query of a request that only has its hash, and registers the valid queries sent with their hash.
+// The error is returned to the client in the result of the operation.
+func (queries *persistedQueries) resolve(ctx context.Context, body *reqBody) *gqlError {
+	extension := body.Extensions.PersistedQuery
+	if extension == nil {
+		if queries.strict {
+			if _, ok := queries.allowlist[queryHash(body.Query)]; !ok {
+				return queries.notAllowedError()
+			}
+		}
+		return nil
+	}
+
+	if extension.Version != persistedQueryVersion {
+		return newGqlError(BAD_REQUEST_ERROR_CODE,
+			fmt.Sprintf("persisted query version %d is not supported", extension.Version), nil)
+	}
+
+	hash := strings.ToLower(extension.Sha256Hash)
+	if body.Query == "" {
+		return queries.lookup(ctx, hash, body)
+	} else if queryHash(body.Query) != hash {
+		return newGqlError(BAD_REQUEST_ERROR_CODE, "the sha256 hash does not match the query", nil)
+	}
+
+	if queries.strict {
+		if _, ok := queries.allowlist[hash]; !ok {
+			return queries.notAllowedError()
+		}
+		return nil
+	}
+
+	if query := queries.queries.parse(body.Query); query.document == nil {
+		// the query is not registered. It gets its errors when it is executed.
+		return nil
+	} else if err := queries.store.SaveQuery(ctx, hash, body.Query); err != nil {
+		// the query can run anyway. The client sends it again the next time.
+		loggerObj := utils.ContextLogger(ctx)
+		loggerObj.Error("cannot register persisted query: ", err.Error())
+	}
+
+	return nil
+}
+
+func (queries *persistedQueries) lookup(ctx context.Context, hash string, body *reqBody) *gqlError {
+	if query, ok := queries.allowlist[hash]; ok {
+		body.Query = query
+		return nil
+	} else if queries.strict {
+		return queries.notAllowedError()
+	}
+
+	query, err := queries.store.Query(ctx, hash)
+	if err != nil {
+		return internalError(err)
+	} else if query == "" {
+		return newGqlError(PERSISTED_QUERY_NOT_FOUND_ERROR_CODE, persistedQueryNotFound, nil)
+	}
+
+	body.Query = query
+	return nil
+}
+
+func (queries *persistedQueries) notAllowedError() *gqlError {
+	return newGqlError(
+		PERSISTED_QUERY_NOT_ALLOWED_ERROR_CODE, "only the persisted queries of the allowlist are allowed", nil)
+}
+
+// formatGqlError formats an error raised before the execution, which graphql-go does not format with extensions.
+func formatGqlError(err *gqlError) gqlerrors.FormattedError {
+	return gqlerrors.FormattedError{
+		Message:    err.Error(),
+		Locations:  []location.SourceLocation{},
+		Extensions: err.Extensions(),
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const persistedTestQuery = "{ me { id } }"
+
+func newTestPersistedQueries(queries *queryCache, strict bool, allowlist map[string]string) *persistedQueries {
+	return &persistedQueries{
+		store:     &memoryQueryStore{queries: newLruCache(10)},
+		queries:   queries,
+		strict:    strict,
+		allowlist: allowlist,
+	}
+}
+
+func persistedBody(query, hash string) *reqBody {
+	body := &reqBody{Query: query}
+	body.Extensions.PersistedQuery = &persistedQueryExtension{Version: persistedQueryVersion, Sha256Hash: hash}
+	return body
+}
+
+func TestPersistedQueriesAreRegisteredAndResolved(t *testing.T) {
+	ctx := context.Background()
+	queries := newTestPersistedQueries(newQueryCache(testSchema(t), 10), false, map[string]string{})
+	hash := queryHash(persistedTestQuery)
+
+	if err := queries.resolve(ctx, persistedBody("", hash)); err == nil || err.Error() != persistedQueryNotFound {
+		t.Fatal("An unknown hash was resolved: ", err)
+	}
+
+	if err := queries.resolve(ctx, persistedBody(persistedTestQuery, hash)); err != nil {
+		t.Fatal("The query was not registered: ", err)
+	}
+
+	body := persistedBody("", hash)
+	if err := queries.resolve(ctx, body); err != nil || body.Query != persistedTestQuery {
+		t.Error("The registered query was not resolved: ", err)
+	}
+
+	if err := queries.resolve(ctx, persistedBody("{ other }", hash)); err == nil {
+		t.Error("A query that does not match its hash was accepted")
+	}
+}
+
+func TestInvalidPersistedQueriesAreNotRegistered(t *testing.T) {
+	ctx := context.Background()
+	queries := newTestPersistedQueries(newQueryCache(testSchema(t), 10), false, map[string]string{})
+
+	for _, query := range []string{"{ me { id }", "{ unknownField }"} {
+		hash := queryHash(query)
+		if err := queries.resolve(ctx, persistedBody(query, hash)); err != nil {
+			t.Errorf("The query %s must be executed to get its errors: %s", query, err.Error())
+		} else if err = queries.resolve(ctx, persistedBody("", hash)); err == nil || err.Error() != persistedQueryNotFound {
+			t.Errorf("The query %s does not parse or validate, but it was registered", query)
+		}
+	}
+}
+
+func TestStrictPersistedQueriesOnlyRunTheAllowlist(t *testing.T) {
+	ctx := context.Background()
+	hash := queryHash(persistedTestQuery)
+	queries := newTestPersistedQueries(newQueryCache(testSchema(t), 10), true, map[string]string{hash: persistedTestQuery})
+
+	body := persistedBody("", hash)
+	if err := queries.resolve(ctx, body); err != nil || body.Query != persistedTestQuery {
+		t.Error("The query of the allowlist was not resolved: ", err)
+	}
+
+	if err := queries.resolve(ctx, &reqBody{Query: persistedTestQuery}); err != nil {
+		t.Error("The query of the allowlist was rejected: ", err)
+	}
+
+	other := "{ allUsers { id } }"
+	if err := queries.resolve(ctx, &reqBody{Query: other}); err == nil {
+		t.Error("A query out of the allowlist was accepted")
+	} else if err = queries.resolve(ctx, persistedBody(other, queryHash(other))); err == nil {
+		t.Error("A query out of the allowlist was registered")
+	}
+}
+
+func TestLoadAllowlistChecksTheHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "allowlist.json")
+	ioutil.WriteFile(filename, []byte(`{"`+queryHash(persistedTestQuery)+`": "{ me { id } }"}`), 0600)
+	if allowlist, err := loadAllowlist(filename); err != nil || len(allowlist) != 1 {
+		t.Error("The allowlist was not loaded: ", err)
+	}
+
+	ioutil.WriteFile(filename, []byte(`{"abc": "{ me { id } }"}`), 0600)
+	if _, err := loadAllowlist(filename); err == nil {
+		t.Error("An allowlist with a wrong hash was loaded")
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// Custom field values travel as strings in GraphQL: numbers in decimal notation, dates in RFC 3339, booleans as
+// "true" or "false" and enum values as one of the options of the field.
+
+type gqlProjectFieldRsp struct {
+	Name     string
+	Type     utils.ProjectFieldTypeEnum
+	Required bool
+	Options  []string
+	Default  *string
+	Value    *string
+}
+
+func gqlProjectFieldsFromModel(fields model.ProjectFieldList) []*gqlProjectFieldRsp {
+	result := []*gqlProjectFieldRsp{}
+
+	for _, field := range fields {
+		result = append(result, &gqlProjectFieldRsp{
+			Name:     field.Name,
+			Type:     field.Type,
+			Required: field.Required,
+			Options:  field.Options,
+			Default:  formatFieldValue(field.Default),
+			Value:    formatFieldValue(field.Value),
+		})
+	}
+
+	return result
+}
+
+func formatFieldValue(value interface{}) *string {
+	var result string
+
+	switch value := value.(type) {
+	case string:
+		result = value
+	case float64:
+		result = strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		result = value.Format(time.RFC3339)
+	case bool:
+		result = strconv.FormatBool(value)
+	default:
+		return nil
+	}
+
+	return &result
+}
+
+// parseFieldValue converts a value sent by the client into the Go type of the field type. The value is nil when the
+// client did not send it.
+func parseFieldValue(name string, fieldType utils.ProjectFieldTypeEnum, value interface{}) (interface{}, error) {
+	raw, ok := value.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	var result interface{}
+	var err error
+
+	switch fieldType {
+	case utils.FIELD_TYPE_NUMBER:
+		result, err = strconv.ParseFloat(raw, 64)
+	case utils.FIELD_TYPE_DATE:
+		result, err = time.Parse(time.RFC3339, raw)
+	case utils.FIELD_TYPE_BOOLEAN:
+		result, err = strconv.ParseBool(raw)
+	default:
+		result = raw
+	}
+
+	if err != nil {
+		return nil, badUserInputError("fields."+name, "value does not match the field type")
+	}
+
+	return result, nil
+}
+
+// projectFieldsFromArgs reads a list of ProjectFieldInput values.
+func projectFieldsFromArgs(value interface{}) (model.ProjectFieldList, error) {
+	inputs, _ := value.([]interface{})
+	fields := model.ProjectFieldList{}
+
+	for _, item := range inputs {
+		input, _ := item.(map[string]interface{})
+		field := model.ProjectField{}
+		field.Name, _ = input["name"].(string)
+		field.Type, _ = input["type"].(utils.ProjectFieldTypeEnum)
+		field.Required, _ = input["required"].(bool)
+
+		if options, ok := input["options"].([]interface{}); ok {
+			for _, option := range options {
+				if option, ok := option.(string); ok {
+					field.Options = append(field.Options, option)
+				}
+			}
+		}
+
+		var err error
+		if field.Default, err = parseFieldValue(field.Name, field.Type, input["default"]); err != nil {
+			return nil, err
+		} else if field.Value, err = parseFieldValue(field.Name, field.Type, input["value"]); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// setProjectFieldValues applies a list of ProjectFieldValueInput values to the fields defined in a project.
+func setProjectFieldValues(fields model.ProjectFieldList, value interface{}) error {
+	inputs, _ := value.([]interface{})
+
+	for _, item := range inputs {
+		input, _ := item.(map[string]interface{})
+		name, _ := input["name"].(string)
+
+		found := false
+		for i := range fields {
+			if fields[i].Name == name {
+				if value, err := parseFieldValue(name, fields[i].Type, input["value"]); err != nil {
+					return err
+				} else {
+					fields[i].Value = value
+				}
+				found = true
+			}
+		}
+
+		if !found {
+			return badUserInputError("fields."+name, "field is not defined in the project")
+		}
+	}
+
+	return nil
+}
+
+var ProjectFieldTypeType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ProjectFieldType",
+	Values: graphql.EnumValueConfigMap{
+		"TEXT": &graphql.EnumValueConfig{
+			Value: utils.ProjectFieldTypeEnum(utils.FIELD_TYPE_TEXT),
+		},
+		"NUMBER": &graphql.EnumValueConfig{
+			Value: utils.ProjectFieldTypeEnum(utils.FIELD_TYPE_NUMBER),
+		},
+		"DATE": &graphql.EnumValueConfig{
+			Value:       utils.ProjectFieldTypeEnum(utils.FIELD_TYPE_DATE),
+			Description: "Date and time in RFC 3339 format.",
+		},
+		"ENUM": &graphql.EnumValueConfig{
+			Value:       utils.ProjectFieldTypeEnum(utils.FIELD_TYPE_ENUM),
+			Description: "One of the options of the field.",
+		},
+		"BOOLEAN": &graphql.EnumValueConfig{
+			Value: utils.ProjectFieldTypeEnum(utils.FIELD_TYPE_BOOLEAN),
+		},
+	},
+})
+
+var ProjectFieldType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProjectField",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: ProjectFieldTypeType,
+		},
+		"required": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"options": &graphql.Field{
+			Type: &graphql.List{OfType: graphql.String},
+		},
+		"default": &graphql.Field{
+			Type: graphql.String,
+		},
+		"value": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+	Description: "Custom field of a project.",
+})
+
+var ProjectFieldInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProjectFieldInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type: &graphql.NonNull{OfType: graphql.String},
+		},
+		"type": &graphql.InputObjectFieldConfig{
+			Type: &graphql.NonNull{OfType: ProjectFieldTypeType},
+		},
+		"required": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Boolean,
+			Description: "If true the field must have a value or a default value.",
+		},
+		"options": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.List{OfType: &graphql.NonNull{OfType: graphql.String}},
+			Description: "Allowed values of an ENUM field.",
+		},
+		"default": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Value used when the project does not set one.",
+		},
+		"value": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+	},
+	Description: "Definition and value of a custom field.",
+})
+
+var ProjectFieldValueInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProjectFieldValueInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type:        &graphql.NonNull{OfType: graphql.String},
+			Description: "Name of a field defined in the project.",
+		},
+		"value": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "New value. If it is omitted the default value of the field is used.",
+		},
+	},
+})
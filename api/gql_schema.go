@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"github.com/freddy311082/picnic-server/auth"
 	"github.com/freddy311082/picnic-server/model"
 	"github.com/freddy311082/picnic-server/service"
 	"github.com/freddy311082/picnic-server/utils"
@@ -10,20 +12,24 @@ import (
 )
 
 type gqlUserRsp struct {
-	ID       string
-	Name     string
-	LastName string
-	Email    string
+	ID        string
+	Name      string
+	LastName  string
+	Email     string
+	Role      utils.UserRoleEnum
+	DeletedAt *time.Time
 }
 
 type gqlUserListRsp []*gqlUserRsp
 
 func gqlUserFromModel(user *model.User) *gqlUserRsp {
 	return &gqlUserRsp{
-		ID:       user.ID.ToString(),
-		Name:     user.Name,
-		LastName: user.LastName,
-		Email:    user.Email,
+		ID:        user.ID.ToString(),
+		Name:      user.Name,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Role:      user.Role,
+		DeletedAt: gqlDeletedAt(user.DeletedAt),
 	}
 }
 
@@ -44,6 +50,9 @@ type gqlProjectRsp struct {
 	CreatedAt   time.Time `json:"created_at"`
 	OwnerID     model.ID
 	CustomerID  model.ID
+	Fields      []*gqlProjectFieldRsp
+	Version     int64
+	DeletedAt   *time.Time
 }
 
 type gqlProjectListRsp []*gqlProjectRsp
@@ -54,8 +63,11 @@ func gqlProjectFromModel(project *model.Project) *gqlProjectRsp {
 		Name:        project.Name,
 		Description: project.Description,
 		CreatedAt:   project.CreatedAt,
-		CustomerID:  project.Customer.ID,
-		OwnerID:     project.Owner.ID,
+		CustomerID:  project.CustomerID(),
+		OwnerID:     project.OwnerID(),
+		Fields:      gqlProjectFieldsFromModel(project.Fields),
+		Version:     project.Version,
+		DeletedAt:   gqlDeletedAt(project.DeletedAt),
 	}
 
 	return result
@@ -72,20 +84,22 @@ func gqlProjectListFromModel(projects model.ProjectList) gqlProjectListRsp {
 }
 
 type gqlCustomerRsp struct {
-	ID       string
-	Name     string
-	Cuit     string
-	Projects gqlProjectListRsp
+	ID        string
+	Name      string
+	Cuit      string
+	Version   int64
+	DeletedAt *time.Time
 }
 
 type gqlCustomerListRsp []*gqlCustomerRsp
 
 func gqlCustomerFromModel(customer *model.Customer) *gqlCustomerRsp {
 	return &gqlCustomerRsp{
-		ID:       customer.ID.ToString(),
-		Name:     customer.Name,
-		Cuit:     customer.Cuit,
-		Projects: gqlProjectListFromModel(customer.Projects),
+		ID:        customer.ID.ToString(),
+		Name:      customer.Name,
+		Cuit:      customer.Cuit,
+		Version:   customer.Version,
+		DeletedAt: gqlDeletedAt(customer.DeletedAt),
 	}
 }
 
@@ -99,7 +113,104 @@ func gqlCustomerListFromModel(customers model.CustomerList) gqlCustomerListRsp {
 	return result
 }
 
+type gqlAuthPayloadRsp struct {
+	Token     string
+	ExpiresAt time.Time
+	User      *gqlUserRsp
+}
+
+type gqlDeletePayloadRsp struct {
+	DeletedIds []string
+	Count      int
+}
+
+func gqlDeletePayload(ids []string) *gqlDeletePayloadRsp {
+	return &gqlDeletePayloadRsp{
+		DeletedIds: ids,
+		Count:      len(ids),
+	}
+}
+
+// gqlDeletedAt returns nil for the records that are not deleted, so deletedAt is null for them.
+func gqlDeletedAt(deletedAt time.Time) *time.Time {
+	if deletedAt.IsZero() {
+		return nil
+	}
+
+	return &deletedAt
+}
+
+func includeDeletedArg(entities string) *graphql.ArgumentConfig {
+	return &graphql.ArgumentConfig{
+		Type:         graphql.Boolean,
+		DefaultValue: false,
+		Description:  "Also return the deleted " + entities + " that were not purged yet. Only admins can use it.",
+	}
+}
+
+// readContext returns the context of the reads of a query, which includes the deleted records when its
+// includeDeleted argument is set.
+func readContext(p graphql.ResolveParams) (context.Context, error) {
+	if includeDeleted, _ := p.Args["includeDeleted"].(bool); !includeDeleted {
+		return p.Context, nil
+	} else if ctx, err := service.Instance().IncludeDeleted(p.Context, currentUser(p)); err != nil {
+		return nil, serviceError(err)
+	} else {
+		return ctx, nil
+	}
+}
+
+func modelIDsFromArgs(value interface{}) model.IDList {
+	result := model.IDList{}
+
+	if values, ok := value.([]interface{}); ok {
+		for _, item := range values {
+			if id, ok := item.(string); ok {
+				result = append(result, service.Instance().CreateModelIDFromString(id))
+			}
+		}
+	}
+
+	return result
+}
+
+func idStrings(ids model.IDList) []string {
+	result := []string{}
+
+	for _, id := range ids {
+		result = append(result, id.ToString())
+	}
+
+	return result
+}
+
+// loadProjectList returns a thunk with the projects loaded for the id by a loader of project lists.
+func loadProjectList(loader *batchLoader, id model.ID) func() (interface{}, error) {
+	load := loader.Load(id)
+	return func() (interface{}, error) {
+		if projects, err := load(); err != nil {
+			return nil, err
+		} else {
+			return gqlProjectListFromModel(projects.(model.ProjectList)), nil
+		}
+	}
+}
+
 func GetSchema() (*graphql.Schema, error) {
+	UserRoleType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "UserRole",
+		Values: graphql.EnumValueConfigMap{
+			"USER": &graphql.EnumValueConfig{
+				Value:       utils.UserRoleEnum(utils.ROLE_USER),
+				Description: "Regular user. It can only modify its own projects.",
+			},
+			"ADMIN": &graphql.EnumValueConfig{
+				Value:       utils.UserRoleEnum(utils.ROLE_ADMIN),
+				Description: "Administrator. It can modify every project, customer and user.",
+			},
+		},
+	})
+
 	UserType := graphql.NewObject(graphql.ObjectConfig{
 		Name: "User",
 		Fields: graphql.Fields{
@@ -118,6 +229,15 @@ func GetSchema() (*graphql.Schema, error) {
 			"email": &graphql.Field{
 				Type: graphql.String,
 			},
+
+			"role": &graphql.Field{
+				Type: UserRoleType,
+			},
+
+			"deletedAt": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "Date when the user was deleted, null unless the user is deleted.",
+			},
 		},
 		Description: "User object type definition.",
 	})
@@ -137,15 +257,35 @@ func GetSchema() (*graphql.Schema, error) {
 			"created_at": &graphql.Field{
 				Type: graphql.DateTime,
 			},
+			"version": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Version of the project, increased by every update. updateProject requires it.",
+			},
+			"deletedAt": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "Date when the project was deleted, null unless the project is deleted.",
+			},
+			"fields": &graphql.Field{
+				Type:        &graphql.List{OfType: ProjectFieldType},
+				Description: "Custom fields of the project.",
+			},
 			"owner": &graphql.Field{
-				Type: UserType,
+				Type:        UserType,
+				Description: "Owner of the project, null when the owner was deleted with the set-null delete rule.",
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 					if project, ok := p.Source.(*gqlProjectRsp); !ok {
 						return nil, errors.New("cannot get Owner from the a project without id")
-					} else if user, err := service.Instance().GetOwnerFromProjectID(project.OwnerID); err != nil {
-						return nil, err
+					} else if project.OwnerID == nil {
+						return nil, nil
 					} else {
-						return gqlUserFromModel(user), nil
+						load := loaders(p).users.Load(project.OwnerID)
+						return func() (interface{}, error) {
+							if user, err := load(); err != nil {
+								return nil, err
+							} else {
+								return gqlUserFromModel(user.(*model.User)), nil
+							}
+						}, nil
 					}
 				},
 			},
@@ -165,6 +305,14 @@ func GetSchema() (*graphql.Schema, error) {
 			"cuit": &graphql.Field{
 				Type: graphql.String,
 			},
+			"version": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Version of the customer, increased by every update. updateCustomer requires it.",
+			},
+			"deletedAt": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "Date when the customer was deleted, null unless the customer is deleted.",
+			},
 			"projects": &graphql.Field{
 				Type: &graphql.List{
 					OfType: ProjectType,
@@ -173,11 +321,7 @@ func GetSchema() (*graphql.Schema, error) {
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 					if customer, ok := p.Source.(*gqlCustomerRsp); ok {
 						id := service.Instance().CreateModelIDFromString(customer.ID)
-						if projects, err := service.Instance().AllProjectsFromCustomer(id); err != nil {
-							return &gqlProjectListRsp{}, nil
-						} else {
-							return gqlProjectListFromModel(projects), nil
-						}
+						return loadProjectList(loaders(p).projectsByCustomer, id), nil
 					}
 
 					return model.IDList{}, nil
@@ -192,15 +336,8 @@ func GetSchema() (*graphql.Schema, error) {
 		Type: &graphql.List{OfType: ProjectType},
 		Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 			if user, ok := p.Source.(*gqlUserRsp); ok {
-				if projects, err := service.Instance().AllProjectsByUser(
-					&model.User{
-						ID:    service.Instance().CreateModelIDFromString(user.ID),
-						Email: user.Email,
-					}); err != nil {
-					return gqlProjectListRsp{}, err
-				} else {
-					return gqlProjectListFromModel(projects), nil
-				}
+				id := service.Instance().CreateModelIDFromString(user.ID)
+				return loadProjectList(loaders(p).projectsByOwner, id), nil
 			}
 
 			return nil, nil
@@ -208,48 +345,169 @@ func GetSchema() (*graphql.Schema, error) {
 	})
 
 	ProjectType.AddFieldConfig("customer", &graphql.Field{
-		Type: CustomerType,
+		Type:        CustomerType,
+		Description: "Customer of the project, null when the customer was deleted with the set-null delete rule.",
 		Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
-			if project, ok := p.Source.(*gqlProjectRsp); ok {
-				utils.LoggerObj().Info(project.CustomerID.ToString())
-				utils.LoggerObj().Info(project.OwnerID.ToString())
-				if customer, err := service.Instance().GetCustomerByID(project.CustomerID); err != nil {
-					return nil, err
-				} else {
-					return gqlCustomerFromModel(customer), nil
-				}
+			if project, ok := p.Source.(*gqlProjectRsp); ok && project.CustomerID != nil {
+				load := loaders(p).customers.Load(project.CustomerID)
+				return func() (interface{}, error) {
+					if customer, err := load(); err != nil {
+						return nil, err
+					} else {
+						return gqlCustomerFromModel(customer.(*model.Customer)), nil
+					}
+				}, nil
 			}
 
 			return nil, nil
 		},
 	})
 
+	// Input and payload types
+
+	UpdateProjectInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateProjectInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id": &graphql.InputObjectFieldConfig{
+				Type:        &graphql.NonNull{OfType: graphql.ID},
+				Description: "ID of the project to update.",
+			},
+			"version": &graphql.InputObjectFieldConfig{
+				Type: &graphql.NonNull{OfType: graphql.Int},
+				Description: "Version of the project the changes were made on. If the project was updated since, " +
+					"nothing is changed and a CONFLICT error with the current project is returned.",
+			},
+			"name": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "New project name. If it is omitted the current name is kept.",
+			},
+			"description": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "New project description. If it is omitted the current description is kept.",
+			},
+			"owner_id": &graphql.InputObjectFieldConfig{
+				Type: graphql.ID,
+				Description: "New owner of the project. If it is omitted the current owner is kept. " +
+					"Only admins can change it.",
+			},
+			"customer_id": &graphql.InputObjectFieldConfig{
+				Type:        graphql.ID,
+				Description: "New customer linked to the project. If it is omitted the current customer is kept.",
+			},
+			"fields": &graphql.InputObjectFieldConfig{
+				Type: &graphql.List{OfType: &graphql.NonNull{OfType: ProjectFieldInputType}},
+				Description: "New custom fields of the project. They replace every field defined in the project. If " +
+					"it is omitted the current fields are kept.",
+			},
+			"fieldValues": &graphql.InputObjectFieldConfig{
+				Type:        &graphql.List{OfType: &graphql.NonNull{OfType: ProjectFieldValueInputType}},
+				Description: "New values of custom fields already defined in the project.",
+			},
+		},
+		Description: "Values to update in a project. Only the fields sent are changed.",
+	})
+
+	UpdateCustomerInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateCustomerInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id": &graphql.InputObjectFieldConfig{
+				Type:        &graphql.NonNull{OfType: graphql.ID},
+				Description: "ID of the customer to update.",
+			},
+			"version": &graphql.InputObjectFieldConfig{
+				Type: &graphql.NonNull{OfType: graphql.Int},
+				Description: "Version of the customer the changes were made on. If the customer was updated since, " +
+					"nothing is changed and a CONFLICT error with the current customer is returned.",
+			},
+			"name": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "New customer name. If it is omitted the current name is kept.",
+			},
+			"cuit": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "New customer CUIT. If it is omitted the current CUIT is kept.",
+			},
+		},
+		Description: "Values to update in a customer. Only the fields sent are changed.",
+	})
+
+	DeletePayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeletePayload",
+		Fields: graphql.Fields{
+			"deletedIds": &graphql.Field{
+				Type: &graphql.List{OfType: graphql.ID},
+			},
+			"count": &graphql.Field{
+				Type: graphql.Int,
+			},
+		},
+		Description: "Result of a delete mutation.",
+	})
+
+	AuthPayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuthPayload",
+		Fields: graphql.Fields{
+			"token": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Access token. Send it in the Authorization header as \"Bearer <token>\".",
+			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"user": &graphql.Field{
+				Type: UserType,
+			},
+		},
+		Description: "Result of a successful login.",
+	})
+
+	UserConnectionType := newConnectionType("User", UserType)
+	ProjectConnectionType := newConnectionType("Project", ProjectType)
+	CustomerConnectionType := newConnectionType("Customer", CustomerType)
+
+	auditLogField := newAuditTypes(UserType, ProjectType, CustomerType)
+
 	// Queries
 	var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 		Name: "RootQueries",
 		Fields: graphql.Fields{
+			"auditLog": auditLogField,
 			"allUsers": &graphql.Field{
 				Type: &graphql.List{OfType: UserType},
 				Args: graphql.FieldConfigArgument{
 					"start_pos": &graphql.ArgumentConfig{
 						Type:         &graphql.NonNull{OfType: graphql.Int},
 						DefaultValue: 0,
-						Description:  "",
+						Description:  "Position of the first user returned. Prefer usersConnection for large collections.",
 					},
 					"offset": &graphql.ArgumentConfig{
 						Type:         &graphql.NonNull{OfType: graphql.Int},
 						DefaultValue: 0,
-						Description: `Number of users per page. By default, the number is 0. If 0 is passed, then all 
+						Description: `Despite its name, this is the number of users per page. By default, the number is 0. If 0 is passed, then all 
 users will be returned. If a positive number is passed, then the amount of users returned will be less or equal than
 the offset.`,
 					},
+					"filter": &graphql.ArgumentConfig{
+						Type: UserFilterType,
+					},
+					"orderBy": &graphql.ArgumentConfig{
+						Type: UserOrderByType,
+					},
+					"includeDeleted": includeDeletedArg("users"),
 				},
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 					var startPos, offset int
 					startPos, _ = p.Args["start_pos"].(int)
 					offset, _ = p.Args["offset"].(int)
 
-					result, err := service.Instance().AllUsers(startPos, offset)
+					ctx, err := readContext(p)
+					if err != nil {
+						return nil, err
+					}
+
+					result, err := service.Instance().AllUsers(
+						ctx,
+						userFilterFromArgs(p.Args), orderByFromArgs(p.Args), startPos, offset)
 
 					if err != nil {
 						return nil, err
@@ -260,9 +518,21 @@ the offset.`,
 			},
 			"allCustomers": &graphql.Field{
 				Type: &graphql.List{OfType: CustomerType},
-				Args: nil,
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{
+						Type: CustomerFilterType,
+					},
+					"orderBy": &graphql.ArgumentConfig{
+						Type: CustomerOrderByType,
+					},
+					"includeDeleted": includeDeletedArg("customers"),
+				},
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
-					if customers, err := service.Instance().AllCustomers(); err != nil {
+					if ctx, err := readContext(p); err != nil {
+						return nil, err
+					} else if customers, err := service.Instance().AllCustomers(
+						ctx,
+						customerFilterFromArgs(p.Args), orderByFromArgs(p.Args)); err != nil {
 						return nil, err
 					} else {
 						return gqlCustomerListFromModel(customers), nil
@@ -275,22 +545,51 @@ the offset.`,
 					"start_pos": &graphql.ArgumentConfig{
 						Type:         &graphql.NonNull{OfType: graphql.Int},
 						DefaultValue: 0,
-						Description:  "",
+						Description:  "Position of the first project returned. Prefer projectsConnection for large collections.",
 					},
 					"offset": &graphql.ArgumentConfig{
 						Type:         &graphql.NonNull{OfType: graphql.Int},
 						DefaultValue: 0,
-						Description: `Number of projects per page. By default, the number is 0. If 0 is passed, then all 
+						Description: `Despite its name, this is the number of projects per page. By default, the number is 0. If 0 is passed, then all 
 projects will be returned. If a positive number is passed, then the amount of projects returned will be less or equal than
 the offset.`,
 					},
+					"mine": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: false,
+						Description:  "Return only the projects owned by the authenticated user.",
+					},
+					"filter": &graphql.ArgumentConfig{
+						Type: ProjectFilterType,
+					},
+					"orderBy": &graphql.ArgumentConfig{
+						Type: ProjectOrderByType,
+					},
+					"includeDeleted": includeDeletedArg("projects"),
 				},
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 					var startPos, offset int
 					startPos, _ = p.Args["start_pos"].(int)
 					offset, _ = p.Args["offset"].(int)
 
-					if projects, err := service.Instance().AllProjects(startPos, offset); err != nil {
+					filter := projectFilterFromArgs(p.Args)
+					if mine, _ := p.Args["mine"].(bool); mine {
+						if currentUser(p) == nil {
+							return nil, newGqlError(UNAUTHENTICATED_ERROR_CODE, "authentication required", nil)
+						} else if filter == nil {
+							filter = &model.ProjectFilter{}
+						}
+						filter.OwnerID = currentUser(p).ID
+					}
+
+					ctx, err := readContext(p)
+					if err != nil {
+						return nil, err
+					}
+
+					if projects, err := service.Instance().AllProjects(
+						ctx,
+						filter, orderByFromArgs(p.Args), startPos, offset); err != nil {
 						return make(gqlProjectListRsp, 0), err
 					} else {
 						gqlProjects := gqlProjectListFromModel(projects)
@@ -298,6 +597,92 @@ the offset.`,
 					}
 				},
 			},
+			"usersConnection": &graphql.Field{
+				Type:        UserConnectionType,
+				Args:        connectionArgs(),
+				Description: "Users ordered by creation, paginated with cursors.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, err := pageRequestFromArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+
+					users, pageInfo, err := service.Instance().UsersPage(p.Context, page)
+					if err != nil {
+						return nil, err
+					}
+
+					var nodes []interface{}
+					var ids model.IDList
+					for _, user := range users {
+						nodes = append(nodes, gqlUserFromModel(user))
+						ids = append(ids, user.ID)
+					}
+
+					return newGqlConnection(nodes, ids, pageInfo, service.Instance().CountUsers), nil
+				},
+			},
+			"projectsConnection": &graphql.Field{
+				Type:        ProjectConnectionType,
+				Args:        connectionArgs(),
+				Description: "Projects ordered by creation, paginated with cursors.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, err := pageRequestFromArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+
+					projects, pageInfo, err := service.Instance().ProjectsPage(p.Context, page)
+					if err != nil {
+						return nil, err
+					}
+
+					var nodes []interface{}
+					var ids model.IDList
+					for _, project := range projects {
+						nodes = append(nodes, gqlProjectFromModel(project))
+						ids = append(ids, project.ID)
+					}
+
+					return newGqlConnection(nodes, ids, pageInfo, service.Instance().CountProjects), nil
+				},
+			},
+			"customersConnection": &graphql.Field{
+				Type:        CustomerConnectionType,
+				Args:        connectionArgs(),
+				Description: "Customers ordered by creation, paginated with cursors.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, err := pageRequestFromArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+
+					customers, pageInfo, err := service.Instance().CustomersPage(p.Context, page)
+					if err != nil {
+						return nil, err
+					}
+
+					var nodes []interface{}
+					var ids model.IDList
+					for _, customer := range customers {
+						nodes = append(nodes, gqlCustomerFromModel(customer))
+						ids = append(ids, customer.ID)
+					}
+
+					return newGqlConnection(nodes, ids, pageInfo, service.Instance().CountCustomers), nil
+				},
+			},
+			"me": &graphql.Field{
+				Type:        UserType,
+				Description: "The user authenticated by the access token of the request.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if user := currentUser(p); user != nil {
+						return gqlUserFromModel(user), nil
+					}
+
+					return nil, nil
+				},
+			},
 			"getUserByID": &graphql.Field{
 				Type: UserType,
 				Args: graphql.FieldConfigArgument{
@@ -309,6 +694,7 @@ the offset.`,
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 					if id, ok := p.Args["id"].(string); ok {
 						if user, err := service.Instance().GetUser(
+							p.Context,
 							&model.User{ID: service.Instance().CreateModelIDFromString(id)}); err != nil {
 							return nil, err
 						} else {
@@ -329,6 +715,7 @@ the offset.`,
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 					if email, ok := p.Args["email"].(string); ok {
 						if user, err := service.Instance().GetUser(
+							p.Context,
 							&model.User{Email: email}); err != nil {
 							return nil, err
 						} else {
@@ -344,10 +731,16 @@ the offset.`,
 					"id": &graphql.ArgumentConfig{
 						Type: &graphql.NonNull{OfType: graphql.ID},
 					},
+					"includeDeleted": includeDeletedArg("customer"),
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ctx, err := readContext(p)
+					if err != nil {
+						return nil, err
+					}
+
 					if id, ok := p.Args["id"].(string); ok {
-						if customer, err := service.Instance().GetCustomerByID(service.Instance().CreateModelIDFromString(id)); err != nil {
+						if customer, err := service.Instance().GetCustomerByID(ctx, service.Instance().CreateModelIDFromString(id)); err != nil {
 							return nil, err
 						} else {
 							return gqlCustomerFromModel(customer), nil
@@ -362,10 +755,16 @@ the offset.`,
 					"id": &graphql.ArgumentConfig{
 						Type: &graphql.NonNull{OfType: graphql.ID},
 					},
+					"includeDeleted": includeDeletedArg("project"),
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ctx, err := readContext(p)
+					if err != nil {
+						return nil, err
+					}
+
 					if id, ok := p.Args["id"].(string); ok {
-						if project, err := service.Instance().GetProjectByID(service.Instance().CreateModelIDFromString(id)); err != nil {
+						if project, err := service.Instance().GetProjectByID(ctx, service.Instance().CreateModelIDFromString(id)); err != nil {
 							return nil, err
 						} else {
 							return gqlProjectFromModel(project), nil
@@ -397,7 +796,7 @@ the offset.`,
 					},
 				},
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
-					user, err := service.Instance().RegisterUser(&model.User{
+					user, err := service.Instance().RegisterUser(p.Context, &model.User{
 						Name:     p.Args["name"].(string),
 						LastName: p.Args["lastName"].(string),
 						Email:    p.Args["email"].(string),
@@ -412,6 +811,56 @@ the offset.`,
 				Description: "Register a new user in the system by email. If the user already exists and error will" +
 					" be raised.",
 			},
+			"requestLoginCode": &graphql.Field{
+				Type: graphql.Boolean,
+				Args: graphql.FieldConfigArgument{
+					"email": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.String},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					email, _ := p.Args["email"].(string)
+					if email == "" {
+						return nil, badUserInputError("email", "email cannot be empty")
+					}
+
+					if err := service.Instance().RequestLoginCode(p.Context, email); err == auth.ErrTooManyLoginCodes {
+						return nil, newGqlError(TOO_MANY_REQUESTS_ERROR_CODE, err.Error(), nil)
+					} else if err != nil {
+						return nil, serviceError(err)
+					}
+
+					return true, nil
+				},
+				Description: "Send a one-time login code to the email of a registered user.",
+			},
+			"login": &graphql.Field{
+				Type: AuthPayloadType,
+				Args: graphql.FieldConfigArgument{
+					"email": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.String},
+					},
+					"code": &graphql.ArgumentConfig{
+						Type:        &graphql.NonNull{OfType: graphql.String},
+						Description: "One-time code received by email.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					email, _ := p.Args["email"].(string)
+					code, _ := p.Args["code"].(string)
+
+					if user, expiresAt, err := service.Instance().Login(p.Context, email, code); err != nil {
+						return nil, newGqlError(UNAUTHENTICATED_ERROR_CODE, err.Error(), nil)
+					} else {
+						return &gqlAuthPayloadRsp{
+							Token:     user.Token,
+							ExpiresAt: expiresAt,
+							User:      gqlUserFromModel(user),
+						}, nil
+					}
+				},
+				Description: "Exchange a login code for a signed access token.",
+			},
 			"createProject": &graphql.Field{
 				Type: ProjectType,
 				Args: graphql.FieldConfigArgument{
@@ -424,13 +873,18 @@ the offset.`,
 						Description: "Description about the projects.",
 					},
 					"owner_id": &graphql.ArgumentConfig{
-						Type:        &graphql.NonNull{OfType: graphql.ID},
-						Description: "User ID corresponding to the project owner which is the one who created this project.",
+						Type: graphql.ID,
+						Description: "User ID corresponding to the project owner. If it is omitted the authenticated user " +
+							"becomes the owner. Only admins can create projects owned by other users.",
 					},
 					"customer_id": &graphql.ArgumentConfig{
 						Type:        &graphql.NonNull{OfType: graphql.ID},
 						Description: "CustomerID ID which represent the customer linked to this project.",
 					},
+					"fields": &graphql.ArgumentConfig{
+						Type:        &graphql.List{OfType: &graphql.NonNull{OfType: ProjectFieldInputType}},
+						Description: "Custom fields of the project.",
+					},
 				},
 				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
 					var name, description string
@@ -449,7 +903,7 @@ the offset.`,
 
 					if value, ok := p.Args["owner_id"].(string); ok {
 						ownerId = service.Instance().CreateModelIDFromString(value)
-					} else {
+					} else if currentUser(p) == nil {
 						return nil, errors.New("owner id cannot be nil")
 					}
 
@@ -457,14 +911,20 @@ the offset.`,
 						customerId = service.Instance().CreateModelIDFromString(value)
 					}
 
-					if result, err := service.Instance().CreateProject(&model.Project{
+					fields, err := projectFieldsFromArgs(p.Args["fields"])
+					if err != nil {
+						return nil, err
+					}
+
+					if result, err := service.Instance().CreateProject(p.Context, currentUser(p), &model.Project{
 						Name:        name,
 						Description: description,
 						CreatedAt:   time.Now(),
 						Owner:       &model.User{ID: ownerId},
 						Customer:    &model.Customer{ID: customerId},
+						Fields:      fields,
 					}); err != nil {
-						return nil, err
+						return nil, serviceError(err)
 					} else {
 						return gqlProjectFromModel(result), nil
 					}
@@ -495,25 +955,297 @@ the offset.`,
 						cuit = value
 					}
 
-					if result, err := service.Instance().CreateCustomer(&model.Customer{
+					if result, err := service.Instance().CreateCustomer(p.Context, currentUser(p), &model.Customer{
 						Name: name,
 						Cuit: cuit,
 					}); err != nil {
-						return nil, err
+						return nil, serviceError(err)
 					} else {
 						return gqlCustomerFromModel(result), nil
 					}
 				},
 				Description: "Create new CustomerID in the system",
 			},
+			"updateProject": &graphql.Field{
+				Type: ProjectType,
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: UpdateProjectInputType},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					input, _ := p.Args["input"].(map[string]interface{})
+					id, _ := input["id"].(string)
+
+					project, err := service.Instance().GetProjectByID(p.Context, service.Instance().CreateModelIDFromString(id))
+					if err != nil {
+						return nil, notFoundError("project", id, err)
+					}
+
+					version, _ := input["version"].(int)
+					project.Version = int64(version)
+
+					if value, ok := input["name"].(string); ok {
+						if value == "" {
+							return nil, badUserInputError("name", "name cannot be empty")
+						}
+						project.Name = value
+					}
+
+					if value, ok := input["description"].(string); ok {
+						project.Description = value
+					}
+
+					if value, ok := input["owner_id"].(string); ok {
+						project.Owner = &model.User{ID: service.Instance().CreateModelIDFromString(value)}
+					}
+
+					if value, ok := input["customer_id"].(string); ok {
+						project.Customer = &model.Customer{ID: service.Instance().CreateModelIDFromString(value)}
+					}
+
+					if value, ok := input["fields"]; ok {
+						if project.Fields, err = projectFieldsFromArgs(value); err != nil {
+							return nil, err
+						}
+					}
+
+					if err := setProjectFieldValues(project.Fields, input["fieldValues"]); err != nil {
+						return nil, err
+					}
+
+					if result, err := service.Instance().UpdateProject(p.Context, currentUser(p), project); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlProjectFromModel(result), nil
+					}
+				},
+				Description: "Update an existing project. Only the values present in the input are changed.",
+			},
+			"deleteProject": &graphql.Field{
+				Type: DeletePayloadType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.ID},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					id, _ := p.Args["id"].(string)
+					projectId := service.Instance().CreateModelIDFromString(id)
+
+					if _, err := service.Instance().GetProjectByID(p.Context, projectId); err != nil {
+						return nil, notFoundError("project", id, err)
+					} else if err := service.Instance().DeleteProject(p.Context, currentUser(p), projectId); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlDeletePayload([]string{id}), nil
+					}
+				},
+				Description: "Delete a project by id.",
+			},
+			"deleteProjects": &graphql.Field{
+				Type: DeletePayloadType,
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.ID}}},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					projects, err := service.Instance().AllProjectWhereIDIsIn(p.Context, modelIDsFromArgs(p.Args["ids"]))
+					if err != nil {
+						return nil, serviceError(err)
+					}
+
+					if err := service.Instance().DeleteProjects(p.Context, currentUser(p), projects.IDs()); err != nil {
+						return nil, serviceError(err)
+					}
+
+					return gqlDeletePayload(idStrings(projects.IDs())), nil
+				},
+				Description: "Delete several projects at once. Ids which don't exist are ignored.",
+			},
+			"restoreProject": &graphql.Field{
+				Type: ProjectType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.ID},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					id, _ := p.Args["id"].(string)
+
+					if result, err := service.Instance().RestoreProject(p.Context, currentUser(p),
+						service.Instance().CreateModelIDFromString(id)); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlProjectFromModel(result), nil
+					}
+				},
+				Description: "Restore a deleted project that was not purged yet.",
+			},
+			"updateCustomer": &graphql.Field{
+				Type: CustomerType,
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: UpdateCustomerInputType},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					input, _ := p.Args["input"].(map[string]interface{})
+					id, _ := input["id"].(string)
+
+					customer, err := service.Instance().GetCustomerByID(p.Context, service.Instance().CreateModelIDFromString(id))
+					if err != nil {
+						return nil, notFoundError("customer", id, err)
+					}
+
+					version, _ := input["version"].(int)
+					customer.Version = int64(version)
+
+					if value, ok := input["name"].(string); ok {
+						if value == "" {
+							return nil, badUserInputError("name", "name cannot be empty")
+						}
+						customer.Name = value
+					}
+
+					if value, ok := input["cuit"].(string); ok {
+						customer.Cuit = value
+					}
+
+					if result, err := service.Instance().UpdateCustomer(p.Context, currentUser(p), customer); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlCustomerFromModel(result), nil
+					}
+				},
+				Description: "Update an existing customer. Only the values present in the input are changed.",
+			},
+			"deleteCustomer": &graphql.Field{
+				Type: DeletePayloadType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.ID},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					id, _ := p.Args["id"].(string)
+					customerId := service.Instance().CreateModelIDFromString(id)
+
+					if _, err := service.Instance().GetCustomerByID(p.Context, customerId); err != nil {
+						return nil, notFoundError("customer", id, err)
+					} else if err := service.Instance().DeleteCustomer(p.Context, currentUser(p), customerId); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlDeletePayload([]string{id}), nil
+					}
+				},
+				Description: "Delete a customer by id.",
+			},
+			"deleteCustomers": &graphql.Field{
+				Type: DeletePayloadType,
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.ID}}},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					customers, err := service.Instance().AllCustomersWhereIDIsIn(p.Context, modelIDsFromArgs(p.Args["ids"]))
+					if err != nil {
+						return nil, serviceError(err)
+					}
+
+					var ids model.IDList
+					for _, customer := range customers {
+						ids = append(ids, customer.ID)
+					}
+
+					if err := service.Instance().DeleteCustomers(p.Context, currentUser(p), ids); err != nil {
+						return nil, serviceError(err)
+					}
+
+					return gqlDeletePayload(idStrings(ids)), nil
+				},
+				Description: "Delete several customers at once. Ids which don't exist are ignored.",
+			},
+			"restoreCustomer": &graphql.Field{
+				Type: CustomerType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.ID},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					id, _ := p.Args["id"].(string)
+
+					if result, err := service.Instance().RestoreCustomer(p.Context, currentUser(p),
+						service.Instance().CreateModelIDFromString(id)); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlCustomerFromModel(result), nil
+					}
+				},
+				Description: "Restore a deleted customer that was not purged yet. Only admins can do it.",
+			},
+			"deleteUser": &graphql.Field{
+				Type: DeletePayloadType,
+				Args: graphql.FieldConfigArgument{
+					"email": &graphql.ArgumentConfig{
+						Type:        &graphql.NonNull{OfType: graphql.String},
+						Description: "Email of the user to delete.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					email, _ := p.Args["email"].(string)
+
+					if user, err := service.Instance().GetUser(p.Context, &model.User{Email: email}); err != nil {
+						return nil, notFoundError("user", email, err)
+					} else if err := service.Instance().DeleteUser(p.Context, currentUser(p), user); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlDeletePayload([]string{user.ID.ToString()}), nil
+					}
+				},
+				Description: "Delete a user by email.",
+			},
+			"setUserRole": &graphql.Field{
+				Type: UserType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: graphql.ID},
+					},
+					"role": &graphql.ArgumentConfig{
+						Type: &graphql.NonNull{OfType: UserRoleType},
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (i interface{}, err error) {
+					id, _ := p.Args["id"].(string)
+					role, _ := p.Args["role"].(utils.UserRoleEnum)
+
+					if user, err := service.Instance().SetUserRole(p.Context, currentUser(p),
+						service.Instance().CreateModelIDFromString(id), role); err != nil {
+						return nil, serviceError(err)
+					} else {
+						return gqlUserFromModel(user), nil
+					}
+				},
+				Description: "Change the role of a user. Only admins can do it.",
+			},
 		},
 		Description: "Mutations definitions for Picnic GraphQL API.",
 	})
 
+	requireAuthentication(rootQuery)
+	requireAuthentication(rootMutation, "registerUser", "requestLoginCode", "login")
+
+	// Subscriptions
+	rootSubscription := newSubscriptionType(ProjectType, CustomerType)
+
 	// Schema
 	schema, err := graphql.NewSchema(graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: rootMutation,
+		Query:        rootQuery,
+		Mutation:     rootMutation,
+		Subscription: rootSubscription,
 	})
 
 	if err != nil {
@@ -1,133 +1,258 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/freddy311082/picnic-server/service"
 	"github.com/freddy311082/picnic-server/settings"
 	"github.com/freddy311082/picnic-server/utils"
 	"github.com/friendsofgo/graphiql"
 	"github.com/go-chi/chi"
+	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
 	"github.com/rs/cors"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type reqBody struct {
 	Query         string                 `json:"query"`
 	Variables     map[string]interface{} `json:"variables"`
 	OperationName string                 `json:"operationName"`
+	Extensions    reqExtensions          `json:"extensions"`
 }
 
+// persisted returns whether the request has the hash of a persisted query, so it can come without the query.
+func (req *reqBody) persisted() bool {
+	return req.Extensions.PersistedQuery != nil
+}
+
+// toString formats the request for the log, without the values of the sensitive variables.
 func (req *reqBody) toString() string {
 	return fmt.Sprintf(`
 Query: %s
 Variables: %s
 OperationName: %s
-`, req.Query, fmt.Sprint(req.Variables), req.OperationName)
+`, req.Query, fmt.Sprint(redactVariables(req.Variables)), req.OperationName)
 }
 
+// WebServer serves the GraphQL API. Start blocks until the server is stopped and only returns an error when the
+// server cannot start. Stop waits for the in-flight requests until the context is done and then closes the services.
 type WebServer interface {
-	Start()
-	Stop()
+	Start() error
+	Stop(ctx context.Context) error
 }
 
 type gqlServerImp struct {
+	mutex      sync.Mutex
+	httpServer *http.Server
+	stopped    bool
+	schema     *graphql.Schema
+	queries    *queryCache
+	persisted  *persistedQueries
+	limits     *queryLimits
+
+	// shuttingDown is closed when the server is stopped, so the WebSocket connections, which are not tracked by
+	// the HTTP server, are closed too.
+	shuttingDown chan struct{}
 }
 
-func (server *gqlServerImp) Start() {
+func (server *gqlServerImp) Start() error {
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
 	// Init services
 	loggerObj.Info("Starting Picnic Web Server")
 	loggerObj.Info("Initiating services...")
 	if err := service.Instance().Init(); err != nil {
-		loggerObj.Error("Error starting start the server...")
+		loggerObj.Error("Error starting the server...")
 		loggerObj.Error(err.Error())
-		loggerObj.Info("Server stopped...")
+		return err
 	}
 	loggerObj.Info("Services initiated :)")
 
-	portStr := fmt.Sprintf(":%d", settings.SettingsObj().APISettings().HttpPort())
+	apiSettings := settings.SettingsObj().APISettings()
+	// the schema is built once and shared by every request
+	schema, err := GetSchema()
+	if err != nil {
+		loggerObj.Error(err.Error())
+		return err
+	}
+	server.schema = schema
+	server.queries = newQueryCache(server.schema, apiSettings.QueryCacheSize())
+	server.limits = &queryLimits{
+		schema:          server.schema,
+		maxDepth:        apiSettings.MaxQueryDepth(),
+		maxComplexity:   apiSettings.MaxQueryComplexity(),
+		defaultListSize: apiSettings.DefaultListSize(),
+		fieldCosts:      apiSettings.FieldCosts(),
+	}
+	if server.persisted, err = newPersistedQueries(apiSettings.PersistedQueries(), server.queries); err != nil {
+		loggerObj.Error(err.Error())
+		return err
+	}
+
+	portStr := fmt.Sprintf(":%d", apiSettings.HttpPort())
 	graphiqlHandler, err := graphiql.NewGraphiqlHandler("/graphql")
 
 	if err != nil {
 		loggerObj.Error(err.Error())
-		return
+		return err
 	}
 
 	router := chi.NewRouter()
+	router.Use(requestIDMiddleware)
 	router.Use(cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins: apiSettings.AllowedOrigins(),
+		AllowedHeaders: []string{
+			"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization", utils.REQUEST_ID_HEADER},
+		ExposedHeaders:   []string{utils.REQUEST_ID_HEADER},
 		AllowCredentials: true,
-		Debug:            true,
+		Debug:            settings.SettingsObj().LogLevel() == utils.LOG_LEVEL_DEBUG,
 	}).Handler)
 
 	loggerObj.Info("System settings.....")
 	router.Handle("/graphiql", graphiqlHandler)
-	router.Handle("/graphql", server.getGqlHandler())
+	router.Handle("/graphql", authMiddleware(server.getGqlHandler()))
+	router.Handle("/healthz", healthHandler())
+	router.Handle("/readyz", readyHandler())
+	if token := apiSettings.MetricsToken(); token != "" {
+		router.Handle("/metrics", metricsHandler(token))
+	}
 
 	loggerObj.Info(settings.SettingsObj().ToString())
-	http.ListenAndServe(portStr, router)
+
+	server.mutex.Lock()
+	if server.stopped {
+		server.mutex.Unlock()
+		return nil
+	}
+	server.httpServer = &http.Server{
+		Addr:         portStr,
+		Handler:      router,
+		ReadTimeout:  apiSettings.ReadTimeout(),
+		WriteTimeout: apiSettings.WriteTimeout(),
+		IdleTimeout:  apiSettings.IdleTimeout(),
+	}
+	server.shuttingDown = make(chan struct{})
+	server.httpServer.RegisterOnShutdown(func() {
+		close(server.shuttingDown)
+	})
+	httpServer := server.httpServer
+	server.mutex.Unlock()
+
+	loggerObj.Infof("Listening on %s", portStr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		loggerObj.Error(err.Error())
+		return err
+	}
+
+	return nil
 }
 
 func (server *gqlServerImp) getGqlHandler() http.Handler {
+	apiSettings := settings.SettingsObj().APISettings()
+
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		loggerObj := utils.LoggerObj()
-		if request.Body == nil {
-			const msg = "Error 400: No query data."
-			loggerObj.Error(msg)
-			http.Error(response, msg, 400)
+		if websocket.IsWebSocketUpgrade(request) {
+			server.serveSubscriptions(response, request)
 			return
 		}
 
-		loggerObj.Infof("Request from %s: ", request.RemoteAddr)
-		rBody := server.decodeRequest(request, response)
-		loggerObj.Info(rBody.toString())
-		if result, err := server.processQuery(rBody); err != nil {
-			loggerObj.Error("Error 400: ", err.Error())
-			http.Error(response, err.Error(), 400)
-		} else {
-			fmt.Fprintf(response, "%s", result)
+		loggerObj := utils.ContextLogger(request.Context())
+		mediaType := responseMediaType(request)
+
+		bodies, batch, httpErr := decodeRequest(request, apiSettings.MaxBodyBytes(), apiSettings.MaxBatchSize())
+		if httpErr != nil {
+			loggerObj.Errorf("Error %d: %s", httpErr.status, httpErr.message)
+			writeHTTPError(response, mediaType, httpErr)
+			return
 		}
 
+		results := make([]*graphql.Result, len(bodies))
+		executed := make([]bool, len(bodies))
+		for i := range bodies {
+			body := &bodies[i]
+			if gqlErr := server.persisted.resolve(request.Context(), body); gqlErr != nil {
+				results[i] = &graphql.Result{Errors: []gqlerrors.FormattedError{formatGqlError(gqlErr)}}
+				continue
+			}
+
+			operation := server.operationType(*body)
+			if request.Method == http.MethodGet && operation == ast.OperationTypeMutation {
+				writeHTTPError(response, mediaType, mutationWithGetError())
+				return
+			} else if operation == ast.OperationTypeSubscription {
+				results[i] = &graphql.Result{Errors: []gqlerrors.FormattedError{formatGqlError(newGqlError(
+					BAD_REQUEST_ERROR_CODE, "subscriptions are only served over WebSocket", nil))}}
+				continue
+			}
+
+			loggerObj.Infof("GraphQL operation %s", body.OperationName)
+			loggerObj.Debug(body.toString())
+
+			results[i], executed[i] = server.processQuery(request.Context(), *body)
+		}
+
+		if batch {
+			writeGqlResponse(response, mediaType, http.StatusOK, results)
+		} else {
+			writeGqlResponse(response, mediaType, resultStatus(mediaType, results[0], executed[0]), results[0])
+		}
 	})
 }
 
-func (server *gqlServerImp) decodeRequest(request *http.Request, response http.ResponseWriter) reqBody {
-	var rBody reqBody
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+// processQuery executes a query and records its metrics. executed is false when the query was rejected before
+// execution.
+func (server *gqlServerImp) processQuery(ctx context.Context, body reqBody) (result *graphql.Result, executed bool) {
+	start := time.Now()
+	result, executed = server.executeQuery(ctx, body)
+	recordQueryMetrics(body.OperationName, start, result, executed)
+	return result, executed
+}
 
-	if err := json.NewDecoder(request.Body).Decode(&rBody); err != nil {
-		const msg = "Error parsing JSON request body"
-		loggerObj.Error(msg)
-		http.Error(response, msg, 400)
+// executeQuery runs a query like graphql.Do, but takes the parsed query from the cache and rejects the queries over
+// the depth and complexity limits. executed is false when the query was rejected before execution.
+func (server *gqlServerImp) executeQuery(ctx context.Context, body reqBody) (result *graphql.Result, executed bool) {
+	query := server.queries.parse(body.Query)
+	if len(query.errors) > 0 {
+		return &graphql.Result{Errors: query.errors}, false
+	} else if gqlErr := server.limits.check(query.document, body); gqlErr != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{formatGqlError(gqlErr)}}, false
 	}
-	return rBody
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        *server.schema,
+		AST:           query.document,
+		OperationName: body.OperationName,
+		Args:          body.Variables,
+		Context:       withLoaders(ctx),
+	}), true
 }
 
-func (server *gqlServerImp) processQuery(body reqBody) (string, error) {
-	schema, err := GetSchema()
+func (server *gqlServerImp) Stop(ctx context.Context) error {
+	loggerObj := utils.LoggerObj()
 
-	if err != nil {
-		return "", err
-	}
+	server.mutex.Lock()
+	server.stopped = true
+	httpServer := server.httpServer
+	server.mutex.Unlock()
 
-	gqlParams := graphql.Params{
-		Schema:         *schema,
-		RequestString:  body.Query,
-		VariableValues: body.Variables,
-		OperationName:  body.OperationName,
+	var err error
+	if httpServer != nil {
+		loggerObj.Info("Waiting for the in-flight requests...")
+		// Shutdown stops accepting connections and returns when every active request was answered.
+		if err = httpServer.Shutdown(ctx); err != nil {
+			loggerObj.Error(err.Error())
+		}
 	}
 
-	result := graphql.Do(gqlParams)
-	responseJSON, _ := json.Marshal(result)
-	return fmt.Sprintf("%s", responseJSON), nil
-}
-
-func (server *gqlServerImp) Stop() {
+	if closeErr := service.Instance().Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
 
+	return err
 }
 
 func WebServerInstance() WebServer {
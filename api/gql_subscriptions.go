@@ -0,0 +1,212 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Subscriptions are executed once for every event of the service that matches them, with the event as the root
+// value. The filter arguments of the subscriptions are compared with the entity of the event before executing them.
+
+// subscriptionEvents are the events received by every field of the subscription root.
+var subscriptionEvents = map[string]map[utils.EventTypeEnum]bool{
+	"projectCreated": {utils.EVENT_PROJECT_CREATED: true},
+	"projectUpdated": {utils.EVENT_PROJECT_UPDATED: true},
+	"projectDeleted": {utils.EVENT_PROJECT_DELETED: true},
+	"customerChanged": {
+		utils.EVENT_CUSTOMER_CREATED: true,
+		utils.EVENT_CUSTOMER_UPDATED: true,
+		utils.EVENT_CUSTOMER_DELETED: true,
+	},
+}
+
+type gqlCustomerChangeRsp struct {
+	Kind     utils.EventTypeEnum
+	Customer *gqlCustomerRsp
+}
+
+func newSubscriptionType(ProjectType, CustomerType *graphql.Object) *graphql.Object {
+	CustomerChangeKindType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "CustomerChangeKind",
+		Values: graphql.EnumValueConfigMap{
+			"CREATED": &graphql.EnumValueConfig{Value: utils.EventTypeEnum(utils.EVENT_CUSTOMER_CREATED)},
+			"UPDATED": &graphql.EnumValueConfig{Value: utils.EventTypeEnum(utils.EVENT_CUSTOMER_UPDATED)},
+			"DELETED": &graphql.EnumValueConfig{Value: utils.EventTypeEnum(utils.EVENT_CUSTOMER_DELETED)},
+		},
+	})
+
+	CustomerChangeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CustomerChange",
+		Fields: graphql.Fields{
+			"kind": &graphql.Field{
+				Type: CustomerChangeKindType,
+			},
+			"customer": &graphql.Field{
+				Type:        CustomerType,
+				Description: "Customer after the change. Deleted customers are sent as they were before being deleted.",
+			},
+		},
+		Description: "Customer created, updated or deleted.",
+	})
+
+	projectFilterArgs := func() graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{
+				Type:        graphql.ID,
+				Description: "Only receive the changes of this project.",
+			},
+			"ownerId": &graphql.ArgumentConfig{
+				Type:        graphql.ID,
+				Description: "Only receive the changes of the projects of this owner.",
+			},
+			"customerId": &graphql.ArgumentConfig{
+				Type:        graphql.ID,
+				Description: "Only receive the changes of the projects of this customer.",
+			},
+		}
+	}
+
+	resolveProject := func(p graphql.ResolveParams) (interface{}, error) {
+		if event, ok := p.Source.(service.Event); ok && event.Project != nil {
+			return gqlProjectFromModel(event.Project), nil
+		}
+
+		return nil, nil
+	}
+
+	rootSubscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "RootSubscriptions",
+		Fields: graphql.Fields{
+			"projectCreated": &graphql.Field{
+				Type:        ProjectType,
+				Args:        projectFilterArgs(),
+				Resolve:     resolveProject,
+				Description: "Projects created or restored from now on.",
+			},
+			"projectUpdated": &graphql.Field{
+				Type:        ProjectType,
+				Args:        projectFilterArgs(),
+				Resolve:     resolveProject,
+				Description: "Projects updated from now on. The filters are compared with the values after the change.",
+			},
+			"projectDeleted": &graphql.Field{
+				Type:        ProjectType,
+				Args:        projectFilterArgs(),
+				Resolve:     resolveProject,
+				Description: "Projects deleted from now on, as they were before being deleted.",
+			},
+			"customerChanged": &graphql.Field{
+				Type: CustomerChangeType,
+				Args: graphql.FieldConfigArgument{
+					"customerId": &graphql.ArgumentConfig{
+						Type:        graphql.ID,
+						Description: "Only receive the changes of this customer.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if event, ok := p.Source.(service.Event); ok && event.Customer != nil {
+						return &gqlCustomerChangeRsp{
+							Kind:     event.Type,
+							Customer: gqlCustomerFromModel(event.Customer),
+						}, nil
+					}
+
+					return nil, nil
+				},
+				Description: "Customers created, updated, deleted or restored from now on. Restored customers are sent as created.",
+			},
+		},
+		Description: "Subscriptions served over WebSocket with the graphql-ws protocol.",
+	})
+
+	requireAuthentication(rootSubscription)
+	return rootSubscription
+}
+
+// subscriptionRequest is the field selected by a subscription, with the values of its filter arguments.
+type subscriptionRequest struct {
+	field     string
+	arguments map[string]string
+}
+
+// newSubscriptionRequest reads the field of a subscription already validated against the schema.
+func newSubscriptionRequest(document *ast.Document, body reqBody) (*subscriptionRequest, *gqlError) {
+	operation := selectOperation(document, body.OperationName)
+	if operation == nil || operation.Operation != ast.OperationTypeSubscription {
+		return nil, newGqlError(BAD_REQUEST_ERROR_CODE, "the operation is not a subscription", nil)
+	} else if len(operation.SelectionSet.Selections) != 1 {
+		return nil, newGqlError(BAD_REQUEST_ERROR_CODE, "a subscription must select exactly one field", nil)
+	}
+
+	field, ok := operation.SelectionSet.Selections[0].(*ast.Field)
+	if !ok {
+		return nil, newGqlError(BAD_REQUEST_ERROR_CODE, "the field of a subscription cannot be a fragment", nil)
+	}
+
+	defaults := map[string]ast.Value{}
+	for _, variable := range operation.VariableDefinitions {
+		if variable.DefaultValue != nil {
+			defaults[variable.Variable.Name.Value] = variable.DefaultValue
+		}
+	}
+
+	result := &subscriptionRequest{field: field.Name.Value, arguments: map[string]string{}}
+	for _, argument := range field.Arguments {
+		if value := argumentString(argument.Value, body.Variables, defaults); value != "" {
+			result.arguments[argument.Name.Value] = value
+		}
+	}
+
+	return result, nil
+}
+
+// argumentString returns the value of an ID argument, which can be written as a string or as a number.
+func argumentString(value ast.Value, variables map[string]interface{}, defaults map[string]ast.Value) string {
+	switch value := value.(type) {
+	case *ast.StringValue:
+		return value.Value
+	case *ast.IntValue:
+		return value.Value
+	case *ast.Variable:
+		switch variable := variables[value.Name.Value].(type) {
+		case string:
+			return variable
+		case float64:
+			return strconv.FormatFloat(variable, 'f', -1, 64)
+		case nil:
+			if defaultValue, ok := defaults[value.Name.Value]; ok {
+				return argumentString(defaultValue, variables, nil)
+			}
+		}
+	}
+
+	return ""
+}
+
+// matches returns whether the event is received by the subscription.
+func (subscription *subscriptionRequest) matches(event service.Event) bool {
+	if !subscriptionEvents[subscription.field][event.Type] {
+		return false
+	}
+
+	if project := event.Project; project != nil {
+		return subscription.matchesID("id", project.ID) &&
+			subscription.matchesID("ownerId", project.OwnerID()) &&
+			subscription.matchesID("customerId", project.CustomerID())
+	} else if customer := event.Customer; customer != nil {
+		return subscription.matchesID("customerId", customer.ID)
+	}
+
+	return false
+}
+
+// matchesID returns whether the id is the one of the filter argument, or the argument was not set.
+func (subscription *subscriptionRequest) matchesID(argument string, id model.ID) bool {
+	filter, ok := subscription.arguments[argument]
+	return !ok || (id != nil && filter == id.ToString())
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func testSubscription(t *testing.T, query string, variables map[string]interface{}) *subscriptionRequest {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscription, gqlErr := newSubscriptionRequest(document, reqBody{Query: query, Variables: variables})
+	if gqlErr != nil {
+		t.Fatal(gqlErr)
+	}
+
+	return subscription
+}
+
+func TestSubscriptionsMatchTheirFilters(t *testing.T) {
+	project := &model.Project{
+		ID:       testId("1"),
+		Owner:    &model.User{ID: testId("2")},
+		Customer: &model.Customer{ID: testId("3")},
+	}
+	created := service.Event{Type: utils.EVENT_PROJECT_CREATED, Project: project}
+	customerUpdated := service.Event{Type: utils.EVENT_CUSTOMER_UPDATED, Customer: &model.Customer{ID: testId("3")}}
+
+	tests := []struct {
+		query     string
+		variables map[string]interface{}
+		event     service.Event
+		matches   bool
+	}{
+		{"subscription { projectCreated { id } }", nil, created, true},
+		{"subscription { projectUpdated { id } }", nil, created, false},
+		{`subscription { projectCreated(ownerId: "2") { id } }`, nil, created, true},
+		{`subscription { projectCreated(ownerId: "3") { id } }`, nil, created, false},
+		{"subscription ($customer: ID) { projectCreated(customerId: $customer) { id } }",
+			map[string]interface{}{"customer": "3"}, created, true},
+		{`subscription ($customer: ID = "4") { projectCreated(customerId: $customer) { id } }`, nil, created, false},
+		{"subscription { customerChanged { kind } }", nil, customerUpdated, true},
+		{`subscription { customerChanged(customerId: 4) { kind } }`, nil, customerUpdated, false},
+	}
+
+	for _, test := range tests {
+		if matches := testSubscription(t, test.query, test.variables).matches(test.event); matches != test.matches {
+			t.Errorf("%s: expected %v, received %v", test.query, test.matches, matches)
+		}
+	}
+}
+
+func TestSubscriptionsSelectOneField(t *testing.T) {
+	for _, query := range []string{
+		"{ me { id } }",
+		"subscription { projectCreated { id } projectDeleted { id } }",
+		"subscription { ...created } fragment created on RootSubscriptions { projectCreated { id } }",
+	} {
+		document, _ := parser.Parse(parser.ParseParams{Source: query})
+		if _, err := newSubscriptionRequest(document, reqBody{Query: query}); err == nil {
+			t.Error("The subscription was accepted: ", query)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freddy311082/picnic-server/auth"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// The graphql-ws protocol of subscriptions-transport-ws
+// (https://github.com/apollographql/subscriptions-transport-ws/blob/master/PROTOCOL.md), served on /graphql to the
+// WebSocket connections that request it.
+const graphqlWsProtocol = "graphql-ws"
+
+// Messages of the graphql-ws protocol.
+const (
+	wsConnectionInit      = "connection_init"
+	wsConnectionAck       = "connection_ack"
+	wsConnectionError     = "connection_error"
+	wsConnectionKeepAlive = "ka"
+	wsConnectionTerminate = "connection_terminate"
+	wsStart               = "start"
+	wsData                = "data"
+	wsError               = "error"
+	wsComplete            = "complete"
+	wsStop                = "stop"
+)
+
+// wsInitTimeout is how long a connection can be open without sending connection_init.
+const wsInitTimeout = 10 * time.Second
+
+// wsWriteTimeout is how long a message can take to be written before the connection is closed.
+const wsWriteTimeout = 10 * time.Second
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConnection is a WebSocket connection of the graphql-ws protocol. The messages are read by serve, and every
+// operation started by the client runs in its own goroutine until it is stopped or the connection is closed.
+type wsConnection struct {
+	server *gqlServerImp
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	operations map[string]context.CancelFunc
+}
+
+// serveSubscriptions upgrades the request to a WebSocket connection of the graphql-ws protocol and serves it until
+// the client closes it or the server is stopped.
+func (server *gqlServerImp) serveSubscriptions(response http.ResponseWriter, request *http.Request) {
+	apiSettings := settings.SettingsObj().APISettings()
+	loggerObj := utils.ContextLogger(request.Context())
+
+	if !requestsProtocol(request, graphqlWsProtocol) {
+		writeHTTPError(response, jsonMediaType,
+			newHTTPError(http.StatusBadRequest, "the WebSocket connection must use the %s protocol", graphqlWsProtocol))
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{graphqlWsProtocol},
+		CheckOrigin: func(request *http.Request) bool {
+			return allowedOrigin(request.Header.Get("Origin"), apiSettings.AllowedOrigins())
+		},
+	}
+
+	conn, err := upgrader.Upgrade(response, request, nil)
+	if err != nil {
+		// the upgrader already answered the request
+		loggerObj.Error("cannot open WebSocket connection: ", err.Error())
+		return
+	}
+	conn.SetReadLimit(int64(apiSettings.MaxBodyBytes()))
+
+	connection := &wsConnection{server: server, conn: conn, operations: map[string]context.CancelFunc{}}
+	connection.ctx, connection.cancel = context.WithCancel(request.Context())
+	defer connection.close()
+
+	go connection.closeOnShutdown(server.shuttingDown, connection.ctx.Done())
+	connection.serve(apiSettings.SubscriptionKeepAlive())
+}
+
+func requestsProtocol(request *http.Request, protocol string) bool {
+	for _, requested := range websocket.Subprotocols(request) {
+		if requested == protocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedOrigin returns whether a browser of the origin can open WebSocket connections. The clients that are not
+// browsers do not send the origin.
+func allowedOrigin(origin string, allowedOrigins []string) bool {
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (connection *wsConnection) closeOnShutdown(shuttingDown, done <-chan struct{}) {
+	select {
+	case <-shuttingDown:
+		connection.close()
+	case <-done:
+	}
+}
+
+// close stops every operation and closes the connection. It can be called more than once.
+func (connection *wsConnection) close() {
+	connection.cancel()
+
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	connection.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteTimeout))
+	connection.conn.Close()
+}
+
+func (connection *wsConnection) serve(keepAlive time.Duration) {
+	loggerObj := utils.ContextLogger(connection.ctx)
+
+	connection.conn.SetReadDeadline(time.Now().Add(wsInitTimeout))
+	var init wsMessage
+	if err := connection.conn.ReadJSON(&init); err != nil || init.Type != wsConnectionInit {
+		loggerObj.Error("WebSocket connection closed without connection_init")
+		return
+	} else if err = connection.init(init.Payload); err != nil {
+		loggerObj.Errorf("Rejected WebSocket connection: %s", err.Error())
+		connection.write(wsMessage{Type: wsConnectionError, Payload: errorPayload(err.Error())})
+		return
+	}
+	connection.conn.SetReadDeadline(time.Time{})
+
+	connection.write(wsMessage{Type: wsConnectionAck})
+	connection.write(wsMessage{Type: wsConnectionKeepAlive})
+	go connection.keepAlive(keepAlive)
+
+	for {
+		var message wsMessage
+		if err := connection.conn.ReadJSON(&message); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) &&
+				connection.ctx.Err() == nil {
+				loggerObj.Error("WebSocket connection closed: ", err.Error())
+			}
+			return
+		}
+
+		switch message.Type {
+		case wsStart:
+			connection.start(message.ID, message.Payload)
+		case wsStop:
+			connection.stop(message.ID)
+		case wsConnectionTerminate:
+			return
+		default:
+			connection.write(wsMessage{ID: message.ID, Type: wsError,
+				Payload: errorPayload("unknown message type " + message.Type)})
+		}
+	}
+}
+
+var errWsAuthenticationRequired = errors.New("authentication required")
+
+// init authenticates the connection with the token sent in the payload of connection_init, as browsers cannot send
+// the Authorization header in WebSocket requests. The user of the header, if any, is kept otherwise. Anonymous
+// connections are rejected when authentication is required.
+func (connection *wsConnection) init(payload json.RawMessage) error {
+	var params map[string]interface{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &params); err != nil {
+			return err
+		}
+	}
+
+	token, _ := params["authToken"].(string)
+	if header, ok := params["Authorization"].(string); ok && strings.HasPrefix(header, bearerPrefix) {
+		token = strings.TrimPrefix(header, bearerPrefix)
+	}
+
+	if token == "" {
+		if auth.UserFromContext(connection.ctx) == nil && settings.SettingsObj().AuthSettings().Required() {
+			return errWsAuthenticationRequired
+		}
+		return nil
+	}
+
+	user, err := service.Instance().Authenticate(connection.ctx, strings.TrimSpace(token))
+	if err != nil {
+		return err
+	}
+
+	connection.ctx = auth.WithUser(connection.ctx, user)
+	return nil
+}
+
+func (connection *wsConnection) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			connection.write(wsMessage{Type: wsConnectionKeepAlive})
+		case <-connection.ctx.Done():
+			return
+		}
+	}
+}
+
+// start runs an operation. Subscriptions send their results until they are stopped, queries and mutations send a
+// single result.
+func (connection *wsConnection) start(id string, payload json.RawMessage) {
+	server := connection.server
+	loggerObj := utils.ContextLogger(connection.ctx)
+
+	var body reqBody
+	if err := json.Unmarshal(payload, &body); err != nil {
+		connection.writeErrors(id, formatGqlError(newGqlError(BAD_REQUEST_ERROR_CODE, err.Error(), nil)))
+		return
+	} else if gqlErr := server.persisted.resolve(connection.ctx, &body); gqlErr != nil {
+		connection.writeErrors(id, formatGqlError(gqlErr))
+		return
+	}
+
+	loggerObj.Infof("GraphQL operation %s over WebSocket", body.OperationName)
+	loggerObj.Debug(body.toString())
+
+	query := server.queries.parse(body.Query)
+	if len(query.errors) > 0 {
+		connection.writeErrors(id, query.errors...)
+		return
+	} else if gqlErr := server.limits.check(query.document, body); gqlErr != nil {
+		connection.writeErrors(id, formatGqlError(gqlErr))
+		return
+	}
+
+	if operation := selectOperation(query.document, body.OperationName); operation == nil ||
+		operation.Operation != ast.OperationTypeSubscription {
+		result, _ := server.processQuery(connection.ctx, body)
+		connection.write(wsMessage{ID: id, Type: wsData, Payload: jsonPayload(result)})
+		connection.write(wsMessage{ID: id, Type: wsComplete})
+		return
+	}
+
+	subscription, gqlErr := newSubscriptionRequest(query.document, body)
+	if gqlErr != nil {
+		connection.writeErrors(id, formatGqlError(gqlErr))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(connection.ctx)
+	connection.mutex.Lock()
+	if stop, ok := connection.operations[id]; ok {
+		// the client reuses the id of an operation that is still running
+		stop()
+	}
+	connection.operations[id] = cancel
+	connection.mutex.Unlock()
+
+	events := service.Instance().Subscribe(ctx)
+	go connection.subscribe(ctx, id, query.document, body, subscription, events)
+}
+
+// subscribe executes the subscription for every event that matches it, until the operation is stopped.
+func (connection *wsConnection) subscribe(
+	ctx context.Context,
+	id string,
+	document *ast.Document,
+	body reqBody,
+	subscription *subscriptionRequest,
+	events <-chan service.Event) {
+
+	for event := range events {
+		if ctx.Err() != nil || !subscription.matches(event) {
+			// the events still buffered when the operation is stopped are discarded
+			continue
+		}
+
+		start := time.Now()
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        *connection.server.schema,
+			Root:          event,
+			AST:           document,
+			OperationName: body.OperationName,
+			Args:          body.Variables,
+			Context:       withLoaders(ctx),
+		})
+		recordQueryMetrics(body.OperationName, start, result, true)
+
+		connection.write(wsMessage{ID: id, Type: wsData, Payload: jsonPayload(result)})
+	}
+
+	if connection.ctx.Err() == nil {
+		connection.write(wsMessage{ID: id, Type: wsComplete})
+	}
+}
+
+func (connection *wsConnection) stop(id string) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if stop, ok := connection.operations[id]; ok {
+		stop()
+		delete(connection.operations, id)
+	}
+}
+
+// write sends a message. The connection is closed when the client does not read it in time.
+func (connection *wsConnection) write(message wsMessage) {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+
+	connection.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := connection.conn.WriteJSON(message); err != nil {
+		loggerObj := utils.ContextLogger(connection.ctx)
+		loggerObj.Error("cannot write WebSocket message: ", err.Error())
+		connection.cancel()
+		connection.conn.Close()
+	}
+}
+
+// writeErrors sends the errors of an operation that could not be executed.
+func (connection *wsConnection) writeErrors(id string, errors ...gqlerrors.FormattedError) {
+	connection.write(wsMessage{ID: id, Type: wsError, Payload: jsonPayload(errors)})
+}
+
+func errorPayload(message string) json.RawMessage {
+	return jsonPayload(map[string]interface{}{"message": message})
+}
+
+func jsonPayload(value interface{}) json.RawMessage {
+	payload, _ := json.Marshal(value)
+	return payload
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/gorilla/websocket"
+)
+
+func TestAnonymousWebSocketConnectionsAreRejected(t *testing.T) {
+	server := testServer(t)
+	if !settings.SettingsObj().AuthSettings().Required() {
+		t.Skip("authentication is not required in settings.json")
+	}
+
+	httpServer := httptest.NewServer(authMiddleware(server.getGqlHandler()))
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlWsProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.WriteJSON(wsMessage{Type: wsConnectionInit}); err != nil {
+		t.Fatal(err)
+	}
+
+	var message wsMessage
+	if err = conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	} else if message.Type != wsConnectionError || !strings.Contains(string(message.Payload), "authentication required") {
+		t.Errorf("Expected a connection_error. Value received: %s %s", message.Type, message.Payload)
+	}
+
+	if err = conn.ReadJSON(&message); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Error("The connection was not closed after the connection_error: ", err)
+	}
+}
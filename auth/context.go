@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// WithUser returns a copy of ctx holding the authenticated user of the request.
+func WithUser(ctx context.Context, user *model.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user of the request, or nil if the request is anonymous.
+func UserFromContext(ctx context.Context) *model.User {
+	if ctx == nil {
+		return nil
+	}
+
+	user, _ := ctx.Value(userContextKey).(*model.User)
+	return user
+}
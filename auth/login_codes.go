@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+const loginCodeDigits = 6
+const maxLoginCodeAttempts = 5
+const maxLoginCodeRequests = 5
+
+var ErrInvalidLoginCode = errors.New("invalid or expired login code")
+var ErrTooManyLoginCodes = errors.New("too many login codes requested. Try again later")
+
+// loginCode is the last code generated for an email. The codes requested and the failed attempts are counted from the
+// first code of the window, which lasts the ttl of a code, so a new code does not give more attempts.
+type loginCode struct {
+	hash      [sha256.Size]byte
+	expiresAt time.Time
+	windowEnd time.Time
+	requests  int
+	attempts  int
+}
+
+// LoginCodes keeps the one-time codes sent by email until they are used or they expire. A new code for the same
+// email replaces the previous one. Each email can request maxLoginCodeRequests codes and fail maxLoginCodeAttempts
+// times in the ttl of a code, after which no code is generated nor accepted until the ttl ends.
+type LoginCodes interface {
+	Generate(email string) (string, error)
+	Verify(email, code string) error
+}
+
+type memoryLoginCodesImp struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	codes map[string]*loginCode
+	now   func() time.Time
+}
+
+func (loginCodes *memoryLoginCodesImp) Generate(email string) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < loginCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	number, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	code := fmt.Sprintf("%0*d", loginCodeDigits, number)
+
+	loginCodes.mutex.Lock()
+	defer loginCodes.mutex.Unlock()
+
+	loginCodes.removeExpired()
+
+	now := loginCodes.now()
+	key := model.NormalizeEmail(email)
+	stored, ok := loginCodes.codes[key]
+	if !ok || !now.Before(stored.windowEnd) {
+		stored = &loginCode{windowEnd: now.Add(loginCodes.ttl)}
+		loginCodes.codes[key] = stored
+	} else if stored.requests >= maxLoginCodeRequests || stored.attempts >= maxLoginCodeAttempts {
+		return "", ErrTooManyLoginCodes
+	}
+
+	stored.hash = sha256.Sum256([]byte(code))
+	stored.expiresAt = now.Add(loginCodes.ttl)
+	stored.requests++
+	return code, nil
+}
+
+func (loginCodes *memoryLoginCodesImp) Verify(email, code string) error {
+	loginCodes.mutex.Lock()
+	defer loginCodes.mutex.Unlock()
+
+	key := model.NormalizeEmail(email)
+	stored, ok := loginCodes.codes[key]
+	if !ok || !loginCodes.now().Before(stored.expiresAt) || stored.attempts >= maxLoginCodeAttempts {
+		return ErrInvalidLoginCode
+	}
+
+	hash := sha256.Sum256([]byte(code))
+	if subtle.ConstantTimeCompare(hash[:], stored.hash[:]) != 1 {
+		stored.attempts++
+		return ErrInvalidLoginCode
+	}
+
+	delete(loginCodes.codes, key)
+	return nil
+}
+
+func (loginCodes *memoryLoginCodesImp) removeExpired() {
+	now := loginCodes.now()
+	for email, code := range loginCodes.codes {
+		if !now.Before(code.expiresAt) && !now.Before(code.windowEnd) {
+			delete(loginCodes.codes, email)
+		}
+	}
+}
+
+func NewLoginCodes(ttl time.Duration) LoginCodes {
+	return &memoryLoginCodesImp{
+		ttl:   ttl,
+		codes: map[string]*loginCode{},
+		now:   time.Now,
+	}
+}
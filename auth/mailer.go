@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// Mailer delivers the login codes to the users. The default implementation only writes the message to the log,
+// which is enough for local development. Use SetMailer to plug a real delivery service.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type logMailerImp struct {
+}
+
+func (mailer *logMailerImp) Send(to, subject, body string) error {
+	loggerObj := utils.LoggerObj()
+
+	loggerObj.Infof("Mail to %s. Subject: %s. Body: %s", to, subject, body)
+	return nil
+}
+
+var mailerInstance Mailer = &logMailerImp{}
+
+func MailerObj() Mailer {
+	return mailerInstance
+}
+
+func SetMailer(mailer Mailer) {
+	mailerInstance = mailer
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid access token")
+var ErrExpiredToken = errors.New("access token expired")
+
+// Claims is the information signed inside an access token.
+type Claims struct {
+	UserID    string `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (claims *Claims) Expiration() time.Time {
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+// TokenManager issues and verifies signed, expiring access tokens. A token has the form
+// base64url(claims).base64url(HMAC-SHA256(claims)).
+type TokenManager interface {
+	Issue(userId, email string) (string, *Claims, error)
+	Verify(token string) (*Claims, error)
+}
+
+type hmacTokenManagerImp struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func (tokenManager *hmacTokenManagerImp) Issue(userId, email string) (string, *Claims, error) {
+	claims := &Claims{
+		UserID:    userId,
+		Email:     email,
+		ExpiresAt: tokenManager.now().Add(tokenManager.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + tokenManager.sign(encodedPayload), claims, nil
+}
+
+func (tokenManager *hmacTokenManagerImp) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(tokenManager.sign(parts[0]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil || claims.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if !tokenManager.now().Before(claims.Expiration()) {
+		return nil, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func (tokenManager *hmacTokenManagerImp) sign(payload string) string {
+	mac := hmac.New(sha256.New, tokenManager.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func NewTokenManager(secret string, ttl time.Duration) TokenManager {
+	return &hmacTokenManagerImp{
+		secret: []byte(secret),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIssuedTokenIsVerified(t *testing.T) {
+	tokenManager := NewTokenManager("secret", time.Hour)
+
+	token, _, err := tokenManager.Issue("5e9f1b2c3d4e5f6a7b8c9d0e", "john@picnic.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims, err := tokenManager.Verify(token); err != nil {
+		t.Error(err)
+	} else if claims.UserID != "5e9f1b2c3d4e5f6a7b8c9d0e" || claims.Email != "john@picnic.com" {
+		t.Error("Invalid claims returned.")
+	}
+}
+
+func TestTokenSignedWithAnotherSecretIsRejected(t *testing.T) {
+	token, _, _ := NewTokenManager("secret", time.Hour).Issue("5e9f1b2c3d4e5f6a7b8c9d0e", "john@picnic.com")
+
+	if _, err := NewTokenManager("another secret", time.Hour).Verify(token); err != ErrInvalidToken {
+		t.Error("A token signed with another secret must be rejected.")
+	}
+}
+
+func TestExpiredTokenIsRejected(t *testing.T) {
+	tokenManager := NewTokenManager("secret", time.Hour).(*hmacTokenManagerImp)
+	token, _, _ := tokenManager.Issue("5e9f1b2c3d4e5f6a7b8c9d0e", "john@picnic.com")
+
+	tokenManager.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := tokenManager.Verify(token); err != ErrExpiredToken {
+		t.Error("An expired token must be rejected.")
+	}
+}
+
+func TestLoginCodeCanBeUsedOnlyOnce(t *testing.T) {
+	loginCodes := NewLoginCodes(time.Minute)
+
+	code, err := loginCodes.Generate("John@Picnic.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loginCodes.Verify("john@picnic.com", code); err != nil {
+		t.Error(err)
+	}
+
+	if err := loginCodes.Verify("john@picnic.com", code); err != ErrInvalidLoginCode {
+		t.Error("A login code must be rejected after it was used.")
+	}
+}
+
+func TestLoginCodeAttemptsAreKeptForTheNewCodes(t *testing.T) {
+	loginCodes := NewLoginCodes(time.Minute)
+
+	for i := 0; i < maxLoginCodeAttempts; i++ {
+		if _, err := loginCodes.Generate("john@picnic.com"); err != nil {
+			t.Fatal(err)
+		} else if err := loginCodes.Verify("john@picnic.com", "wrong"); err != ErrInvalidLoginCode {
+			t.Fatal("A wrong code must be rejected.")
+		}
+	}
+
+	if _, err := loginCodes.Generate("john@picnic.com"); err != ErrTooManyLoginCodes {
+		t.Error("A new code cannot be generated once the attempts are exhausted.")
+	}
+}
+
+func TestLoginCodeRequestsAreLimited(t *testing.T) {
+	loginCodes := NewLoginCodes(time.Minute).(*memoryLoginCodesImp)
+	now := time.Now()
+	loginCodes.now = func() time.Time { return now }
+
+	for i := 0; i < maxLoginCodeRequests; i++ {
+		if _, err := loginCodes.Generate("john@picnic.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := loginCodes.Generate("John@Picnic.com"); err != ErrTooManyLoginCodes {
+		t.Error("The codes requested for an email must be limited.")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := loginCodes.Generate("john@picnic.com"); err != nil {
+		t.Error("A code must be generated again once the ttl ends: ", err)
+	}
+}
@@ -1,36 +1,65 @@
 package dbmanager
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
 )
 
+// ErrVersionConflict is returned by UpdateProject and UpdateCustomer when the version of the entity sent is not the
+// stored one, because it was updated since it was read. Nothing is written in that case.
+var ErrVersionConflict = errors.New("version conflict. The entity was modified since it was read")
+
 type DBManager interface {
 	Open() error
 	Close() error
 	IsOpen() bool
-	RegisterNewUser(user *model.User) (*model.User, error)
-	DeleteUser(email string) error
-	GetUserByEmail(email string) (*model.User, error)
-	GetUserByID(id model.ID) (*model.User, error)
-	AllUsers(startPosition, offset int) (model.UserList, error)
-	AllUsersWhereIDIsIn(ids model.IDList) (model.UserList, error)
-	AllProjects(startPosition, offset int) (model.ProjectList, error)
-	AllProjectFromUser(user *model.User) (model.ProjectList, error)
-	CreateProject(project *model.Project) (*model.Project, error)
-	GetProject(projectId model.ID) (*model.Project, error)
-	UpdateProject(project *model.Project) (*model.Project, error)
-	DeleteProject(projectId model.ID) error
-	DeleteProjects(ids model.IDList) error
-	AllProjectWhereIDIsIn(ids model.IDList) (model.ProjectList, error)
-	CreateCustomer(customer *model.Customer) (*model.Customer, error)
-	UpdateCustomer(customer *model.Customer) (*model.Customer, error)
-	DeleteCustomer(customerId model.ID) error
-	DeleteCustomers(ids model.IDList) error
-	AllCustomers() (model.CustomerList, error)
-	AllCustomersWhereIDIsIn(ids model.IDList) (model.CustomerList, error)
-	GetCustomerByID(customerId model.ID) (*model.Customer, error)
-	GetOwnerFromProjectID(projectId model.ID) (*model.User, error)
-	AllProjectsFromCustomer(customerId model.ID) (model.ProjectList, error)
+	Ping(ctx context.Context) error
+	RegisterNewUser(ctx context.Context, user *model.User) (*model.User, error)
+	UpdateUser(ctx context.Context, user *model.User) (*model.User, error)
+	DeleteUser(ctx context.Context, email string) error
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserByID(ctx context.Context, id model.ID) (*model.User, error)
+	AllUsers(ctx context.Context, filter *model.UserFilter, orderBy *model.OrderBy, startPosition, offset int) (model.UserList, error)
+	UsersPage(ctx context.Context, page *model.PageRequest) (model.UserList, *model.PageInfo, error)
+	CountUsers(ctx context.Context) (int64, error)
+	AllUsersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.UserList, error)
+	AllProjects(ctx context.Context, filter *model.ProjectFilter, orderBy *model.OrderBy, startPosition, offset int) (model.ProjectList, error)
+	ProjectsPage(ctx context.Context, page *model.PageRequest) (model.ProjectList, *model.PageInfo, error)
+	CountProjects(ctx context.Context) (int64, error)
+	AllProjectFromUser(ctx context.Context, user *model.User) (model.ProjectList, error)
+	CreateProject(ctx context.Context, project *model.Project) (*model.Project, error)
+	GetProject(ctx context.Context, projectId model.ID) (*model.Project, error)
+	UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error)
+	DeleteProject(ctx context.Context, projectId model.ID) error
+	DeleteProjects(ctx context.Context, ids model.IDList) error
+	AllProjectWhereIDIsIn(ctx context.Context, ids model.IDList) (model.ProjectList, error)
+	CreateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error)
+	UpdateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error)
+	DeleteCustomer(ctx context.Context, customerId model.ID) error
+	DeleteCustomers(ctx context.Context, ids model.IDList) error
+	AllCustomers(ctx context.Context, filter *model.CustomerFilter, orderBy *model.OrderBy) (model.CustomerList, error)
+	CustomersPage(ctx context.Context, page *model.PageRequest) (model.CustomerList, *model.PageInfo, error)
+	CountCustomers(ctx context.Context) (int64, error)
+	AllCustomersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.CustomerList, error)
+	GetCustomerByID(ctx context.Context, customerId model.ID) (*model.Customer, error)
+	GetOwnerFromProjectID(ctx context.Context, projectId model.ID) (*model.User, error)
+	AllProjectsFromCustomer(ctx context.Context, customerId model.ID) (model.ProjectList, error)
+	AllProjectsFromCustomers(ctx context.Context, customerIds model.IDList) (model.ProjectList, error)
+	AllProjectsFromUsers(ctx context.Context, userIds model.IDList) (model.ProjectList, error)
+	GetPersistedQuery(ctx context.Context, hash string) (string, error)
+	SavePersistedQuery(ctx context.Context, hash, query string) error
+	AddAuditEntry(ctx context.Context, entry *model.AuditEntry) error
+	AuditLog(ctx context.Context, filter *model.AuditFilter) (model.AuditEntryList, error)
+	RestoreProject(ctx context.Context, projectId model.ID) (*model.Project, error)
+	RestoreCustomer(ctx context.Context, customerId model.ID) (*model.Customer, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+	RefreshCustomerProjects(ctx context.Context, customerIds model.IDList) error
+	MergeUsers(ctx context.Context, keptId model.ID, duplicateIds model.IDList, email string) (model.ProjectList, error)
 }
 
 var dbManagerInstance DBManager
@@ -41,7 +70,12 @@ func Instance() DBManager {
 
 	go func() {
 		if dbManagerInstance == nil {
-			dbManagerInstance = createMongoDbManager()
+			switch settings.SettingsObj().DBSettingsValues().DriverType() {
+			case utils.DBType_MEMORY:
+				dbManagerInstance = createMemoryDbManager(deleteRulesFromSettings())
+			default:
+				dbManagerInstance = createMongoDbManager()
+			}
 		}
 
 		ch <- dbManagerInstance
@@ -49,3 +83,12 @@ func Instance() DBManager {
 
 	return <-ch
 }
+
+// SetInstance replaces the database returned by Instance and returns the previous one, which lets the tests give the
+// services data that cannot be written through a DBManager anymore. With nil, Instance creates a new database from
+// the settings.
+func SetInstance(dbManager DBManager) DBManager {
+	previous := dbManagerInstance
+	dbManagerInstance = dbManager
+	return previous
+}
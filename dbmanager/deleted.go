@@ -0,0 +1,35 @@
+package dbmanager
+
+import (
+	"context"
+	"time"
+)
+
+// Deleting a user, a project or a customer only sets its deleted_at date. Every read of a DBManager excludes the
+// deleted documents, unless the context was returned by WithDeleted, and PurgeDeleted removes them permanently once
+// the retention period is over.
+
+type deletedCtxKey struct{}
+
+// WithDeleted returns a copy of ctx whose reads include the deleted users, projects and customers.
+func WithDeleted(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, deletedCtxKey{}, true)
+}
+
+func includesDeleted(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	result, _ := ctx.Value(deletedCtxKey{}).(bool)
+	return result
+}
+
+// visible returns whether a document deleted at deletedAt is read with the context.
+func visible(ctx context.Context, deletedAt time.Time) bool {
+	return deletedAt.IsZero() || includesDeleted(ctx)
+}
@@ -0,0 +1,1254 @@
+package dbmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// sortableTimeFormat formats dates so they are sorted chronologically when compared as strings.
+const sortableTimeFormat = "2006-01-02T15:04:05.000000000"
+
+type memId struct {
+	id string
+}
+
+func (memIdObj *memId) ToString() string {
+	return memIdObj.id
+}
+
+// memoryDbManagerImp is a DBManager implementation that keeps every collection in process maps. It follows the
+// same rules as mongodbManagerImp and it is meant for tests and local development only: nothing is persisted.
+type memoryDbManagerImp struct {
+	mutex     sync.RWMutex
+	isOpen    bool
+	lastId    uint64
+	users     map[string]*model.User
+	projects  map[string]*model.Project
+	customers map[string]*model.Customer
+	queries   map[string]string
+	auditLog  model.AuditEntryList
+	rules     deleteRules
+
+	// insertion order of every collection, used to page the results the same way MongoDB natural order does.
+	userIds     []string
+	projectIds  []string
+	customerIds []string
+}
+
+func (dbManager *memoryDbManagerImp) Open() error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	dbManager.isOpen = true
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) Close() error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	dbManager.isOpen = false
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) Ping(ctx context.Context) error {
+	if !dbManager.IsOpen() {
+		return errors.New("database is not open")
+	}
+
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) IsOpen() bool {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	return dbManager.isOpen
+}
+
+func (dbManager *memoryDbManagerImp) RegisterNewUser(ctx context.Context, user *model.User) (*model.User, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	user.Email = model.NormalizeEmail(user.Email)
+	if dbManager.findUserByEmail(user.Email) != nil {
+		msg := fmt.Sprintf("User %s already exists.", user.Email)
+		return nil, dbManager.logError(ctx, msg)
+	}
+
+	userDb := copyUser(user)
+	userDb.ID = dbManager.newId()
+	dbManager.users[userDb.ID.ToString()] = userDb
+	dbManager.userIds = append(dbManager.userIds, userDb.ID.ToString())
+
+	user.ID = userDb.ID
+	return user, nil
+}
+
+func (dbManager *memoryDbManagerImp) UpdateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if user == nil || user.ID == nil {
+		return nil, dbManager.logError(ctx, "invalid user. Neither user object nor user ID can be NULL")
+	}
+
+	if stored, ok := dbManager.users[user.ID.ToString()]; !ok || !stored.DeletedAt.IsZero() {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("nothing to update. User (%s) not found", user.ID.ToString()))
+	}
+
+	user.Email = model.NormalizeEmail(user.Email)
+	if existing := dbManager.findUserByEmail(user.Email); existing != nil && existing.ID.ToString() != user.ID.ToString() {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("User %s already exists.", user.Email))
+	}
+
+	userDb := copyUser(user)
+	userDb.ID = &memId{id: user.ID.ToString()}
+	dbManager.users[userDb.ID.ToString()] = userDb
+
+	return user, nil
+}
+
+func (dbManager *memoryDbManagerImp) DeleteUser(ctx context.Context, email string) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	user := dbManager.findUserByEmail(email)
+	if user == nil || !user.DeletedAt.IsZero() {
+		return nil
+	}
+
+	projectIds := dbManager.referencingProjects(user.ID, (*model.Project).OwnerID)
+	if err := dbManager.checkDeleteRule(ctx, dbManager.rules.ownerProjects, "user", user.ID, projectIds); err != nil {
+		return err
+	}
+
+	user.DeletedAt = time.Now().UTC()
+	dbManager.applyDeleteRule(dbManager.rules.ownerProjects, projectIds, user.DeletedAt, func(project *model.Project) {
+		project.Owner = nil
+	})
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if user := dbManager.findUserByEmail(email); user != nil && visible(ctx, user.DeletedAt) {
+		return copyUser(user), nil
+	}
+
+	return nil, dbManager.logError(ctx, fmt.Sprintf("user %s not found", email))
+}
+
+func (dbManager *memoryDbManagerImp) GetUserByID(ctx context.Context, id model.ID) (*model.User, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if id == nil {
+		return nil, dbManager.logError(ctx, "user id cannot be null")
+	}
+
+	if user, ok := dbManager.users[id.ToString()]; ok && visible(ctx, user.DeletedAt) {
+		return copyUser(user), nil
+	}
+
+	return nil, dbManager.logError(ctx, fmt.Sprintf("user id %s not found", id.ToString()))
+}
+
+func (dbManager *memoryDbManagerImp) AllUsers(
+	ctx context.Context,
+	filter *model.UserFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.UserList, error) {
+
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if startPosition < 0 {
+		return nil, dbManager.logError(ctx, "start position cannot be zero or a negative number")
+	}
+
+	var ids []string
+	for _, id := range dbManager.visibleUserIds(ctx) {
+		if user := dbManager.users[id]; filter == nil ||
+			containsFold(filter.Search, user.Name, user.LastName, user.Email) {
+			ids = append(ids, id)
+		}
+	}
+
+	ids, err := dbManager.sortIds(ctx, ids, orderBy, userSortFields, func(id, field string) string {
+		user := dbManager.users[id]
+		switch field {
+		case utils.USER_NAME_FIELD:
+			return user.Name
+		case utils.USER_LASTNAME_FIELD:
+			return user.LastName
+		case utils.USER_EMAIL_FIELD:
+			return user.Email
+		}
+		return id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.UserList
+	for _, id := range page(ids, startPosition, offset) {
+		result = append(result, copyUser(dbManager.users[id]))
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) UsersPage(ctx context.Context, page *model.PageRequest) (model.UserList, *model.PageInfo, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	ids, pageInfo := keysetPage(dbManager.visibleUserIds(ctx), page)
+
+	result := model.UserList{}
+	for _, id := range ids {
+		result = append(result, copyUser(dbManager.users[id]))
+	}
+
+	return result, pageInfo, nil
+}
+
+func (dbManager *memoryDbManagerImp) CountUsers(ctx context.Context) (int64, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	return int64(len(dbManager.visibleUserIds(ctx))), nil
+}
+
+func (dbManager *memoryDbManagerImp) AllUsersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.UserList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	var result model.UserList
+	for _, id := range ids {
+		if user, ok := dbManager.users[id.ToString()]; ok && visible(ctx, user.DeletedAt) {
+			result = append(result, copyUser(user))
+		}
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) AllProjects(
+	ctx context.Context,
+	filter *model.ProjectFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.ProjectList, error) {
+
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if startPosition < 0 {
+		return nil, dbManager.logError(ctx, "start position cannot be zero or a negative number")
+	}
+
+	var ids []string
+	for _, id := range dbManager.visibleProjectIds(ctx) {
+		if matchesProject(dbManager.projects[id], filter) {
+			ids = append(ids, id)
+		}
+	}
+
+	ids, err := dbManager.sortIds(ctx, ids, orderBy, projectSortFields, func(id, field string) string {
+		project := dbManager.projects[id]
+		switch field {
+		case utils.PROJECT_NAME_FIELD:
+			return project.Name
+		case utils.PROJECT_CREATED_AT_FIELD:
+			return project.CreatedAt.UTC().Format(sortableTimeFormat)
+		}
+		return id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.ProjectList
+	for _, id := range page(ids, startPosition, offset) {
+		result = append(result, copyProject(dbManager.projects[id]))
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) ProjectsPage(ctx context.Context, page *model.PageRequest) (model.ProjectList, *model.PageInfo, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	ids, pageInfo := keysetPage(dbManager.visibleProjectIds(ctx), page)
+
+	result := model.ProjectList{}
+	for _, id := range ids {
+		result = append(result, copyProject(dbManager.projects[id]))
+	}
+
+	return result, pageInfo, nil
+}
+
+func (dbManager *memoryDbManagerImp) CountProjects(ctx context.Context) (int64, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	return int64(len(dbManager.visibleProjectIds(ctx))), nil
+}
+
+func (dbManager *memoryDbManagerImp) AllProjectFromUser(ctx context.Context, user *model.User) (model.ProjectList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	var ownerId string
+	if user.ID != nil {
+		ownerId = user.ID.ToString()
+	} else if owner := dbManager.findUserByEmail(user.Email); owner != nil {
+		ownerId = owner.ID.ToString()
+	} else {
+		return model.ProjectList{}, dbManager.logError(ctx, fmt.Sprintf("user %s not found", user.Email))
+	}
+
+	return dbManager.filterProjects(ctx, func(project *model.Project) bool {
+		return idString(project.OwnerID()) == ownerId
+	}), nil
+}
+
+func (dbManager *memoryDbManagerImp) CreateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if project.OwnerID() == nil {
+		return nil, dbManager.logError(ctx, "invalid project. Owner ID cannot be NULL")
+	} else if project.CustomerID() == nil {
+		return nil, dbManager.logError(ctx, "invalid project. Customer ID cannot be NULL")
+	} else if err := dbManager.validateProjectRefs(ctx, project, nil); err != nil {
+		return nil, err
+	}
+
+	projectDb := copyProject(project)
+	projectDb.ID = dbManager.newId()
+	projectDb.Version = 1
+	dbManager.projects[projectDb.ID.ToString()] = projectDb
+	dbManager.projectIds = append(dbManager.projectIds, projectDb.ID.ToString())
+	dbManager.refreshCustomerProjects(projectDb.CustomerID())
+
+	project.ID, project.Version = projectDb.ID, projectDb.Version
+	return project, nil
+}
+
+func (dbManager *memoryDbManagerImp) GetProject(ctx context.Context, projectId model.ID) (*model.Project, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if projectId == nil {
+		return nil, dbManager.logError(ctx, "project id cannot be null")
+	}
+
+	if project, ok := dbManager.projects[projectId.ToString()]; ok && visible(ctx, project.DeletedAt) {
+		return copyProject(project), nil
+	}
+
+	return nil, dbManager.logError(ctx, fmt.Sprintf("project id %s not found", projectId.ToString()))
+}
+
+func (dbManager *memoryDbManagerImp) UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if project == nil || project.ID == nil {
+		return nil, dbManager.logError(ctx, "invalid project. Neither project object nor project ID can be NULL")
+	}
+
+	stored, ok := dbManager.projects[project.ID.ToString()]
+	if !ok || !stored.DeletedAt.IsZero() {
+		msg := fmt.Sprintf("Nothing to update. Project (%s) not found.", project.ID.ToString())
+		return nil, dbManager.logError(ctx, msg)
+	} else if stored.Version != project.Version {
+		utils.ContextLogger(ctx).Error(ErrVersionConflict)
+		return nil, ErrVersionConflict
+	} else if err := dbManager.validateProjectRefs(ctx, project, stored); err != nil {
+		return nil, err
+	}
+
+	projectDb := copyProject(project)
+	projectDb.ID = &memId{id: project.ID.ToString()}
+	projectDb.Version = stored.Version + 1
+	dbManager.projects[projectDb.ID.ToString()] = projectDb
+	dbManager.refreshCustomerProjects(stored.CustomerID(), projectDb.CustomerID())
+
+	project.Version = projectDb.Version
+	return project, nil
+}
+
+func (dbManager *memoryDbManagerImp) DeleteProject(ctx context.Context, projectId model.ID) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if projectId == nil {
+		return dbManager.logError(ctx, "project id cannot be null")
+	} else if project, ok := dbManager.projects[projectId.ToString()]; !ok || !project.DeletedAt.IsZero() {
+		return dbManager.logError(ctx, fmt.Sprintf("project id %s not found", projectId.ToString()))
+	}
+
+	dbManager.deleteProject(projectId.ToString(), time.Now().UTC())
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) DeleteProjects(ctx context.Context, ids model.IDList) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	deletedAt := time.Now().UTC()
+	for _, id := range ids {
+		dbManager.deleteProject(id.ToString(), deletedAt)
+	}
+
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) AllProjectWhereIDIsIn(ctx context.Context, ids model.IDList) (model.ProjectList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	var result model.ProjectList
+	for _, id := range ids {
+		if project, ok := dbManager.projects[id.ToString()]; ok && visible(ctx, project.DeletedAt) {
+			result = append(result, copyProject(project))
+		}
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) CreateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	customerDb := copyCustomer(customer)
+	customerDb.ID = dbManager.newId()
+	customerDb.Version = 1
+	// the project list is kept by the writes of the projects
+	customerDb.Projects = model.ProjectList{}
+	dbManager.customers[customerDb.ID.ToString()] = customerDb
+	dbManager.customerIds = append(dbManager.customerIds, customerDb.ID.ToString())
+
+	customer.ID, customer.Version = customerDb.ID, customerDb.Version
+	return customer, nil
+}
+
+func (dbManager *memoryDbManagerImp) UpdateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if customer.ID == nil {
+		return nil, dbManager.logError(ctx, "nothing to update. CustomerID cannot be null")
+	}
+
+	stored, ok := dbManager.customers[customer.ID.ToString()]
+	if !ok || !stored.DeletedAt.IsZero() {
+		msg := fmt.Sprintf("nothing to update. CustomerID (%s) was not found", customer.ID.ToString())
+		return nil, dbManager.logError(ctx, msg)
+	} else if stored.Version != customer.Version {
+		utils.ContextLogger(ctx).Error(ErrVersionConflict)
+		return nil, ErrVersionConflict
+	}
+
+	customerDb := copyCustomer(customer)
+	customerDb.ID = &memId{id: customer.ID.ToString()}
+	customerDb.Version = stored.Version + 1
+	customerDb.Projects = stored.Projects
+	dbManager.customers[customerDb.ID.ToString()] = customerDb
+
+	customer.Version, customer.Projects = customerDb.Version, copyCustomer(customerDb).Projects
+	return customer, nil
+}
+
+func (dbManager *memoryDbManagerImp) DeleteCustomer(ctx context.Context, customerId model.ID) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if customerId == nil {
+		return dbManager.logError(ctx, "customer id cannot be null")
+	} else if customer, ok := dbManager.customers[customerId.ToString()]; !ok || !customer.DeletedAt.IsZero() {
+		return dbManager.logError(ctx, fmt.Sprintf("customer id %s not found", customerId.ToString()))
+	}
+
+	projectIds := dbManager.referencingProjects(customerId, (*model.Project).CustomerID)
+	if err := dbManager.checkDeleteRule(ctx, dbManager.rules.customerProjects, "customer", customerId, projectIds); err != nil {
+		return err
+	}
+
+	dbManager.deleteCustomer(customerId.ToString(), projectIds, time.Now().UTC())
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) DeleteCustomers(ctx context.Context, ids model.IDList) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	// every customer is checked before deleting any of them, so a restricted customer leaves the others untouched
+	references := map[string][]string{}
+	for _, id := range ids {
+		if customer, ok := dbManager.customers[id.ToString()]; ok && customer.DeletedAt.IsZero() {
+			projectIds := dbManager.referencingProjects(id, (*model.Project).CustomerID)
+			if err := dbManager.checkDeleteRule(ctx, dbManager.rules.customerProjects, "customer", id, projectIds); err != nil {
+				return err
+			}
+			references[id.ToString()] = projectIds
+		}
+	}
+
+	deletedAt := time.Now().UTC()
+	for _, id := range ids {
+		dbManager.deleteCustomer(id.ToString(), references[id.ToString()], deletedAt)
+	}
+
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) AllCustomers(
+	ctx context.Context,
+	filter *model.CustomerFilter,
+	orderBy *model.OrderBy) (model.CustomerList, error) {
+
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	var ids []string
+	for _, id := range dbManager.visibleCustomerIds(ctx) {
+		if customer := dbManager.customers[id]; filter == nil ||
+			containsFold(filter.Search, customer.Name, customer.Cuit) {
+			ids = append(ids, id)
+		}
+	}
+
+	ids, err := dbManager.sortIds(ctx, ids, orderBy, customerSortFields, func(id, field string) string {
+		customer := dbManager.customers[id]
+		switch field {
+		case utils.CUSTOMER_NAME_FIELD:
+			return customer.Name
+		case utils.CUSTOMER_CUIT_FIELD:
+			return customer.Cuit
+		}
+		return id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.CustomerList
+	for _, id := range ids {
+		result = append(result, copyCustomer(dbManager.customers[id]))
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) CustomersPage(ctx context.Context, page *model.PageRequest) (model.CustomerList, *model.PageInfo, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	ids, pageInfo := keysetPage(dbManager.visibleCustomerIds(ctx), page)
+
+	result := model.CustomerList{}
+	for _, id := range ids {
+		result = append(result, copyCustomer(dbManager.customers[id]))
+	}
+
+	return result, pageInfo, nil
+}
+
+func (dbManager *memoryDbManagerImp) CountCustomers(ctx context.Context) (int64, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	return int64(len(dbManager.visibleCustomerIds(ctx))), nil
+}
+
+func (dbManager *memoryDbManagerImp) AllCustomersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.CustomerList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	var result model.CustomerList
+	for _, id := range ids {
+		if customer, ok := dbManager.customers[id.ToString()]; ok && visible(ctx, customer.DeletedAt) {
+			result = append(result, copyCustomer(customer))
+		}
+	}
+
+	return result, nil
+}
+
+func (dbManager *memoryDbManagerImp) GetCustomerByID(ctx context.Context, customerId model.ID) (*model.Customer, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if customerId == nil {
+		return nil, dbManager.logError(ctx, "customer id cannot be null")
+	}
+
+	if customer, ok := dbManager.customers[customerId.ToString()]; ok && visible(ctx, customer.DeletedAt) {
+		return copyCustomer(customer), nil
+	}
+
+	return nil, dbManager.logError(ctx, fmt.Sprintf("customer id %s not found", customerId.ToString()))
+}
+
+func (dbManager *memoryDbManagerImp) GetOwnerFromProjectID(ctx context.Context, projectId model.ID) (*model.User, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if projectId == nil {
+		return nil, dbManager.logError(ctx, "project id cannot be null")
+	}
+
+	project, ok := dbManager.projects[projectId.ToString()]
+	if !ok || !visible(ctx, project.DeletedAt) {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("project id %s not found", projectId.ToString()))
+	}
+
+	if owner, ok := dbManager.users[idString(project.OwnerID())]; ok && visible(ctx, owner.DeletedAt) {
+		return copyUser(owner), nil
+	}
+
+	return nil, dbManager.logError(ctx, fmt.Sprintf("owner of project %s not found", projectId.ToString()))
+}
+
+func (dbManager *memoryDbManagerImp) AllProjectsFromCustomers(ctx context.Context, customerIds model.IDList) (model.ProjectList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	ids := idSet(customerIds)
+	return dbManager.filterProjects(ctx, func(project *model.Project) bool {
+		return ids[idString(project.CustomerID())]
+	}), nil
+}
+
+func (dbManager *memoryDbManagerImp) AllProjectsFromUsers(ctx context.Context, userIds model.IDList) (model.ProjectList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	ids := idSet(userIds)
+	return dbManager.filterProjects(ctx, func(project *model.Project) bool {
+		return ids[idString(project.OwnerID())]
+	}), nil
+}
+
+func (dbManager *memoryDbManagerImp) AllProjectsFromCustomer(ctx context.Context, customerId model.ID) (model.ProjectList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if customerId == nil {
+		return nil, dbManager.logError(ctx, "customer id cannot be null")
+	}
+
+	return dbManager.filterProjects(ctx, func(project *model.Project) bool {
+		return idString(project.CustomerID()) == customerId.ToString()
+	}), nil
+}
+
+func (dbManager *memoryDbManagerImp) GetPersistedQuery(ctx context.Context, hash string) (string, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	return dbManager.queries[hash], nil
+}
+
+func (dbManager *memoryDbManagerImp) SavePersistedQuery(ctx context.Context, hash, query string) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if _, ok := dbManager.queries[hash]; !ok {
+		dbManager.queries[hash] = query
+	}
+
+	return nil
+}
+
+// AddAuditEntry appends the entry to the audit log. The entries are never modified nor deleted.
+func (dbManager *memoryDbManagerImp) AddAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	entryDb := *entry
+	entryDb.ID = dbManager.newId()
+	entryDb.Changes = append([]model.AuditChange{}, entry.Changes...)
+	dbManager.auditLog = append(dbManager.auditLog, &entryDb)
+
+	entry.ID = entryDb.ID
+	return nil
+}
+
+// AuditLog returns the entries of the filter in chronological order.
+func (dbManager *memoryDbManagerImp) AuditLog(ctx context.Context, filter *model.AuditFilter) (model.AuditEntryList, error) {
+	dbManager.mutex.RLock()
+	defer dbManager.mutex.RUnlock()
+
+	if filter == nil {
+		filter = &model.AuditFilter{}
+	}
+
+	entityIds := idSet(filter.EntityIDs)
+	result := model.AuditEntryList{}
+	for _, entry := range dbManager.auditLog {
+		if matchesAuditEntry(entry, filter, entityIds) {
+			copied := *entry
+			copied.Changes = append([]model.AuditChange{}, entry.Changes...)
+			result = append(result, &copied)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+// RestoreProject clears the deleted date of a deleted project and returns it.
+func (dbManager *memoryDbManagerImp) RestoreProject(ctx context.Context, projectId model.ID) (*model.Project, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if projectId == nil {
+		return nil, dbManager.logError(ctx, "project id cannot be null")
+	}
+
+	project, ok := dbManager.projects[projectId.ToString()]
+	if !ok || project.DeletedAt.IsZero() {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("deleted project id %s not found", projectId.ToString()))
+	} else if err := dbManager.validateProjectRefs(ctx, project, nil); err != nil {
+		return nil, err
+	}
+
+	project.DeletedAt = time.Time{}
+	dbManager.refreshCustomerProjects(project.CustomerID())
+	return copyProject(project), nil
+}
+
+// RestoreCustomer clears the deleted date of a deleted customer and returns it. The projects deleted with the customer
+// by the cascade delete rule are restored too, unless their owner is deleted.
+func (dbManager *memoryDbManagerImp) RestoreCustomer(ctx context.Context, customerId model.ID) (*model.Customer, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if customerId == nil {
+		return nil, dbManager.logError(ctx, "customer id cannot be null")
+	}
+
+	customer, ok := dbManager.customers[customerId.ToString()]
+	if !ok || customer.DeletedAt.IsZero() {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("deleted customer id %s not found", customerId.ToString()))
+	}
+
+	for _, id := range dbManager.projectIds {
+		if project := dbManager.projects[id]; project.DeletedAt.Equal(customer.DeletedAt) &&
+			idString(project.CustomerID()) == customerId.ToString() && dbManager.validUser(project.OwnerID()) {
+			project.DeletedAt = time.Time{}
+		}
+	}
+
+	customer.DeletedAt = time.Time{}
+	dbManager.refreshCustomerProjects(customer.ID)
+	return copyCustomer(customer), nil
+}
+
+// PurgeDeleted removes permanently the users, projects and customers deleted before the date, and returns how many
+// were removed.
+func (dbManager *memoryDbManagerImp) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	var count int64
+	userIds := []string{}
+	for _, id := range dbManager.userIds {
+		if purged(dbManager.users[id].DeletedAt, deletedBefore) {
+			delete(dbManager.users, id)
+			count++
+		} else {
+			userIds = append(userIds, id)
+		}
+	}
+
+	projectIds := []string{}
+	for _, id := range dbManager.projectIds {
+		if purged(dbManager.projects[id].DeletedAt, deletedBefore) {
+			delete(dbManager.projects, id)
+			count++
+		} else {
+			projectIds = append(projectIds, id)
+		}
+	}
+
+	customerIds := []string{}
+	for _, id := range dbManager.customerIds {
+		if purged(dbManager.customers[id].DeletedAt, deletedBefore) {
+			delete(dbManager.customers, id)
+			count++
+		} else {
+			customerIds = append(customerIds, id)
+		}
+	}
+
+	dbManager.userIds, dbManager.projectIds, dbManager.customerIds = userIds, projectIds, customerIds
+	return count, nil
+}
+
+// RefreshCustomerProjects rebuilds the project list of the customers from the projects that reference them and are
+// not deleted.
+func (dbManager *memoryDbManagerImp) RefreshCustomerProjects(ctx context.Context, customerIds model.IDList) error {
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	dbManager.refreshCustomerProjects(customerIds...)
+	return nil
+}
+
+func (dbManager *memoryDbManagerImp) newId() model.ID {
+	dbManager.lastId++
+	// same length and alphabet as a MongoDB ObjectID, so ids can be used interchangeably by the upper layers.
+	return &memId{id: fmt.Sprintf("%024x", dbManager.lastId)}
+}
+
+// MergeUsers moves the projects of the duplicates to the user kept, deletes the duplicates and writes email in the
+// user kept. Nothing is written when it fails. It returns the projects moved as they were before the move.
+func (dbManager *memoryDbManagerImp) MergeUsers(
+	ctx context.Context,
+	keptId model.ID,
+	duplicateIds model.IDList,
+	email string) (model.ProjectList, error) {
+
+	dbManager.mutex.Lock()
+	defer dbManager.mutex.Unlock()
+
+	if keptId == nil || !dbManager.validUser(keptId) {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("user id %s not found", idString(keptId)))
+	}
+
+	duplicates := idSet(duplicateIds)
+	for _, id := range duplicateIds {
+		if id == nil || !dbManager.validUser(id) {
+			return nil, dbManager.logError(ctx, fmt.Sprintf("user id %s not found", idString(id)))
+		}
+	}
+
+	if existing := dbManager.findUserByEmail(email); existing != nil &&
+		existing.ID.ToString() != keptId.ToString() && !duplicates[existing.ID.ToString()] {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("User %s already exists.", email))
+	}
+
+	moved := model.ProjectList{}
+	for _, id := range dbManager.projectIds {
+		if project := dbManager.projects[id]; project.DeletedAt.IsZero() && duplicates[idString(project.OwnerID())] {
+			moved = append(moved, copyProject(project))
+			project.Owner = &model.User{ID: &memId{id: keptId.ToString()}}
+			project.Version++
+		}
+	}
+
+	deletedAt := time.Now().UTC()
+	for _, id := range duplicateIds {
+		duplicate := dbManager.users[id.ToString()]
+		duplicate.DeletedAt = deletedAt
+		if duplicate.Email == email {
+			duplicate.Email = mergedUserEmail(email, id.ToString())
+		}
+	}
+
+	dbManager.users[keptId.ToString()].Email = email
+	return moved, nil
+}
+
+// findUserByEmail returns the user with the email, ignoring the letter case. The emails registered before they were
+// stored in lower case can still differ only in case until check --fix merges them, so the users that are not deleted
+// and then the email written exactly are preferred.
+func (dbManager *memoryDbManagerImp) findUserByEmail(email string) *model.User {
+	var result *model.User
+	resultRank := 0
+	for _, id := range dbManager.userIds {
+		user := dbManager.users[id]
+		if model.NormalizeEmail(user.Email) != model.NormalizeEmail(email) {
+			continue
+		}
+
+		rank := 1
+		if user.Email != email {
+			rank++
+		}
+		if !user.DeletedAt.IsZero() {
+			rank += 2
+		}
+
+		if result == nil || rank < resultRank {
+			result, resultRank = user, rank
+		}
+	}
+
+	return result
+}
+
+func (dbManager *memoryDbManagerImp) filterProjects(
+	ctx context.Context,
+	accept func(project *model.Project) bool) model.ProjectList {
+
+	result := model.ProjectList{}
+	for _, id := range dbManager.visibleProjectIds(ctx) {
+		if project := dbManager.projects[id]; accept(project) {
+			result = append(result, copyProject(project))
+		}
+	}
+
+	return result
+}
+
+// validateProjectRefs checks that the owner and the customer of the project exist and are not deleted. The references
+// that did not change since stored, the project before the update, are not checked again.
+func (dbManager *memoryDbManagerImp) validateProjectRefs(ctx context.Context, project, stored *model.Project) error {
+	if ownerId := project.OwnerID(); (stored == nil || idString(ownerId) != idString(stored.OwnerID())) &&
+		!dbManager.validUser(ownerId) {
+		return dbManager.logError(ctx, fmt.Sprintf("invalid project. Owner (%s) not found", idString(ownerId)))
+	}
+
+	if customerId := project.CustomerID(); (stored == nil || idString(customerId) != idString(stored.CustomerID())) &&
+		!dbManager.validCustomer(customerId) {
+		return dbManager.logError(ctx, fmt.Sprintf("invalid project. Customer (%s) not found", idString(customerId)))
+	}
+
+	return nil
+}
+
+// validUser returns whether a project can reference the user: it is nil or it exists and it is not deleted.
+func (dbManager *memoryDbManagerImp) validUser(id model.ID) bool {
+	if id == nil {
+		return true
+	}
+
+	user, ok := dbManager.users[id.ToString()]
+	return ok && user.DeletedAt.IsZero()
+}
+
+// validCustomer returns whether a project can reference the customer: it is nil or it exists and it is not deleted.
+func (dbManager *memoryDbManagerImp) validCustomer(id model.ID) bool {
+	if id == nil {
+		return true
+	}
+
+	customer, ok := dbManager.customers[id.ToString()]
+	return ok && customer.DeletedAt.IsZero()
+}
+
+// referencingProjects returns the ids of the projects that are not deleted and whose reference is id.
+func (dbManager *memoryDbManagerImp) referencingProjects(id model.ID, reference func(project *model.Project) model.ID) []string {
+	result := []string{}
+	for _, projectId := range dbManager.projectIds {
+		if project := dbManager.projects[projectId]; project.DeletedAt.IsZero() &&
+			idString(reference(project)) == id.ToString() {
+			result = append(result, projectId)
+		}
+	}
+
+	return result
+}
+
+// checkDeleteRule rejects the delete of the customer or the user when the rule is restrict and there are projects
+// that reference it.
+func (dbManager *memoryDbManagerImp) checkDeleteRule(
+	ctx context.Context,
+	rule utils.OnDeleteEnum,
+	resource string,
+	id model.ID,
+	projectIds []string) error {
+
+	if rule != utils.ON_DELETE_RESTRICT || len(projectIds) == 0 {
+		return nil
+	}
+
+	err := &ReferencedError{Resource: resource, ID: id.ToString(), Projects: model.IDList{}}
+	for _, projectId := range projectIds {
+		err.Projects = append(err.Projects, dbManager.projects[projectId].ID)
+	}
+
+	utils.ContextLogger(ctx).Error(err)
+	return err
+}
+
+// applyDeleteRule deletes the projects that referenced a deleted customer or user, or removes the reference with
+// unset, as the rule says. Removing the reference is an update of the project, so its version is increased.
+func (dbManager *memoryDbManagerImp) applyDeleteRule(
+	rule utils.OnDeleteEnum,
+	projectIds []string,
+	deletedAt time.Time,
+	unset func(project *model.Project)) {
+
+	for _, id := range projectIds {
+		if rule == utils.ON_DELETE_CASCADE {
+			dbManager.deleteProject(id, deletedAt)
+		} else if rule == utils.ON_DELETE_SET_NULL {
+			project := dbManager.projects[id]
+			unset(project)
+			project.Version++
+		}
+	}
+}
+
+// refreshCustomerProjects rebuilds the project list of the customers from the projects that reference them and are
+// not deleted.
+func (dbManager *memoryDbManagerImp) refreshCustomerProjects(customerIds ...model.ID) {
+	for _, customerId := range customerIds {
+		if customerId == nil {
+			continue
+		}
+
+		customer, ok := dbManager.customers[customerId.ToString()]
+		if !ok {
+			continue
+		}
+
+		customer.Projects = model.ProjectList{}
+		for _, id := range dbManager.referencingProjects(customerId, (*model.Project).CustomerID) {
+			customer.Projects = append(customer.Projects, &model.Project{ID: dbManager.projects[id].ID})
+		}
+	}
+}
+
+func (dbManager *memoryDbManagerImp) deleteProject(id string, deletedAt time.Time) {
+	if project, ok := dbManager.projects[id]; ok && project.DeletedAt.IsZero() {
+		project.DeletedAt = deletedAt
+		dbManager.refreshCustomerProjects(project.CustomerID())
+	}
+}
+
+// deleteCustomer deletes the customer and applies the delete rule to projectIds, the projects that reference it.
+func (dbManager *memoryDbManagerImp) deleteCustomer(id string, projectIds []string, deletedAt time.Time) {
+	if customer, ok := dbManager.customers[id]; ok && customer.DeletedAt.IsZero() {
+		customer.DeletedAt = deletedAt
+		dbManager.applyDeleteRule(dbManager.rules.customerProjects, projectIds, deletedAt, func(project *model.Project) {
+			project.Customer = nil
+		})
+		dbManager.refreshCustomerProjects(customer.ID)
+	}
+}
+
+func (dbManager *memoryDbManagerImp) visibleUserIds(ctx context.Context) []string {
+	return visibleIds(ctx, dbManager.userIds, func(id string) time.Time {
+		return dbManager.users[id].DeletedAt
+	})
+}
+
+func (dbManager *memoryDbManagerImp) visibleProjectIds(ctx context.Context) []string {
+	return visibleIds(ctx, dbManager.projectIds, func(id string) time.Time {
+		return dbManager.projects[id].DeletedAt
+	})
+}
+
+func (dbManager *memoryDbManagerImp) visibleCustomerIds(ctx context.Context) []string {
+	return visibleIds(ctx, dbManager.customerIds, func(id string) time.Time {
+		return dbManager.customers[id].DeletedAt
+	})
+}
+
+func (dbManager *memoryDbManagerImp) logError(ctx context.Context, msg string) error {
+	loggerObj := utils.ContextLogger(ctx).CallerSkip(1)
+
+	loggerObj.Error(msg)
+	return errors.New(msg)
+}
+
+// sortIds sorts the ids the same way sortQuery does in MongoDB. fieldValue returns the value of a document field of
+// the item with the given id.
+func (dbManager *memoryDbManagerImp) sortIds(
+	ctx context.Context,
+	ids []string,
+	orderBy *model.OrderBy,
+	fields map[string]string,
+	fieldValue func(id, field string) string) ([]string, error) {
+
+	if orderBy == nil {
+		return ids, nil
+	}
+
+	field, ok := fields[orderBy.Field]
+	if !ok {
+		return nil, dbManager.logError(ctx, fmt.Sprintf("cannot sort by %s", orderBy.Field))
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		first, second := fieldValue(ids[i], field), fieldValue(ids[j], field)
+		if first == second {
+			first, second = ids[i], ids[j]
+		}
+
+		if orderBy.Direction == utils.SORT_DESC {
+			return first > second
+		}
+		return first < second
+	})
+
+	return ids, nil
+}
+
+func matchesProject(project *model.Project, filter *model.ProjectFilter) bool {
+	if filter == nil {
+		return true
+	}
+
+	return containsFold(filter.NameContains, project.Name) &&
+		(filter.CustomerID == nil || idString(project.CustomerID()) == filter.CustomerID.ToString()) &&
+		(filter.OwnerID == nil || idString(project.OwnerID()) == filter.OwnerID.ToString()) &&
+		(filter.CreatedAfter.IsZero() || !project.CreatedAt.Before(filter.CreatedAfter)) &&
+		(filter.CreatedBefore.IsZero() || project.CreatedAt.Before(filter.CreatedBefore))
+}
+
+func matchesAuditEntry(entry *model.AuditEntry, filter *model.AuditFilter, entityIds map[string]bool) bool {
+	return (len(entityIds) == 0 || entityIds[entry.EntityID.ToString()]) &&
+		(filter.EntityType == nil || *filter.EntityType == entry.EntityType) &&
+		(filter.Since.IsZero() || !entry.Timestamp.Before(filter.Since)) &&
+		(filter.Until.IsZero() || entry.Timestamp.Before(filter.Until))
+}
+
+// containsFold reports whether any of the values contains search, ignoring case. An empty search matches everything.
+func containsFold(search string, values ...string) bool {
+	if search == "" {
+		return true
+	}
+
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), strings.ToLower(search)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func page(ids []string, startPosition, offset int) []string {
+	if startPosition >= len(ids) {
+		return []string{}
+	}
+
+	ids = ids[startPosition:]
+	if offset > 0 && offset < len(ids) {
+		ids = ids[:offset]
+	}
+
+	return ids
+}
+
+// keysetPage applies a PageRequest to a list of ids in ascending order. The ids generated by newId have a fixed
+// length, so comparing them as strings keeps the insertion order.
+func keysetPage(ids []string, page *model.PageRequest) ([]string, *model.PageInfo) {
+	var window []string
+	for _, id := range ids {
+		if page.After != nil && id <= page.After.ToString() {
+			continue
+		}
+		if page.Before != nil && id >= page.Before.ToString() {
+			continue
+		}
+		window = append(window, id)
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     page.Before != nil,
+		HasPreviousPage: page.After != nil,
+	}
+
+	if page.First > 0 && len(window) > page.First {
+		pageInfo.HasNextPage = true
+		window = window[:page.First]
+	} else if page.First == 0 && page.Last > 0 && len(window) > page.Last {
+		pageInfo.HasPreviousPage = true
+		window = window[len(window)-page.Last:]
+	}
+
+	return window, pageInfo
+}
+
+// idString returns the id as a string, or an empty string when it is nil.
+func idString(id model.ID) string {
+	if id == nil {
+		return ""
+	}
+
+	return id.ToString()
+}
+
+func idSet(ids model.IDList) map[string]bool {
+	result := map[string]bool{}
+	for _, id := range ids {
+		result[id.ToString()] = true
+	}
+
+	return result
+}
+
+// visibleIds returns the ids of a collection that are read with the context, in insertion order.
+func visibleIds(ctx context.Context, ids []string, deletedAt func(id string) time.Time) []string {
+	result := []string{}
+	for _, id := range ids {
+		if visible(ctx, deletedAt(id)) {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+// purged returns whether a document deleted at deletedAt is removed by a purge of the documents deleted before
+// deletedBefore.
+func purged(deletedAt, deletedBefore time.Time) bool {
+	return !deletedAt.IsZero() && deletedAt.Before(deletedBefore)
+}
+
+func copyUser(user *model.User) *model.User {
+	result := *user
+	result.Token = ""
+	return &result
+}
+
+func copyProject(project *model.Project) *model.Project {
+	result := *project
+	if project.Owner != nil {
+		result.Owner = &model.User{ID: project.Owner.ID}
+	}
+	if project.Customer != nil {
+		result.Customer = &model.Customer{ID: project.Customer.ID}
+	}
+	result.Fields = model.ProjectFieldList{}
+	for _, field := range project.Fields {
+		if field.Options != nil {
+			field.Options = append([]string{}, field.Options...)
+		}
+		result.Fields = append(result.Fields, field)
+	}
+	return &result
+}
+
+func copyCustomer(customer *model.Customer) *model.Customer {
+	result := *customer
+	result.Projects = model.ProjectList{}
+	for _, project := range customer.Projects {
+		result.Projects = append(result.Projects, &model.Project{ID: project.ID})
+	}
+	return &result
+}
+
+func createMemoryDbManager(rules deleteRules) *memoryDbManagerImp {
+	return &memoryDbManagerImp{
+		isOpen:    false,
+		users:     map[string]*model.User{},
+		projects:  map[string]*model.Project{},
+		customers: map[string]*model.Customer{},
+		queries:   map[string]string{},
+		rules:     rules,
+	}
+}
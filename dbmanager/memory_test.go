@@ -0,0 +1,433 @@
+package dbmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+func initMemoryDbManagerForTesting(t *testing.T) *memoryDbManagerImp {
+	dbManager := createMemoryDbManager(deleteRules{})
+	if err := dbManager.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbManager
+}
+
+func TestMemoryRegisterUserWithDuplicatedEmail(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+
+	if _, err := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"}); err == nil {
+		t.Error("Registering a user with an existing email must fail.")
+	}
+}
+
+func TestMemoryCreateProjectWithInvalidCustomer(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+
+	_, err := dbManager.CreateProject(ctx, &model.Project{
+		Name:     "Picnic",
+		Owner:    owner,
+		Customer: &model.Customer{ID: &memId{id: "000000000000000000000042"}},
+	})
+
+	if err == nil {
+		t.Error("Creating a project for a customer which doesn't exist must fail.")
+	}
+}
+
+func TestMemoryGetWithNullID(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+
+	if _, err := dbManager.GetProject(ctx, nil); err == nil {
+		t.Error("Getting a project with a null id must fail.")
+	}
+
+	if _, err := dbManager.GetCustomerByID(ctx, nil); err == nil {
+		t.Error("Getting a customer with a null id must fail.")
+	}
+
+	calls := map[string]func() error{
+		"DeleteProject": func() error {
+			return dbManager.DeleteProject(ctx, nil)
+		},
+		"DeleteCustomer": func() error {
+			return dbManager.DeleteCustomer(ctx, nil)
+		},
+		"GetOwnerFromProjectID": func() error {
+			_, err := dbManager.GetOwnerFromProjectID(ctx, nil)
+			return err
+		},
+		"AllProjectsFromCustomer": func() error {
+			_, err := dbManager.AllProjectsFromCustomer(ctx, nil)
+			return err
+		},
+		"RestoreProject": func() error {
+			_, err := dbManager.RestoreProject(ctx, nil)
+			return err
+		},
+		"RestoreCustomer": func() error {
+			_, err := dbManager.RestoreCustomer(ctx, nil)
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		if err := call(); err == nil {
+			t.Errorf("%s with a null id must fail.", name)
+		}
+	}
+}
+
+func TestMemoryDeleteUnknownProject(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+
+	if err := dbManager.DeleteProject(ctx, &memId{id: "000000000000000000000042"}); err == nil {
+		t.Error("Deleting a project that does not exist must fail, like deleting a customer.")
+	}
+}
+
+func TestMemoryAllProjectsPaging(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+
+	for _, name := range []string{"first", "second", "third"} {
+		if _, err := dbManager.CreateProject(ctx, &model.Project{Name: name, Owner: owner, Customer: customer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	projects, err := dbManager.AllProjects(ctx, nil, nil, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(projects) != 1 || projects[0].Name != "second" {
+		t.Error("Invalid page of projects returned.")
+		t.Log("Value received: ", projects)
+	}
+
+	if projects, _ = dbManager.AllProjects(ctx, nil, nil, 0, 0); len(projects) != 3 {
+		t.Error("All projects must be returned when offset is 0.")
+	}
+}
+
+func TestMemoryAllProjectsFilteredAndSorted(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+
+	for _, name := range []string{"Picnic web", "Backoffice", "picnic mobile"} {
+		if _, err := dbManager.CreateProject(ctx, &model.Project{Name: name, Owner: owner, Customer: customer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	projects, err := dbManager.AllProjects(
+		ctx,
+		&model.ProjectFilter{NameContains: "PICNIC"},
+		&model.OrderBy{Field: utils.SORT_FIELD_NAME, Direction: utils.SORT_DESC},
+		0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(projects) != 2 || projects[0].Name != "picnic mobile" || projects[1].Name != "Picnic web" {
+		t.Error("Invalid projects returned.")
+		t.Log("Value received: ", projects)
+	}
+
+	if _, err := dbManager.AllProjects(ctx, nil, &model.OrderBy{Field: utils.SORT_FIELD_CUIT}, 0, 0); err == nil {
+		t.Error("Sorting projects by an unknown field must fail.")
+	}
+}
+
+func TestMemoryGetOwnerFromProjectID(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	project, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: owner, Customer: customer})
+
+	if user, err := dbManager.GetOwnerFromProjectID(ctx, project.ID); err != nil {
+		t.Error(err)
+	} else if user.Email != owner.Email {
+		t.Error("Invalid owner returned.")
+	}
+}
+
+func TestMemoryUsersKeysetPage(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	var users model.UserList
+	for _, email := range []string{"a@picnic.com", "b@picnic.com", "c@picnic.com", "d@picnic.com"} {
+		user, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: email})
+		users = append(users, user)
+	}
+
+	page, pageInfo, err := dbManager.UsersPage(ctx, &model.PageRequest{First: 2, After: users[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 2 || page[0].Email != "b@picnic.com" || page[1].Email != "c@picnic.com" {
+		t.Error("Invalid users returned after the cursor.")
+	} else if !pageInfo.HasNextPage || !pageInfo.HasPreviousPage {
+		t.Error("The page must have a next and a previous page.")
+	}
+
+	page, pageInfo, err = dbManager.UsersPage(ctx, &model.PageRequest{Last: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 2 || page[0].Email != "c@picnic.com" || page[1].Email != "d@picnic.com" {
+		t.Error("The last users must be returned in ascending order.")
+	} else if pageInfo.HasNextPage || !pageInfo.HasPreviousPage {
+		t.Error("The last page must only have a previous page.")
+	}
+}
+
+func TestMemoryAuditLogFilters(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	now := time.Now()
+	project, customer := &memId{id: "000000000000000000000042"}, &memId{id: "000000000000000000000043"}
+
+	entries := []*model.AuditEntry{
+		{Timestamp: now, EntityType: utils.AUDIT_PROJECT, EntityID: project, Operation: utils.AUDIT_UPDATE},
+		{Timestamp: now.Add(-time.Hour), EntityType: utils.AUDIT_PROJECT, EntityID: project, Operation: utils.AUDIT_CREATE},
+		{Timestamp: now, EntityType: utils.AUDIT_CUSTOMER, EntityID: customer, Operation: utils.AUDIT_CREATE},
+	}
+	for _, entry := range entries {
+		if err := dbManager.AddAuditEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, _ := dbManager.AuditLog(ctx, &model.AuditFilter{EntityIDs: model.IDList{project}})
+	if len(history) != 2 || history[0].Operation != utils.AUDIT_CREATE || history[1].Operation != utils.AUDIT_UPDATE {
+		t.Error("The history of the project must be in chronological order: ", history)
+	}
+
+	entityType := utils.AuditEntityTypeEnum(utils.AUDIT_CUSTOMER)
+	if result, _ := dbManager.AuditLog(ctx, &model.AuditFilter{EntityType: &entityType}); len(result) != 1 {
+		t.Error("Only the customer entry must be returned: ", result)
+	}
+
+	if result, _ := dbManager.AuditLog(ctx, &model.AuditFilter{Since: now.Add(-time.Minute), Until: now}); len(result) != 0 {
+		t.Error("Until must be excluded from the range: ", result)
+	}
+}
+
+func TestMemorySoftDeleteRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	deleted, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: owner, Customer: customer})
+	kept, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Backoffice", Owner: owner, Customer: customer})
+
+	if err := dbManager.DeleteProject(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dbManager.GetProject(ctx, deleted.ID); err == nil {
+		t.Error("A deleted project must not be returned.")
+	}
+	if count, _ := dbManager.CountProjects(ctx); count != 1 {
+		t.Error("A deleted project must not be counted. Value received: ", count)
+	}
+	if projects, _ := dbManager.AllProjectsFromCustomer(ctx, customer.ID); len(projects) != 1 || projects[0].Name != kept.Name {
+		t.Error("The projects of the customer must not include the deleted project: ", projects)
+	}
+
+	if project, err := dbManager.GetProject(WithDeleted(ctx), deleted.ID); err != nil {
+		t.Error(err)
+	} else if project.DeletedAt.IsZero() {
+		t.Error("A deleted project must have a deleted date.")
+	}
+
+	if _, err := dbManager.RestoreProject(ctx, kept.ID); err == nil {
+		t.Error("Restoring a project which is not deleted must fail.")
+	}
+	if project, err := dbManager.RestoreProject(ctx, deleted.ID); err != nil {
+		t.Error(err)
+	} else if !project.DeletedAt.IsZero() {
+		t.Error("A restored project must not have a deleted date.")
+	}
+
+	dbManager.DeleteProject(ctx, deleted.ID)
+	if count, _ := dbManager.PurgeDeleted(ctx, time.Now().Add(-time.Hour)); count != 0 {
+		t.Error("The records deleted after the date must be kept. Purged: ", count)
+	}
+	if count, _ := dbManager.PurgeDeleted(ctx, time.Now().Add(time.Hour)); count != 1 {
+		t.Error("The deleted project must be purged. Purged: ", count)
+	}
+	if _, err := dbManager.GetProject(WithDeleted(ctx), deleted.ID); err == nil {
+		t.Error("A purged project must not be returned.")
+	}
+}
+
+func TestMemoryUpdateProjectWithStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	project, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: owner, Customer: customer})
+
+	if project.Version != 1 {
+		t.Error("A new project must have version 1. Value received: ", project.Version)
+	}
+
+	first, _ := dbManager.GetProject(ctx, project.ID)
+	second, _ := dbManager.GetProject(ctx, project.ID)
+
+	first.Name = "Picnic web"
+	if updated, err := dbManager.UpdateProject(ctx, first); err != nil {
+		t.Fatal(err)
+	} else if updated.Version != 2 {
+		t.Error("An update must increase the version. Value received: ", updated.Version)
+	}
+
+	second.Description = "Written without reading the first update"
+	if _, err := dbManager.UpdateProject(ctx, second); err != ErrVersionConflict {
+		t.Error("An update with a stale version must fail with ErrVersionConflict. Error received: ", err)
+	}
+
+	if stored, _ := dbManager.GetProject(ctx, project.ID); stored.Name != "Picnic web" || stored.Description != "" {
+		t.Error("The rejected update must not be written: ", stored)
+	}
+}
+
+func TestMemoryDeleteRules(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	owner, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	project, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: owner, Customer: customer})
+
+	if stored, _ := dbManager.GetCustomerByID(ctx, customer.ID); len(stored.Projects) != 1 ||
+		stored.Projects[0].ID.ToString() != project.ID.ToString() {
+		t.Error("A new project must be added to the projects of its customer: ", stored.Projects)
+	}
+
+	var referenced *ReferencedError
+	if err := dbManager.DeleteCustomer(ctx, customer.ID); !errors.As(err, &referenced) || len(referenced.Projects) != 1 {
+		t.Error("Deleting a customer with projects must fail with the restrict rule. Error received: ", err)
+	}
+	if err := dbManager.DeleteUser(ctx, owner.Email); !errors.As(err, &referenced) {
+		t.Error("Deleting an owner of projects must fail with the restrict rule. Error received: ", err)
+	}
+
+	dbManager.rules = deleteRules{customerProjects: utils.ON_DELETE_CASCADE, ownerProjects: utils.ON_DELETE_SET_NULL}
+	if err := dbManager.DeleteCustomer(ctx, customer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbManager.GetProject(ctx, project.ID); err == nil {
+		t.Error("The projects of a customer must be deleted with the cascade rule.")
+	}
+	if _, err := dbManager.RestoreCustomer(ctx, customer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := dbManager.GetProject(ctx, project.ID); err != nil {
+		t.Error("The projects deleted with a customer must be restored with it: ", err)
+	} else if customer, _ = dbManager.GetCustomerByID(ctx, customer.ID); len(customer.Projects) != 1 {
+		t.Error("The restored projects must be added to the projects of their customer: ", stored)
+	}
+
+	if err := dbManager.DeleteUser(ctx, owner.Email); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := dbManager.GetProject(ctx, project.ID); err != nil {
+		t.Error(err)
+	} else if stored.Owner != nil || stored.Version != project.Version+1 {
+		t.Error("The owner of the projects must be removed with the set null rule: ", stored)
+	}
+}
+
+func TestMemoryMergeUsers(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+	john, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	johnAdmin, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "john.smith@picnic.com", Role: utils.ROLE_ADMIN})
+	jane, _ := dbManager.RegisterNewUser(ctx, &model.User{Email: "jane@picnic.com"})
+	customer, _ := dbManager.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	project, _ := dbManager.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: john, Customer: customer})
+	// the emails registered before they were stored in lower case
+	dbManager.users[johnAdmin.ID.ToString()].Email = "John@Picnic.com"
+
+	if _, err := dbManager.MergeUsers(ctx, johnAdmin.ID, model.IDList{john.ID}, jane.Email); err == nil {
+		t.Error("Merging into an email of another user must fail.")
+	} else if stored, _ := dbManager.GetProject(ctx, project.ID); stored.OwnerID().ToString() != john.ID.ToString() {
+		t.Error("A merge that fails cannot move the projects.")
+	} else if _, err := dbManager.GetUserByID(ctx, john.ID); err != nil {
+		t.Error("A merge that fails cannot delete the duplicates: ", err)
+	}
+
+	moved, err := dbManager.MergeUsers(ctx, johnAdmin.ID, model.IDList{john.ID}, "john@picnic.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(moved) != 1 || moved[0].OwnerID().ToString() != john.ID.ToString() {
+		t.Error("The projects moved must be returned as they were before the move: ", moved)
+	}
+
+	if stored, _ := dbManager.GetProject(ctx, project.ID); stored.OwnerID().ToString() != johnAdmin.ID.ToString() {
+		t.Error("The projects of the duplicate must be moved to the user kept.")
+	} else if stored.Version != project.Version+1 {
+		t.Errorf("The version of the project moved must be %d, not %d.", project.Version+1, stored.Version)
+	}
+
+	if user, err := dbManager.GetUserByID(ctx, johnAdmin.ID); err != nil {
+		t.Error(err)
+	} else if user.Email != "john@picnic.com" {
+		t.Error("The user kept must have the new email, not ", user.Email)
+	} else if _, err := dbManager.GetUserByID(ctx, john.ID); err == nil {
+		t.Error("The duplicate must be deleted.")
+	}
+}
+
+func TestMemoryEmailsIgnoreTheLetterCase(t *testing.T) {
+	ctx := context.Background()
+	dbManager := initMemoryDbManagerForTesting(t)
+
+	john, err := dbManager.RegisterNewUser(ctx, &model.User{Email: " John@Picnic.com"})
+	if err != nil {
+		t.Fatal(err)
+	} else if john.Email != "john@picnic.com" {
+		t.Error("The email must be stored in lower case, not ", john.Email)
+	}
+
+	if _, err := dbManager.RegisterNewUser(ctx, &model.User{Email: "JOHN@picnic.com"}); err == nil {
+		t.Error("An email that only differs in letter case must be taken.")
+	}
+
+	if user, err := dbManager.GetUserByEmail(ctx, "John@PICNIC.com"); err != nil {
+		t.Error(err)
+	} else if user.ID.ToString() != john.ID.ToString() {
+		t.Error("The user must be found with the email in any letter case.")
+	}
+
+	if err := dbManager.DeleteUser(ctx, "JOHN@PICNIC.COM"); err != nil {
+		t.Fatal(err)
+	} else if _, err := dbManager.GetUserByID(ctx, john.ID); err == nil {
+		t.Error("The user must be deleted with the email in any letter case.")
+	}
+}
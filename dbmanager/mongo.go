@@ -5,14 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"github.com/freddy311082/picnic-server/settings"
-	"github.com/google/logger"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"time"
 
 	"github.com/freddy311082/picnic-server/model"
 	"github.com/freddy311082/picnic-server/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const pingTimeout = 2 * time.Second
+
+// Codes of the MongoDB command errors.
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
 )
 
 type cacheKey struct {
@@ -27,52 +37,102 @@ type mongodbManagerImp struct {
 	db            *mongo.Database
 	initiated     bool
 	cache         map[cacheKey]interface{}
+	// operationTimeout is the deadline of every operation. Zero means the operations only end with the request.
+	operationTimeout time.Duration
+	rules            deleteRules
 }
 
-func (dbManager *mongodbManagerImp) AllProjectsFromCustomer(customerId model.ID) (model.ProjectList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+// operationContext returns the context of a database operation, which is cancelled when the request is cancelled or
+// when the operation timeout expires.
+func (dbManager *mongodbManagerImp) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if dbManager.operationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, dbManager.operationTimeout)
+}
+
+func (dbManager *mongodbManagerImp) AllProjectsFromCustomer(ctx context.Context, customerId model.ID) (model.ProjectList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if dbCustomerId, err := dbManager.modelIDtoMongoID(customerId, loggerObj); err != nil {
 		return model.ProjectList{}, err
 	} else {
 		collection := dbManager.collection(utils.PROJECTS_COLLECTION)
 
-		if cursor, err := collection.Find(context.TODO(), bson.M{utils.PROJECT_CUSTOMER_ID_FIELD: dbCustomerId}); err != nil {
+		if cursor, err := collection.Find(ctx, notDeleted(ctx, bson.M{utils.PROJECT_CUSTOMER_ID_FIELD: dbCustomerId})); err != nil {
 			loggerObj.Error(err)
 			return model.ProjectList{}, err
 		} else {
-			return dbManager.decodeBsonIntoProjectListModel(cursor, loggerObj)
+			return dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
 		}
 	}
 }
 
-func (dbManager *mongodbManagerImp) GetOwnerFromProjectID(projectId model.ID) (*model.User, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
-	var err error
-	var dbProjectId primitive.ObjectID
-	var user *model.User
+func (dbManager *mongodbManagerImp) AllProjectsFromCustomers(ctx context.Context, customerIds model.IDList) (model.ProjectList, error) {
+	return dbManager.allProjectsWhereFieldIsIn(ctx, utils.PROJECT_CUSTOMER_ID_FIELD, customerIds)
+}
+
+func (dbManager *mongodbManagerImp) AllProjectsFromUsers(ctx context.Context, userIds model.IDList) (model.ProjectList, error) {
+	return dbManager.allProjectsWhereFieldIsIn(ctx, utils.PROJECT_OWNER_ID_FIELD, userIds)
+}
+
+func (dbManager *mongodbManagerImp) allProjectsWhereFieldIsIn(ctx context.Context, field string, ids model.IDList) (model.ProjectList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
-	if dbProjectId, err = dbManager.modelIDtoMongoID(projectId, loggerObj); err != nil {
+	if mdbIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj); err != nil {
+		return model.ProjectList{}, err
+	} else {
+		collection := dbManager.collection(utils.PROJECTS_COLLECTION)
+
+		if cursor, err := collection.Find(ctx, notDeleted(ctx, bson.M{field: bson.M{"$in": mdbIds}})); err != nil {
+			loggerObj.Error(err)
+			return model.ProjectList{}, err
+		} else {
+			return dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
+		}
+	}
+}
+
+func (dbManager *mongodbManagerImp) GetOwnerFromProjectID(ctx context.Context, projectId model.ID) (*model.User, error) {
+	if project, err := dbManager.GetProject(ctx, projectId); err != nil {
 		return nil, err
-	} else if user, err = dbManager.GetUserByID(&mdbId{id: dbProjectId}); err != nil {
+	} else if project.OwnerID() == nil {
+		msg := fmt.Sprintf("owner of project %s not found", projectId.ToString())
+		utils.ContextLogger(ctx).Error(msg)
+		return nil, errors.New(msg)
+	} else if user, err := dbManager.GetUserByID(ctx, project.OwnerID()); err != nil {
 		return nil, err
 	} else {
 		return user, nil
 	}
 }
 
-func (dbManager *mongodbManagerImp) GetCustomerByID(customerId model.ID) (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) GetCustomerByID(ctx context.Context, customerId model.ID) (*model.Customer, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	if customerId == nil {
+		const msg = "customer id cannot be null"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
 
 	if id, err := dbManager.modelIDtoMongoID(customerId, loggerObj); err != nil {
 		return nil, err
 	} else {
 		collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
 
-		if result := collection.FindOne(context.TODO(), bson.M{utils.CUSTOMER_ID_FIELD: id}); result.Err() != nil {
+		if result := collection.FindOne(ctx, notDeleted(ctx, bson.M{utils.CUSTOMER_ID_FIELD: id})); result.Err() != nil {
 			loggerObj.Error(err)
 			return nil, result.Err()
 		} else {
@@ -81,12 +141,13 @@ func (dbManager *mongodbManagerImp) GetCustomerByID(customerId model.ID) (*model
 	}
 }
 
-func (dbManager *mongodbManagerImp) existsObject(id primitive.ObjectID, collectionName string) (bool, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) existsObject(ctx context.Context, id primitive.ObjectID, collectionName string) (bool, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	collection := dbManager.collection(collectionName)
-	if count, err := collection.CountDocuments(context.TODO(), bson.M{"_id": id}); err != nil {
+	if count, err := collection.CountDocuments(ctx, notDeleted(ctx, bson.M{"_id": id})); err != nil {
 		loggerObj.Error(err)
 		return false, err
 	} else {
@@ -94,69 +155,72 @@ func (dbManager *mongodbManagerImp) existsObject(id primitive.ObjectID, collecti
 	}
 }
 
-func (dbManager *mongodbManagerImp) AllUsersWhereIDIsIn(ids model.IDList) (model.UserList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllUsersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.UserList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if dbIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj); err != nil {
 		loggerObj.Error(err)
 		return model.UserList{}, err
-	} else if cursor, queryErr := dbManager.collection(utils.USERS_COLLECTION).Find(context.TODO(),
-		bson.M{
+	} else if cursor, queryErr := dbManager.collection(utils.USERS_COLLECTION).Find(ctx,
+		notDeleted(ctx, bson.M{
 			utils.USER_ID_FIELD: bson.M{"$in": dbIds},
-		}); queryErr != nil {
+		})); queryErr != nil {
 		loggerObj.Error(queryErr)
 		return model.UserList{}, err
 	} else {
-		return dbManager.decodeBsonIntoUserListModel(cursor, loggerObj)
+		return dbManager.decodeBsonIntoUserListModel(ctx, cursor, loggerObj)
 	}
 }
 
-func (dbManager *mongodbManagerImp) AllCustomersWhereIDIsIn(ids model.IDList) (model.CustomerList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllCustomersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.CustomerList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if mbdIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj); err != nil {
 		return model.CustomerList{}, err
 	} else {
 		collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
 
-		if cursor, err := collection.Find(context.TODO(),
-			bson.M{
+		if cursor, err := collection.Find(ctx,
+			notDeleted(ctx, bson.M{
 				"_id": bson.M{"$in": mbdIds},
-			}); err != nil {
+			})); err != nil {
 			loggerObj.Error(err)
-			return model.CustomerList{}, nil
+			return model.CustomerList{}, err
 		} else {
-			return dbManager.decodeBsonIntoCustomerListModel(cursor, loggerObj)
+			return dbManager.decodeBsonIntoCustomerListModel(ctx, cursor, loggerObj)
 		}
 	}
 }
 
-func (dbManager *mongodbManagerImp) AllProjectWhereIDIsIn(ids model.IDList) (model.ProjectList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllProjectWhereIDIsIn(ctx context.Context, ids model.IDList) (model.ProjectList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if mdbIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj); err != nil {
 		return model.ProjectList{}, err
 	} else {
 		collection := dbManager.collection(utils.PROJECTS_COLLECTION)
 
-		if cursor, err := collection.Find(context.TODO(),
-			bson.M{
+		if cursor, err := collection.Find(ctx,
+			notDeleted(ctx, bson.M{
 				"_id": bson.M{"$in": mdbIds},
-			}); err != nil {
+			})); err != nil {
 			loggerObj.Error(err)
-			return model.ProjectList{}, nil
+			return model.ProjectList{}, err
 		} else {
-			return dbManager.decodeBsonIntoProjectListModel(cursor, loggerObj)
+			return dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
 		}
 	}
 }
 
 func (dbManager *mongodbManagerImp) decodeBsonIntoCustomerModel(
 	singleResult *mongo.SingleResult,
-	loggerObj *logger.Logger) (*model.Customer, error) {
+	loggerObj *utils.Logger) (*model.Customer, error) {
 
 	customerDb := &mdbCustomerModel{}
 	if err := singleResult.Decode(customerDb); err != nil {
@@ -168,128 +232,209 @@ func (dbManager *mongodbManagerImp) decodeBsonIntoCustomerModel(
 }
 
 func (dbManager *mongodbManagerImp) decodeBsonIntoCustomerListModel(
+	ctx context.Context,
 	cursor *mongo.Cursor,
-	loggerObj *logger.Logger) (model.CustomerList, error) {
+	loggerObj *utils.Logger) (model.CustomerList, error) {
 
 	var result model.CustomerList
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		customerDb := &mdbCustomerModel{}
 		if err := cursor.Decode(&customerDb); err != nil {
 			loggerObj.Error(err)
 			return nil, err
 		} else if customer, decodeErr := customerDb.toModel(); decodeErr != nil {
-			return nil, err
+			return nil, decodeErr
 		} else {
 			result = append(result, customer)
 		}
 	}
 
+	if err := cursor.Err(); err != nil {
+		// the request was cancelled or the operation timed out
+		loggerObj.Error(err)
+		return nil, err
+	}
+
 	return result, nil
 }
 
-func (dbManager *mongodbManagerImp) AllCustomers() (model.CustomerList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllCustomers(
+	ctx context.Context,
+	filter *model.CustomerFilter,
+	orderBy *model.OrderBy) (model.CustomerList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+
+	loggerObj := utils.ContextLogger(ctx)
 	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
 
-	if cursor, err := collection.Find(context.TODO(), bson.M{}); err != nil {
+	sorting, err := sortQuery(orderBy, customerSortFields, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(sorting)
+	if cursor, err := collection.Find(ctx, notDeleted(ctx, customerFilterQuery(filter)), findOptions); err != nil {
 		loggerObj.Error(err)
-		return model.CustomerList{}, nil
+		return model.CustomerList{}, err
 	} else {
-		return dbManager.decodeBsonIntoCustomerListModel(cursor, loggerObj)
+		return dbManager.decodeBsonIntoCustomerListModel(ctx, cursor, loggerObj)
 	}
 }
 
-func (dbManager *mongodbManagerImp) CreateCustomer(customer *model.Customer) (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) CreateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	customerDb := &mdbCustomerModel{}
 	customerDb.initFromModel(customer)
 	customerDb.ID = primitive.NewObjectID()
+	customerDb.Version = 1
+	// the project list is kept by the writes of the projects
+	customerDb.Projects = []primitive.ObjectID{}
 
 	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
-	if result, err := collection.InsertOne(context.TODO(), customerDb); err != nil {
+	if result, err := collection.InsertOne(ctx, customerDb); err != nil {
 		loggerObj.Error(err)
 		return nil, err
 	} else {
 		customer.ID = dbManager.mongoIdToModelID(result.InsertedID.(primitive.ObjectID))
+		customer.Version = customerDb.Version
 		return customer, nil
 	}
 }
 
-func (dbManager *mongodbManagerImp) UpdateCustomer(customer *model.Customer) (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) UpdateCustomer(ctx context.Context, customer *model.Customer) (*model.Customer, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
 
 	customerDb := &mdbCustomerModel{}
 	customerDb.initFromModel(customer)
-	if result, err := collection.UpdateOne(context.TODO(),
-		bson.D{{utils.CUSTOMER_ID_FIELD, customerDb.ID}},
-		customerDb); err != nil {
+	customerDb.Version = customer.Version + 1
+	// the project list is not replaced, as it is kept by the writes of the projects
+	if result, err := collection.UpdateOne(ctx,
+		bson.M{
+			utils.CUSTOMER_ID_FIELD:      customerDb.ID,
+			utils.CUSTOMER_VERSION_FIELD: versionQuery(customer.Version),
+			utils.DELETED_AT_FIELD:       nil,
+		},
+		bson.M{"$set": bson.M{
+			utils.CUSTOMER_NAME_FIELD:    customerDb.Name,
+			utils.CUSTOMER_CUIT_FIELD:    customerDb.Cuit,
+			utils.CUSTOMER_VERSION_FIELD: customerDb.Version,
+		}}); err != nil {
 		loggerObj.Error(err)
 		return nil, err
 	} else if result.MatchedCount != 1 {
+		if exists, err := dbManager.existsObject(ctx, customerDb.ID, utils.CUSTOMERS_COLLECTION); err != nil {
+			return nil, err
+		} else if exists {
+			loggerObj.Error(ErrVersionConflict)
+			return nil, ErrVersionConflict
+		}
+
 		var msg = fmt.Sprintf("nothing to update. CustomerID (%s) was not found", customer.ID.ToString())
 		loggerObj.Error(msg)
 		return nil, errors.New(msg)
 	} else {
+		customer.Version = customerDb.Version
 		return customer, nil
 	}
 }
 
-func (dbManager *mongodbManagerImp) DeleteCustomer(customerId model.ID) error {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) DeleteCustomer(ctx context.Context, customerId model.ID) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
-	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
-	if dbId, err := primitive.ObjectIDFromHex(customerId.ToString()); err != nil {
-		loggerObj.Error(err)
+	dbId, err := dbManager.modelIDtoMongoID(customerId, loggerObj)
+	if err != nil {
 		return err
-	} else {
-		var result *mongo.DeleteResult
-		if result, err = collection.DeleteOne(context.TODO(), bson.M{utils.CUSTOMER_ID_FIELD: dbId}); err != nil {
-			logger.Error(err)
+	}
+
+	return dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if deleted, err := dbManager.deleteCustomer(sessCtx, dbId, time.Now().UTC()); err != nil {
 			return err
-		} else if result.DeletedCount == 0 {
+		} else if !deleted {
 			var msg = fmt.Sprintf("customer id %s not found", customerId.ToString())
 			loggerObj.Error(msg)
 			return errors.New(msg)
-		} else {
-			return nil
 		}
+
+		return nil
+	})
+}
+
+func (dbManager *mongodbManagerImp) DeleteCustomers(ctx context.Context, ids model.IDList) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	mongoIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj)
+	if err != nil {
+		return err
 	}
+
+	// a customer restricted by its projects aborts the transaction, so none of the customers is deleted
+	return dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		count, deletedAt := 0, time.Now().UTC()
+		for _, id := range mongoIds {
+			if deleted, err := dbManager.deleteCustomer(sessCtx, id, deletedAt); err != nil {
+				return err
+			} else if deleted {
+				count++
+			}
+		}
+
+		loggerObj.Infof("Deleted %d customers.", count)
+		return nil
+	})
 }
 
-func (dbManager *mongodbManagerImp) DeleteCustomers(ids model.IDList) error {
-	panic("implement me")
+// deleteCustomer deletes the customer, when it is not deleted yet, and applies the delete rule to its projects. It
+// returns whether the customer was deleted.
+func (dbManager *mongodbManagerImp) deleteCustomer(ctx context.Context, id primitive.ObjectID, deletedAt time.Time) (bool, error) {
+	loggerObj := utils.ContextLogger(ctx)
+	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
+
+	if exists, err := dbManager.existsObject(ctx, id, utils.CUSTOMERS_COLLECTION); err != nil || !exists {
+		return false, err
+	} else if err = dbManager.applyDeleteRule(ctx, dbManager.rules.customerProjects, "customer",
+		utils.PROJECT_CUSTOMER_ID_FIELD, id, deletedAt); err != nil {
+		return false, err
+	} else if _, err = collection.UpdateOne(ctx,
+		bson.M{utils.CUSTOMER_ID_FIELD: id, utils.DELETED_AT_FIELD: nil},
+		markDeleted(deletedAt)); err != nil {
+		loggerObj.Error(err)
+		return false, err
+	}
+
+	return true, dbManager.refreshCustomerProjects(ctx, id)
 }
 
-func (dbManager *mongodbManagerImp) DeleteProjects(ids model.IDList) error {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) DeleteProjects(ctx context.Context, ids model.IDList) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if mongoIds, err := dbManager.modelIDsToMongoIDs(ids, loggerObj); err != nil {
 		loggerObj.Error(err)
 		return err
 	} else {
-		collection := dbManager.collection(utils.PROJECTS_COLLECTION)
-		if result, err := collection.DeleteMany(
-			context.TODO(),
-			bson.M{
-				"$in": mongoIds,
-			}); err != nil {
-			loggerObj.Error(err)
-			return err
-		} else {
-			loggerObj.Infof("Deleted %d projects.", result.DeletedCount)
-		}
+		return dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if count, err := dbManager.deleteProjects(sessCtx, mongoIds, time.Now().UTC()); err != nil {
+				return err
+			} else {
+				loggerObj.Infof("Deleted %d projects.", count)
+				return nil
+			}
+		})
 	}
-
-	return nil
 }
 
 func (dbManager *mongodbManagerImp) mongoIDsToModelIDs(mdbIds []primitive.ObjectID) model.IDList {
@@ -308,9 +453,13 @@ func (dbManager *mongodbManagerImp) mongoIDsToModelIDs(mdbIds []primitive.Object
 
 func (dbManager *mongodbManagerImp) modelIDtoMongoID(
 	id model.ID,
-	loggerObj *logger.Logger) (primitive.ObjectID, error) {
+	loggerObj *utils.Logger) (primitive.ObjectID, error) {
 
-	if dbId, err := primitive.ObjectIDFromHex(id.ToString()); err != nil {
+	if id == nil {
+		const msg = "id cannot be null"
+		loggerObj.Error(msg)
+		return primitive.ObjectID{}, errors.New(msg)
+	} else if dbId, err := primitive.ObjectIDFromHex(id.ToString()); err != nil {
 		loggerObj.Error(err)
 		return primitive.ObjectID{}, err
 	} else {
@@ -320,7 +469,7 @@ func (dbManager *mongodbManagerImp) modelIDtoMongoID(
 
 func (dbManager *mongodbManagerImp) modelIDsToMongoIDs(
 	ids model.IDList,
-	loggerObj *logger.Logger) ([]primitive.ObjectID, error) {
+	loggerObj *utils.Logger) ([]primitive.ObjectID, error) {
 
 	if ids == nil || len(ids) == 0 {
 		return make([]primitive.ObjectID, 0), nil
@@ -340,31 +489,34 @@ func (dbManager *mongodbManagerImp) modelIDsToMongoIDs(
 	return mongoIds, nil
 }
 
-func (dbManager *mongodbManagerImp) DeleteProject(projectId model.ID) error {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) DeleteProject(ctx context.Context, projectId model.ID) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
-	if id, err := primitive.ObjectIDFromHex(projectId.ToString()); err != nil {
-		loggerObj.Error(err)
+	if id, err := dbManager.modelIDtoMongoID(projectId, loggerObj); err != nil {
 		return err
 	} else {
-		collection := dbManager.collection(utils.PROJECTS_COLLECTION)
-		if _, errDelete := collection.DeleteOne(context.TODO(), bson.M{utils.PROJECT_ID_FIELD: id}); errDelete != nil {
-			loggerObj.Error(err)
-			return err
-		}
-	}
+		return dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if count, err := dbManager.deleteProjects(sessCtx, []primitive.ObjectID{id}, time.Now().UTC()); err != nil {
+				return err
+			} else if count == 0 {
+				msg := fmt.Sprintf("project id %s not found", projectId.ToString())
+				loggerObj.Error(msg)
+				return errors.New(msg)
+			}
 
-	return nil
+			return nil
+		})
+	}
 }
 
-func (dbManager *mongodbManagerImp) getMongoUserID(user *model.User) (*primitive.ObjectID, error) {
+func (dbManager *mongodbManagerImp) getMongoUserID(ctx context.Context, user *model.User) (*primitive.ObjectID, error) {
 	var userId primitive.ObjectID
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if user.ID == nil {
-		if userObj, err := dbManager.GetUserByEmail(user.Email); err != nil {
+		if userObj, err := dbManager.GetUserByEmail(ctx, user.Email); err != nil {
 			return nil, err
 		} else {
 			userId, _ = primitive.ObjectIDFromHex(userObj.ID.ToString())
@@ -381,12 +533,13 @@ func (dbManager *mongodbManagerImp) getMongoUserID(user *model.User) (*primitive
 	return &userId, nil
 }
 
-func (dbManager *mongodbManagerImp) AllProjectFromUser(user *model.User) (model.ProjectList, error) {
+func (dbManager *mongodbManagerImp) AllProjectFromUser(ctx context.Context, user *model.User) (model.ProjectList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
 	var ownerId primitive.ObjectID
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+	loggerObj := utils.ContextLogger(ctx)
 
-	if userId, err := dbManager.getMongoUserID(user); err != nil {
+	if userId, err := dbManager.getMongoUserID(ctx, user); err != nil {
 		return model.ProjectList{}, err
 	} else {
 		ownerId = *userId
@@ -394,27 +547,77 @@ func (dbManager *mongodbManagerImp) AllProjectFromUser(user *model.User) (model.
 
 	collection := dbManager.collection(utils.PROJECTS_COLLECTION)
 
-	if cursor, err := collection.Find(context.TODO(), bson.M{utils.PROJECT_OWNER_ID_FIELD: ownerId}); err != nil {
+	if cursor, err := collection.Find(ctx, notDeleted(ctx, bson.M{utils.PROJECT_OWNER_ID_FIELD: ownerId})); err != nil {
 		loggerObj.Error(err)
 		return model.ProjectList{}, err
 	} else {
-		return dbManager.decodeBsonIntoProjectListModel(cursor, loggerObj)
+		return dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
 	}
 }
 
-func (dbManager *mongodbManagerImp) DeleteUser(email string) error {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) UpdateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	if user == nil || user.ID == nil {
+		const msg = "invalid user. Neither user object nor user ID can be NULL"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
+
+	user.Email = model.NormalizeEmail(user.Email)
+	userDb := &mdbUserModel{}
+	userDb.initFromModel(user)
+
+	collection := dbManager.collection(utils.USERS_COLLECTION)
+	if result, err := collection.ReplaceOne(ctx,
+		bson.M{utils.USER_ID_FIELD: userDb.ID, utils.DELETED_AT_FIELD: nil},
+		userDb); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	} else if result.MatchedCount != 1 {
+		msg := fmt.Sprintf("nothing to update. User (%s) not found", user.ID.ToString())
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
+
+	return user, nil
+}
+
+func (dbManager *mongodbManagerImp) DeleteUser(ctx context.Context, email string) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	collection := dbManager.collection(utils.USERS_COLLECTION)
 
-	if _, err := collection.DeleteOne(context.TODO(), bson.M{utils.USER_EMAIL_FIELD: email}); err != nil {
+	err := dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		userDb := &mdbUserModel{}
+		deletedAt := time.Now().UTC()
+
+		if err := dbManager.findUserByEmail(sessCtx, email,
+			bson.M{utils.DELETED_AT_FIELD: nil}).Decode(userDb); err == mongo.ErrNoDocuments {
+			return nil
+		} else if err != nil {
+			return err
+		} else if err = dbManager.applyDeleteRule(sessCtx, dbManager.rules.ownerProjects, "user",
+			utils.PROJECT_OWNER_ID_FIELD, userDb.ID, deletedAt); err != nil {
+			return err
+		}
+
+		_, err := collection.UpdateOne(sessCtx,
+			bson.M{utils.USER_ID_FIELD: userDb.ID, utils.DELETED_AT_FIELD: nil},
+			markDeleted(deletedAt))
+		return err
+	})
+
+	if err != nil {
 		loggerObj.Errorf("Error deleting user: %s. Error message: %s", email, err.Error())
 		return err
-	} else {
-		loggerObj.Infof("Deleted user %s", email)
 	}
 
+	loggerObj.Infof("Deleted user %s", email)
 	return nil
 }
 
@@ -422,104 +625,121 @@ func (dbManager *mongodbManagerImp) collection(name string) *mongo.Collection {
 	return dbManager.db.Collection(name)
 }
 
-func (dbManager *mongodbManagerImp) AllProjects(startPosition, offset int) (model.ProjectList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllProjects(
+	ctx context.Context,
+	filter *model.ProjectFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.ProjectList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+
+	loggerObj := utils.ContextLogger(ctx)
+
+	query, err := dbManager.projectFilterQuery(filter, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	sorting, err := sortQuery(orderBy, projectSortFields, loggerObj)
+	if err != nil {
+		return nil, err
+	}
 
-	findOptions := options.Find()
+	findOptions := options.Find().SetSort(sorting)
 
 	if offset > 0 {
 		findOptions.SetLimit(int64(offset))
 	}
 
 	if startPosition > 0 {
-		findOptions.SetLimit(int64(startPosition))
+		findOptions.SetSkip(int64(startPosition))
 	}
 
 	collection := dbManager.collection(utils.PROJECTS_COLLECTION)
-	if cursor, err := collection.Find(context.TODO(), bson.D{}, findOptions); err != nil {
+	if cursor, err := collection.Find(ctx, notDeleted(ctx, query), findOptions); err != nil {
 		loggerObj.Error(err)
 		return nil, err
 	} else {
-		return dbManager.decodeBsonIntoProjectListModel(cursor, loggerObj)
+		return dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
 	}
 }
 
 func (dbManager *mongodbManagerImp) decodeBsonIntoProjectListModel(
+	ctx context.Context,
 	cursor *mongo.Cursor,
-	loggerObj *logger.Logger) (model.ProjectList, error) {
+	loggerObj *utils.Logger) (model.ProjectList, error) {
 
 	var projects model.ProjectList
-	ownerCache := map[primitive.ObjectID]*model.User{}
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		projectDb := &mdbProjectModel{}
 		if err := cursor.Decode(&projectDb); err != nil {
 			loggerObj.Error(err)
 			return nil, err
 		}
 
-		err := dbManager.updateUserCache(ownerCache, projectDb, loggerObj)
-		if err != nil {
-			return model.ProjectList{}, err
-		}
-
 		project := projectDb.toModel()
 		projects = append(projects, project)
 	}
 
-	return projects, nil
-}
-
-func (dbManager *mongodbManagerImp) updateUserCache(
-	userCache map[primitive.ObjectID]*model.User,
-	projectDb *mdbProjectModel,
-	loggerObj *logger.Logger) error {
-
-	if _, ok := userCache[projectDb.OwnerID]; !ok {
-		if owner, err := dbManager.GetUserByID(&mdbId{id: projectDb.OwnerID}); err != nil {
-			loggerObj.Error(err)
-			return err
-		} else {
-			userCache[projectDb.OwnerID] = owner
-		}
-
+	if err := cursor.Err(); err != nil {
+		loggerObj.Error(err)
+		return nil, err
 	}
-	return nil
+
+	return projects, nil
 }
 
-func (dbManager *mongodbManagerImp) CreateProject(project *model.Project) (*model.Project, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) CreateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	projectDb := &mdbProjectModel{}
 	if err := projectDb.initFromModel(project); err != nil {
 		return nil, err
-	}
-
-	if exists, err := dbManager.existsObject(projectDb.CustomerID, utils.CUSTOMERS_COLLECTION); err != nil {
-		return nil, err
-	} else if !exists {
-		err := errors.New("cannot create project with invalid customer id. CustomerID id doesn't exists")
-		loggerObj.Error(err)
-		return nil, err
+	} else if projectDb.OwnerID == nil {
+		const msg = "invalid project. Owner ID cannot be NULL"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	} else if projectDb.CustomerID == nil {
+		const msg = "invalid project. Customer ID cannot be NULL"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
 	}
 
 	collection := dbManager.collection(utils.PROJECTS_COLLECTION)
 	projectDb.ID = primitive.NewObjectID()
-	if result, err := collection.InsertOne(context.TODO(), projectDb); err != nil {
-		loggerObj.Error(err.Error())
+	projectDb.Version = 1
+
+	if err := dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := dbManager.validateProjectRefs(sessCtx, projectDb, nil); err != nil {
+			return err
+		} else if _, err = collection.InsertOne(sessCtx, projectDb); err != nil {
+			loggerObj.Error(err.Error())
+			return err
+		}
+
+		return dbManager.refreshCustomerProjects(sessCtx, *projectDb.CustomerID)
+	}); err != nil {
 		return nil, err
-	} else {
-		project.ID = &mdbId{id: result.InsertedID.(primitive.ObjectID)}
 	}
 
+	project.ID = &mdbId{id: projectDb.ID}
+	project.Version = projectDb.Version
 	return project, nil
 }
 
-func (dbManager *mongodbManagerImp) GetProject(projectId model.ID) (*model.Project, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) GetProject(ctx context.Context, projectId model.ID) (*model.Project, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	if projectId == nil {
+		const msg = "project id cannot be null"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
 
 	dbId, err := primitive.ObjectIDFromHex(projectId.ToString())
 	if err != nil {
@@ -529,13 +749,12 @@ func (dbManager *mongodbManagerImp) GetProject(projectId model.ID) (*model.Proje
 
 	collection := dbManager.collection(utils.PROJECTS_COLLECTION)
 
-	result := collection.FindOne(context.TODO(), bson.M{utils.PROJECT_ID_FIELD: dbId})
-	return dbManager.decodeBsonIntoProjectModel(result)
+	result := collection.FindOne(ctx, notDeleted(ctx, bson.M{utils.PROJECT_ID_FIELD: dbId}))
+	return dbManager.decodeBsonIntoProjectModel(ctx, result)
 }
 
-func (dbManager *mongodbManagerImp) decodeBsonIntoProjectModel(result *mongo.SingleResult) (*model.Project, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) decodeBsonIntoProjectModel(ctx context.Context, result *mongo.SingleResult) (*model.Project, error) {
+	loggerObj := utils.ContextLogger(ctx)
 
 	if result.Err() != nil {
 		loggerObj.Error(result.Err())
@@ -552,9 +771,10 @@ func (dbManager *mongodbManagerImp) decodeBsonIntoProjectModel(result *mongo.Sin
 	return project, nil
 }
 
-func (dbManager *mongodbManagerImp) UpdateProject(project *model.Project) (*model.Project, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	if project == nil || project.ID == nil {
 		const msg = "invalid project. Neither project object nor project ID can be NULL"
@@ -575,38 +795,454 @@ func (dbManager *mongodbManagerImp) UpdateProject(project *model.Project) (*mode
 		return nil, idErr
 	}
 
-	if result, err := collection.UpdateOne(context.TODO(),
-		bson.D{{utils.PROJECT_ID_FIELD, id}},
-		projectDb); err != nil {
-		loggerObj.Error(err)
-		return nil, err
-	} else {
-		if result.MatchedCount != 1 {
+	projectDb.Version = project.Version + 1
+	err := dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		// the project before the update tells which references changed and which customers must be refreshed
+		stored := &mdbProjectModel{}
+		if err := collection.FindOneAndReplace(sessCtx,
+			bson.M{
+				utils.PROJECT_ID_FIELD:      id,
+				utils.PROJECT_VERSION_FIELD: versionQuery(project.Version),
+				utils.DELETED_AT_FIELD:      nil,
+			},
+			projectDb).Decode(stored); err == mongo.ErrNoDocuments {
+			if exists, err := dbManager.existsObject(sessCtx, id, utils.PROJECTS_COLLECTION); err != nil {
+				return err
+			} else if exists {
+				loggerObj.Error(ErrVersionConflict)
+				return ErrVersionConflict
+			}
+
 			msg := fmt.Sprintf("Nothing to update. Project (%s) not found.", project.ID.ToString())
 			loggerObj.Errorf(msg)
-			return nil, errors.New(msg)
+			return errors.New(msg)
+		} else if err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if err = dbManager.validateProjectRefs(sessCtx, projectDb, stored); err != nil {
+			return err
+		}
+
+		customerIds := []primitive.ObjectID{}
+		for _, customerId := range []*primitive.ObjectID{stored.CustomerID, projectDb.CustomerID} {
+			if customerId != nil {
+				customerIds = append(customerIds, *customerId)
+			}
 		}
 
-		return project, nil
+		return dbManager.refreshCustomerProjects(sessCtx, customerIds...)
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	project.Version = projectDb.Version
+	return project, nil
 }
 
-func (dbManager *mongodbManagerImp) init() {
-	// users collection
-	if !dbManager.initiated {
-		dbManager.cache = make(map[cacheKey]interface{})
-		usersCollection := dbManager.collection(utils.USERS_COLLECTION)
-		usersCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
-			Keys:    bson.M{utils.USER_EMAIL_FIELD: 1},
-			Options: options.Index().SetUnique(true),
-		})
-		usersCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
-			Keys:    bson.M{utils.PROJECT_NAME_FIELD: 1, utils.PROJECT_OWNER_ID_FIELD: 1},
-			Options: options.Index().SetUnique(true),
-		})
+// GetPersistedQuery returns the query registered with the hash, or an empty string when there is none.
+func (dbManager *mongodbManagerImp) GetPersistedQuery(ctx context.Context, hash string) (string, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	queryDb := &mdbPersistedQueryModel{}
+	collection := dbManager.collection(utils.PERSISTED_QUERIES_COLLECTION)
+	result := collection.FindOne(ctx, bson.M{utils.PERSISTED_QUERY_HASH_FIELD: hash})
+	if err := result.Decode(queryDb); err == mongo.ErrNoDocuments {
+		return "", nil
+	} else if err != nil {
+		loggerObj.Error(err)
+		return "", err
+	}
+
+	return queryDb.Query, nil
+}
 
-		dbManager.initiated = true
+// SavePersistedQuery registers the query with its hash. Registering a hash again keeps the first query. The queries
+// expire PERSISTED_QUERIES_TTL_SECONDS after they were registered.
+func (dbManager *mongodbManagerImp) SavePersistedQuery(ctx context.Context, hash, query string) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	collection := dbManager.collection(utils.PERSISTED_QUERIES_COLLECTION)
+	if _, err := collection.UpdateOne(ctx,
+		bson.M{utils.PERSISTED_QUERY_HASH_FIELD: hash},
+		bson.M{"$setOnInsert": bson.M{
+			utils.PERSISTED_QUERY_QUERY_FIELD:      query,
+			utils.PERSISTED_QUERY_CREATED_AT_FIELD: time.Now(),
+		}},
+		options.Update().SetUpsert(true)); err != nil {
+		loggerObj.Error(err)
+		return err
 	}
+
+	return nil
+}
+
+// AddAuditEntry appends the entry to the audit log. The entries are never modified nor deleted.
+func (dbManager *mongodbManagerImp) AddAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	entryDb := &mdbAuditEntryModel{}
+	if err := entryDb.initFromModel(entry, loggerObj); err != nil {
+		return err
+	} else if _, err = dbManager.collection(utils.AUDIT_LOG_COLLECTION).InsertOne(ctx, entryDb); err != nil {
+		loggerObj.Error(err)
+		return err
+	}
+
+	entry.ID = &mdbId{id: entryDb.ID}
+	return nil
+}
+
+// AuditLog returns the entries of the filter in chronological order.
+func (dbManager *mongodbManagerImp) AuditLog(ctx context.Context, filter *model.AuditFilter) (model.AuditEntryList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	query, err := dbManager.auditFilterQuery(filter, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{
+		{Key: utils.AUDIT_TIMESTAMP_FIELD, Value: 1},
+		{Key: utils.AUDIT_ID_FIELD, Value: 1},
+	})
+	cursor, err := dbManager.collection(utils.AUDIT_LOG_COLLECTION).Find(ctx, query, findOptions)
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	result := model.AuditEntryList{}
+	for cursor.Next(ctx) {
+		entryDb := &mdbAuditEntryModel{}
+		if err := cursor.Decode(entryDb); err != nil {
+			loggerObj.Error(err)
+			return nil, err
+		}
+		result = append(result, entryDb.toModel())
+	}
+
+	if err := cursor.Err(); err != nil {
+		// the request was cancelled or the operation timed out
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RestoreProject clears the deleted date of a deleted project and returns it.
+func (dbManager *mongodbManagerImp) RestoreProject(ctx context.Context, projectId model.ID) (*model.Project, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	id, err := dbManager.modelIDtoMongoID(projectId, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDb := &mdbProjectModel{}
+	if err = dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		if err := dbManager.restoreDocument(sessCtx, utils.PROJECTS_COLLECTION, id).Decode(projectDb); err == mongo.ErrNoDocuments {
+			msg := fmt.Sprintf("deleted project id %s not found", projectId.ToString())
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		} else if err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if err = dbManager.validateProjectRefs(sessCtx, projectDb, nil); err != nil {
+			return err
+		} else if projectDb.CustomerID != nil {
+			return dbManager.refreshCustomerProjects(sessCtx, *projectDb.CustomerID)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return projectDb.toModel(), nil
+}
+
+// RestoreCustomer clears the deleted date of a deleted customer and returns it. The projects deleted with the customer
+// by the cascade delete rule are restored too, unless their owner is deleted.
+func (dbManager *mongodbManagerImp) RestoreCustomer(ctx context.Context, customerId model.ID) (*model.Customer, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	id, err := dbManager.modelIDtoMongoID(customerId, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var customer *model.Customer
+	collection := dbManager.collection(utils.CUSTOMERS_COLLECTION)
+	if err = dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		deleted := &mdbCustomerModel{}
+		if err := collection.FindOne(sessCtx,
+			bson.M{utils.CUSTOMER_ID_FIELD: id, utils.DELETED_AT_FIELD: bson.M{"$ne": nil}}).Decode(deleted); err == mongo.ErrNoDocuments {
+			msg := fmt.Sprintf("deleted customer id %s not found", customerId.ToString())
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		} else if err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if err = dbManager.restoreDocument(sessCtx, utils.CUSTOMERS_COLLECTION, id).Err(); err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if err = dbManager.restoreCascadedProjects(sessCtx, id, *deleted.DeletedAt); err != nil {
+			return err
+		} else if err = dbManager.refreshCustomerProjects(sessCtx, id); err != nil {
+			return err
+		}
+
+		customer, err = dbManager.decodeBsonIntoCustomerModel(
+			collection.FindOne(sessCtx, bson.M{utils.CUSTOMER_ID_FIELD: id}), loggerObj)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// restoreCascadedProjects restores the projects of the customer deleted with it, which have its deleted date, unless
+// their owner is deleted.
+func (dbManager *mongodbManagerImp) restoreCascadedProjects(
+	ctx context.Context,
+	customerId primitive.ObjectID,
+	deletedAt primitive.DateTime) error {
+
+	loggerObj := utils.ContextLogger(ctx)
+	collection := dbManager.collection(utils.PROJECTS_COLLECTION)
+
+	cursor, err := collection.Find(ctx, bson.M{
+		utils.PROJECT_CUSTOMER_ID_FIELD: customerId,
+		utils.DELETED_AT_FIELD:          deletedAt,
+	})
+	if err != nil {
+		loggerObj.Error(err)
+		return err
+	}
+
+	projects := mdbProjectListModel{}
+	if err = cursor.All(ctx, &projects); err != nil {
+		loggerObj.Error(err)
+		return err
+	}
+
+	projectIds := []primitive.ObjectID{}
+	for _, projectDb := range projects {
+		if valid, err := dbManager.validReference(ctx, projectDb.OwnerID, utils.USERS_COLLECTION); err != nil {
+			return err
+		} else if valid {
+			projectIds = append(projectIds, projectDb.ID)
+		}
+	}
+
+	if len(projectIds) > 0 {
+		if _, err = collection.UpdateMany(ctx,
+			bson.M{utils.PROJECT_ID_FIELD: bson.M{"$in": projectIds}},
+			bson.M{"$unset": bson.M{utils.DELETED_AT_FIELD: ""}}); err != nil {
+			loggerObj.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreDocument unsets the deleted date of the document, when it is deleted, and returns the restored document.
+func (dbManager *mongodbManagerImp) restoreDocument(
+	ctx context.Context,
+	collectionName string,
+	id primitive.ObjectID) *mongo.SingleResult {
+
+	return dbManager.collection(collectionName).FindOneAndUpdate(ctx,
+		bson.M{"_id": id, utils.DELETED_AT_FIELD: bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{utils.DELETED_AT_FIELD: ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After))
+}
+
+// PurgeDeleted removes permanently the users, projects and customers deleted before the date, and returns how many
+// were removed.
+func (dbManager *mongodbManagerImp) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	query := bson.M{utils.DELETED_AT_FIELD: bson.M{"$lt": primitive.NewDateTimeFromTime(deletedBefore)}}
+
+	var count int64
+	for _, name := range []string{utils.USERS_COLLECTION, utils.PROJECTS_COLLECTION, utils.CUSTOMERS_COLLECTION} {
+		if result, err := dbManager.collection(name).DeleteMany(ctx, query); err != nil {
+			loggerObj.Error(err)
+			return count, err
+		} else {
+			count += result.DeletedCount
+		}
+	}
+
+	return count, nil
+}
+
+// RefreshCustomerProjects rebuilds the project list of the customers from the projects that reference them and are
+// not deleted. The lists are kept by the writes of the projects, so this is only needed to repair the data written
+// before they were.
+func (dbManager *mongodbManagerImp) RefreshCustomerProjects(ctx context.Context, customerIds model.IDList) error {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	dbIds, err := dbManager.modelIDsToMongoIDs(customerIds, loggerObj)
+	if err != nil {
+		return err
+	}
+
+	return dbManager.refreshCustomerProjects(ctx, dbIds...)
+}
+
+// MergeUsers moves the projects of the duplicates to the user kept, deletes the duplicates and writes email in the
+// user kept, all in a transaction. It returns the projects moved as they were before the move.
+func (dbManager *mongodbManagerImp) MergeUsers(
+	ctx context.Context,
+	keptId model.ID,
+	duplicateIds model.IDList,
+	email string) (model.ProjectList, error) {
+
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	id, err := dbManager.modelIDtoMongoID(keptId, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	dbIds, err := dbManager.modelIDsToMongoIDs(duplicateIds, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	users := dbManager.collection(utils.USERS_COLLECTION)
+	projects := dbManager.collection(utils.PROJECTS_COLLECTION)
+
+	var moved model.ProjectList
+	err = dbManager.withTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		owned := bson.M{utils.PROJECT_OWNER_ID_FIELD: bson.M{"$in": dbIds}, utils.DELETED_AT_FIELD: nil}
+		cursor, err := projects.Find(sessCtx, owned)
+		if err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if moved, err = dbManager.decodeBsonIntoProjectListModel(sessCtx, cursor, loggerObj); err != nil {
+			return err
+		} else if _, err = projects.UpdateMany(sessCtx, owned,
+			bson.M{"$set": bson.M{utils.PROJECT_OWNER_ID_FIELD: id}, "$inc": bson.M{utils.PROJECT_VERSION_FIELD: 1}}); err != nil {
+			loggerObj.Error(err)
+			return err
+		}
+
+		// the emails of the deleted users are still unique, so the duplicate with the new email must release it
+		released := &mdbUserModel{}
+		if err = users.FindOne(sessCtx,
+			bson.M{utils.USER_ID_FIELD: bson.M{"$in": dbIds}, utils.USER_EMAIL_FIELD: email}).Decode(released); err == nil {
+			if _, err = users.UpdateOne(sessCtx, bson.M{utils.USER_ID_FIELD: released.ID},
+				bson.M{"$set": bson.M{utils.USER_EMAIL_FIELD: mergedUserEmail(email, released.ID.Hex())}}); err != nil {
+				loggerObj.Error(err)
+				return err
+			}
+		} else if err != mongo.ErrNoDocuments {
+			loggerObj.Error(err)
+			return err
+		}
+
+		if result, err := users.UpdateMany(sessCtx,
+			bson.M{utils.USER_ID_FIELD: bson.M{"$in": dbIds}, utils.DELETED_AT_FIELD: nil},
+			markDeleted(time.Now().UTC())); err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if result.MatchedCount != int64(len(dbIds)) {
+			const msg = "cannot merge users. A duplicate user was not found"
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		}
+
+		if result, err := users.UpdateOne(sessCtx,
+			bson.M{utils.USER_ID_FIELD: id, utils.DELETED_AT_FIELD: nil},
+			bson.M{"$set": bson.M{utils.USER_EMAIL_FIELD: email}}); err != nil {
+			loggerObj.Error(err)
+			return err
+		} else if result.MatchedCount != 1 {
+			msg := fmt.Sprintf("cannot merge users. User (%s) not found", keptId.ToString())
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+// init creates the indexes of the collections the first time the database is opened. Creating an index that already
+// exists does nothing, but an index that cannot be created, like a unique index over duplicated values, fails the
+// open instead of leaving the queries without it.
+func (dbManager *mongodbManagerImp) init() error {
+	if dbManager.initiated {
+		return nil
+	}
+
+	loggerObj := utils.LoggerObj()
+	dbManager.cache = make(map[cacheKey]interface{})
+
+	indexes := []struct {
+		collection string
+		models     []mongo.IndexModel
+	}{
+		{utils.USERS_COLLECTION, userIndexes},
+		{utils.PROJECTS_COLLECTION, projectIndexes},
+		{utils.CUSTOMERS_COLLECTION, customerIndexes},
+		{utils.AUDIT_LOG_COLLECTION, auditIndexes},
+		{utils.PERSISTED_QUERIES_COLLECTION, persistedQueryIndexes},
+	}
+
+	for _, index := range indexes {
+		if _, err := dbManager.collection(index.collection).Indexes().CreateMany(context.TODO(), index.models); err != nil {
+			loggerObj.Errorf("cannot create the indexes of the %s collection: %s", index.collection, err.Error())
+			return err
+		}
+	}
+
+	for _, index := range obsoleteIndexes {
+		if _, err := dbManager.collection(index.collection).Indexes().DropOne(context.TODO(), index.name); err != nil &&
+			!isNotFoundError(err) {
+			loggerObj.Errorf("cannot drop the index %s of the %s collection: %s", index.name, index.collection, err.Error())
+			return err
+		}
+	}
+
+	dbManager.initiated = true
+	return nil
+}
+
+// isNotFoundError returns whether the command failed because the collection or the index does not exist.
+func isNotFoundError(err error) bool {
+	commandErr, ok := err.(mongo.CommandError)
+	return ok && (commandErr.Code == namespaceNotFoundCode || commandErr.Code == indexNotFoundCode)
 }
 
 func (dbManager *mongodbManagerImp) Close() error {
@@ -621,14 +1257,32 @@ func (dbManager *mongodbManagerImp) Close() error {
 	return err
 }
 
+// Ping checks that the primary of the cluster answers.
+func (dbManager *mongodbManagerImp) Ping(ctx context.Context) error {
+	if !dbManager.isOpen {
+		return errors.New("database is not open")
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return dbManager.client.Ping(ctx, readpref.Primary())
+}
+
 func (dbManager *mongodbManagerImp) IsOpen() bool {
 	return dbManager.isOpen
 }
 
-func (dbManager *mongodbManagerImp) RegisterNewUser(user *model.User) (*model.User, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
-	findUser, err := dbManager.GetUserByEmail(user.Email)
+func (dbManager *mongodbManagerImp) RegisterNewUser(ctx context.Context, user *model.User) (*model.User, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+	// the email of a deleted user is taken until the user is purged
+	user.Email = model.NormalizeEmail(user.Email)
+	findUser, err := dbManager.GetUserByEmail(WithDeleted(ctx), user.Email)
 
 	if err != nil {
 		loggerObj.Info(err)
@@ -641,7 +1295,7 @@ func (dbManager *mongodbManagerImp) RegisterNewUser(user *model.User) (*model.Us
 		userDB.initFromModel(user)
 		userDB.ID = primitive.NewObjectID()
 
-		if result, err := collection.InsertOne(context.TODO(), userDB); err != nil {
+		if result, err := collection.InsertOne(ctx, userDB); err != nil {
 			loggerObj.Error(err.Error())
 			return nil, err
 		} else {
@@ -656,28 +1310,38 @@ func (dbManager *mongodbManagerImp) RegisterNewUser(user *model.User) (*model.Us
 	return nil, errors.New(msg)
 }
 
-func (dbManager *mongodbManagerImp) GetUserByEmail(email string) (*model.User, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
-
-	collection := dbManager.collection(utils.USERS_COLLECTION)
-	query := &bson.M{
-		utils.USER_EMAIL_FIELD: email,
-	}
-
-	result := collection.FindOne(context.TODO(), query)
+func (dbManager *mongodbManagerImp) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
+	result := dbManager.findUserByEmail(ctx, email, notDeleted(ctx, bson.M{}))
 	if result.Err() != nil {
 		loggerObj.Error(result.Err().Error())
 		return nil, result.Err()
 	}
 
-	return dbManager.decodeBsonIntoUserModel(result)
+	return dbManager.decodeBsonIntoUserModel(ctx, result)
 }
 
-func (dbManager *mongodbManagerImp) GetUserByID(id model.ID) (*model.User, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+// findUserByEmail finds the user of the query with the email, ignoring the letter case. The emails registered before
+// they were stored in lower case can still differ only in case until check --fix merges them, so the email written
+// exactly is looked up first.
+func (dbManager *mongodbManagerImp) findUserByEmail(ctx context.Context, email string, query bson.M) *mongo.SingleResult {
+	collection := dbManager.collection(utils.USERS_COLLECTION)
+
+	query[utils.USER_EMAIL_FIELD] = email
+	if result := collection.FindOne(ctx, query); result.Err() != mongo.ErrNoDocuments {
+		return result
+	}
+
+	return collection.FindOne(ctx, query, options.FindOne().SetCollation(emailCollation))
+}
+
+func (dbManager *mongodbManagerImp) GetUserByID(ctx context.Context, id model.ID) (*model.User, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
 
 	dbId, err := dbManager.modelIDtoMongoID(id, loggerObj)
 
@@ -687,19 +1351,18 @@ func (dbManager *mongodbManagerImp) GetUserByID(id model.ID) (*model.User, error
 	}
 
 	collection := dbManager.collection(utils.USERS_COLLECTION)
-	result := collection.FindOne(context.TODO(), bson.M{utils.USER_ID_FIELD: dbId})
+	result := collection.FindOne(ctx, notDeleted(ctx, bson.M{utils.USER_ID_FIELD: dbId}))
 
 	if result.Err() != nil {
-		loggerObj.Error(err)
-		return nil, err
+		loggerObj.Error(result.Err())
+		return nil, result.Err()
 	}
 
-	return dbManager.decodeBsonIntoUserModel(result)
+	return dbManager.decodeBsonIntoUserModel(ctx, result)
 }
 
-func (dbManager *mongodbManagerImp) decodeBsonIntoUserModel(result *mongo.SingleResult) (*model.User, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) decodeBsonIntoUserModel(ctx context.Context, result *mongo.SingleResult) (*model.User, error) {
+	loggerObj := utils.ContextLogger(ctx)
 
 	if result.Err() != nil {
 		loggerObj.Error(result.Err())
@@ -719,18 +1382,28 @@ func (dbManager *mongodbManagerImp) Open() error {
 	var err error
 	dbManager.client, err = mongo.Connect(context.TODO(), dbManager.clientOptions)
 
-	if err == nil {
-		dbManager.isOpen = true
-		dbManager.db = dbManager.client.Database(settings.SettingsObj().DBSettingsValues().DbName())
-		dbManager.init()
+	if err != nil {
+		return err
+	}
+
+	dbManager.isOpen = true
+	dbManager.db = dbManager.client.Database(settings.SettingsObj().DBSettingsValues().DbName())
+	if err = dbManager.init(); err != nil {
+		dbManager.Close()
 	}
 
 	return err
 }
 
-func (dbManager *mongodbManagerImp) AllUsers(startPosition, offset int) (model.UserList, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (dbManager *mongodbManagerImp) AllUsers(
+	ctx context.Context,
+	filter *model.UserFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.UserList, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+
+	loggerObj := utils.ContextLogger(ctx)
 
 	if startPosition < 0 {
 		const msg = "start position cannot be zero or a negative number"
@@ -738,7 +1411,12 @@ func (dbManager *mongodbManagerImp) AllUsers(startPosition, offset int) (model.U
 		return nil, errors.New(msg)
 	}
 
-	findOptions := options.Find()
+	sorting, err := sortQuery(orderBy, userSortFields, loggerObj)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(sorting)
 
 	if offset > 0 {
 		findOptions.SetLimit(int64(offset))
@@ -749,20 +1427,24 @@ func (dbManager *mongodbManagerImp) AllUsers(startPosition, offset int) (model.U
 	}
 
 	collection := dbManager.collection(utils.USERS_COLLECTION)
-	cursor, err := collection.Find(context.TODO(), bson.D{}, findOptions)
+	cursor, err := collection.Find(ctx, notDeleted(ctx, userFilterQuery(filter)), findOptions)
 
 	if err != nil {
 		loggerObj.Error(fmt.Sprintf("%s", err))
 		return nil, err
 	}
 
-	return dbManager.decodeBsonIntoUserListModel(cursor, loggerObj)
+	return dbManager.decodeBsonIntoUserListModel(ctx, cursor, loggerObj)
 }
 
-func (dbManager *mongodbManagerImp) decodeBsonIntoUserListModel(cursor *mongo.Cursor, loggerObj *logger.Logger) (model.UserList, error) {
+func (dbManager *mongodbManagerImp) decodeBsonIntoUserListModel(
+	ctx context.Context,
+	cursor *mongo.Cursor,
+	loggerObj *utils.Logger) (model.UserList, error) {
+
 	var users model.UserList
 
-	for cursor.Next(context.TODO()) {
+	for cursor.Next(ctx) {
 		userDb := &mdbUserModel{}
 		if err := cursor.Decode(&userDb); err != nil {
 			loggerObj.Error(err.Error())
@@ -773,9 +1455,181 @@ func (dbManager *mongodbManagerImp) decodeBsonIntoUserListModel(cursor *mongo.Cu
 		users = append(users, user)
 	}
 
+	if err := cursor.Err(); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
 	return users, nil
 }
 
+func (dbManager *mongodbManagerImp) UsersPage(ctx context.Context, page *model.PageRequest) (model.UserList, *model.PageInfo, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	filter, findOptions, err := dbManager.keysetQuery(page, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cursor, err := dbManager.collection(utils.USERS_COLLECTION).Find(ctx, notDeleted(ctx, filter), findOptions)
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, nil, err
+	}
+
+	users, err := dbManager.decodeBsonIntoUserListModel(ctx, cursor, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end, pageInfo := keysetWindow(page, len(users))
+	users = users[:end]
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.ToString() < users[j].ID.ToString() })
+
+	return users, pageInfo, nil
+}
+
+func (dbManager *mongodbManagerImp) ProjectsPage(ctx context.Context, page *model.PageRequest) (model.ProjectList, *model.PageInfo, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	filter, findOptions, err := dbManager.keysetQuery(page, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cursor, err := dbManager.collection(utils.PROJECTS_COLLECTION).Find(ctx, notDeleted(ctx, filter), findOptions)
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, nil, err
+	}
+
+	projects, err := dbManager.decodeBsonIntoProjectListModel(ctx, cursor, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end, pageInfo := keysetWindow(page, len(projects))
+	projects = projects[:end]
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID.ToString() < projects[j].ID.ToString() })
+
+	return projects, pageInfo, nil
+}
+
+func (dbManager *mongodbManagerImp) CustomersPage(ctx context.Context, page *model.PageRequest) (model.CustomerList, *model.PageInfo, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	filter, findOptions, err := dbManager.keysetQuery(page, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cursor, err := dbManager.collection(utils.CUSTOMERS_COLLECTION).Find(ctx, notDeleted(ctx, filter), findOptions)
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, nil, err
+	}
+
+	customers, err := dbManager.decodeBsonIntoCustomerListModel(ctx, cursor, loggerObj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end, pageInfo := keysetWindow(page, len(customers))
+	customers = customers[:end]
+	sort.Slice(customers, func(i, j int) bool { return customers[i].ID.ToString() < customers[j].ID.ToString() })
+
+	return customers, pageInfo, nil
+}
+
+func (dbManager *mongodbManagerImp) CountUsers(ctx context.Context) (int64, error) {
+	return dbManager.count(ctx, utils.USERS_COLLECTION)
+}
+
+func (dbManager *mongodbManagerImp) CountProjects(ctx context.Context) (int64, error) {
+	return dbManager.count(ctx, utils.PROJECTS_COLLECTION)
+}
+
+func (dbManager *mongodbManagerImp) CountCustomers(ctx context.Context) (int64, error) {
+	return dbManager.count(ctx, utils.CUSTOMERS_COLLECTION)
+}
+
+func (dbManager *mongodbManagerImp) count(ctx context.Context, collectionName string) (int64, error) {
+	ctx, cancel := dbManager.operationContext(ctx)
+	defer cancel()
+	loggerObj := utils.ContextLogger(ctx)
+
+	count, err := dbManager.collection(collectionName).CountDocuments(ctx, notDeleted(ctx, bson.M{}))
+	if err != nil {
+		loggerObj.Error(err)
+	}
+
+	return count, err
+}
+
+// keysetQuery builds the filter and the options to read a page of documents ordered by _id, without using skip. One
+// extra document is requested to know whether there are more documents after the page. Pages taken from the end
+// (Last) are read in descending order.
+func (dbManager *mongodbManagerImp) keysetQuery(
+	page *model.PageRequest,
+	loggerObj *utils.Logger) (bson.M, *options.FindOptions, error) {
+
+	idFilter := bson.M{}
+
+	if page.After != nil {
+		if id, err := dbManager.modelIDtoMongoID(page.After, loggerObj); err != nil {
+			return nil, nil, err
+		} else {
+			idFilter["$gt"] = id
+		}
+	}
+
+	if page.Before != nil {
+		if id, err := dbManager.modelIDtoMongoID(page.Before, loggerObj); err != nil {
+			return nil, nil, err
+		} else {
+			idFilter["$lt"] = id
+		}
+	}
+
+	filter := bson.M{}
+	if len(idFilter) > 0 {
+		filter["_id"] = idFilter
+	}
+
+	findOptions := options.Find().SetSort(bson.M{"_id": 1})
+	if page.First > 0 {
+		findOptions.SetLimit(int64(page.First + 1))
+	} else if page.Last > 0 {
+		findOptions.SetSort(bson.M{"_id": -1}).SetLimit(int64(page.Last + 1))
+	}
+
+	return filter, findOptions, nil
+}
+
+// keysetWindow returns how many of the documents read by keysetQuery belong to the page, and the page info.
+func keysetWindow(page *model.PageRequest, count int) (int, *model.PageInfo) {
+	pageInfo := &model.PageInfo{
+		HasNextPage:     page.Before != nil,
+		HasPreviousPage: page.After != nil,
+	}
+
+	if page.First > 0 && count > page.First {
+		pageInfo.HasNextPage = true
+		count = page.First
+	} else if page.First == 0 && page.Last > 0 && count > page.Last {
+		pageInfo.HasPreviousPage = true
+		count = page.Last
+	}
+
+	return count, pageInfo
+}
+
 func (dbManager *mongodbManagerImp) mongoIdToModelID(id primitive.ObjectID) model.ID {
 	return &mdbId{id: id}
 }
@@ -792,11 +1646,15 @@ func createMongoDbManagerForTesting(connectionString string) *mongodbManagerImp
 }
 
 func createMongoDbManager() DBManager {
+	clientOptions := options.Client().ApplyURI(settings.SettingsObj().DBSettingsValues().ConnectionString())
 	manager := &mongodbManagerImp{
 		isOpen:        false,
 		client:        nil,
-		clientOptions: options.Client().ApplyURI(settings.SettingsObj().DBSettingsValues().ConnectionString()),
+		clientOptions: clientOptions.SetMonitor(newCommandMonitor()),
 		initiated:     false,
+
+		operationTimeout: settings.SettingsObj().DBSettingsValues().OperationTimeout(),
+		rules:            deleteRulesFromSettings(),
 	}
 
 	return manager
@@ -0,0 +1,74 @@
+package dbmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/freddy311082/picnic-server/metrics"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var mongoOperationDuration = metrics.NewHistogram(
+	"picnic_mongodb_operation_duration_seconds",
+	"Duration of the MongoDB commands per collection.",
+	metrics.DefaultBuckets,
+	"collection", "command")
+
+var mongoOperationErrors = metrics.NewCounter(
+	"picnic_mongodb_operation_errors_total",
+	"MongoDB commands that failed per collection.",
+	"collection", "command")
+
+// commandMetrics times the commands sent to MongoDB. The driver reports the collection only when a command starts,
+// so it is kept until the command finishes.
+type commandMetrics struct {
+	mutex       sync.Mutex
+	collections map[int64]string
+}
+
+func newCommandMonitor() *event.CommandMonitor {
+	commands := &commandMetrics{collections: map[int64]string{}}
+
+	return &event.CommandMonitor{
+		Started: commands.started,
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			commands.finished(&evt.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			commands.finished(&evt.CommandFinishedEvent, true)
+		},
+	}
+}
+
+func (commands *commandMetrics) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	// the collection is the value of the command name, except in getMore commands
+	collectionKey := evt.CommandName
+	if evt.CommandName == "getMore" {
+		collectionKey = "collection"
+	}
+
+	if collection, ok := evt.Command.Lookup(collectionKey).StringValueOK(); ok {
+		commands.mutex.Lock()
+		commands.collections[evt.RequestID] = collection
+		commands.mutex.Unlock()
+	}
+}
+
+func (commands *commandMetrics) finished(evt *event.CommandFinishedEvent, failed bool) {
+	commands.mutex.Lock()
+	collection, ok := commands.collections[evt.RequestID]
+	delete(commands.collections, evt.RequestID)
+	commands.mutex.Unlock()
+
+	if !ok {
+		// commands that are not sent to a collection, like ping
+		return
+	}
+
+	mongoOperationDuration.Observe(
+		(time.Duration(evt.DurationNanos) * time.Nanosecond).Seconds(), collection, evt.CommandName)
+	if failed {
+		mongoOperationErrors.Inc(collection, evt.CommandName)
+	}
+}
@@ -0,0 +1,254 @@
+package dbmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sort fields accepted by every collection, translated to the document fields.
+var userSortFields = map[string]string{
+	utils.SORT_FIELD_ID:       utils.USER_ID_FIELD,
+	utils.SORT_FIELD_NAME:     utils.USER_NAME_FIELD,
+	utils.SORT_FIELD_LASTNAME: utils.USER_LASTNAME_FIELD,
+	utils.SORT_FIELD_EMAIL:    utils.USER_EMAIL_FIELD,
+}
+
+var projectSortFields = map[string]string{
+	utils.SORT_FIELD_ID:         utils.PROJECT_ID_FIELD,
+	utils.SORT_FIELD_NAME:       utils.PROJECT_NAME_FIELD,
+	utils.SORT_FIELD_CREATED_AT: utils.PROJECT_CREATED_AT_FIELD,
+}
+
+var customerSortFields = map[string]string{
+	utils.SORT_FIELD_ID:   utils.CUSTOMER_ID_FIELD,
+	utils.SORT_FIELD_NAME: utils.CUSTOMER_NAME_FIELD,
+	utils.SORT_FIELD_CUIT: utils.CUSTOMER_CUIT_FIELD,
+}
+
+// emailCollation compares the emails ignoring the letter case. The emails are stored in lower case, but the ones
+// registered before can differ only in case.
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// Indexes used by the filters and the sort fields. Substring searches are case insensitive regular expressions, so
+// MongoDB scans the index of the field instead of the documents, but it cannot seek into it. The deleted_at indexes
+// are used by the purge of the deleted documents. The email lookups ignore the letter case, which needs an index with
+// the same collation.
+var userIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: utils.USER_EMAIL_FIELD, Value: 1}}, Options: options.Index().SetUnique(true)},
+	{
+		Keys:    bson.D{{Key: utils.USER_EMAIL_FIELD, Value: 1}},
+		Options: options.Index().SetName("email_case_insensitive").SetCollation(emailCollation),
+	},
+	{Keys: bson.D{{Key: utils.USER_NAME_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.USER_LASTNAME_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.DELETED_AT_FIELD, Value: 1}}},
+}
+
+var projectIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: utils.PROJECT_NAME_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.PROJECT_CREATED_AT_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.PROJECT_OWNER_ID_FIELD, Value: 1}, {Key: utils.PROJECT_CREATED_AT_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.PROJECT_CUSTOMER_ID_FIELD, Value: 1}, {Key: utils.PROJECT_CREATED_AT_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.DELETED_AT_FIELD, Value: 1}}},
+}
+
+var customerIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: utils.CUSTOMER_NAME_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.CUSTOMER_CUIT_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.DELETED_AT_FIELD, Value: 1}}},
+}
+
+// Indexes created by previous versions that must not exist anymore. Project names were unique per owner, which kept
+// the names of the deleted projects taken and failed the updates that move projects between owners.
+var obsoleteIndexes = []struct {
+	collection string
+	name       string
+}{
+	{utils.USERS_COLLECTION, "name_1_owner_id_1"},
+	{utils.PROJECTS_COLLECTION, "name_1_owner_id_1"},
+}
+
+// The registered queries expire, so the queries that clients stop sending do not pile up.
+var persistedQueryIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: utils.PERSISTED_QUERY_CREATED_AT_FIELD, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(utils.PERSISTED_QUERIES_TTL_SECONDS),
+	},
+}
+
+// The history of an entity and the audit log of a period are read in chronological order.
+var auditIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: utils.AUDIT_ENTITY_ID_FIELD, Value: 1}, {Key: utils.AUDIT_TIMESTAMP_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.AUDIT_ENTITY_TYPE_FIELD, Value: 1}, {Key: utils.AUDIT_TIMESTAMP_FIELD, Value: 1}}},
+	{Keys: bson.D{{Key: utils.AUDIT_TIMESTAMP_FIELD, Value: 1}}},
+}
+
+// notDeleted adds to the query the condition that excludes the deleted documents, unless the context includes them.
+// Documents that are not deleted have no deleted_at field.
+func notDeleted(ctx context.Context, query bson.M) bson.M {
+	if !includesDeleted(ctx) {
+		query[utils.DELETED_AT_FIELD] = nil
+	}
+
+	return query
+}
+
+// versionQuery matches the documents with the version. The documents written before the versions were introduced have
+// no version field, which is read as 0.
+func versionQuery(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+
+	return version
+}
+
+// markDeleted is the update that soft deletes the documents. The documents deleted together, like the projects deleted
+// with their customer, get the same date.
+func markDeleted(deletedAt time.Time) bson.M {
+	return bson.M{"$set": bson.M{utils.DELETED_AT_FIELD: primitive.NewDateTimeFromTime(deletedAt)}}
+}
+
+func containsRegex(value string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}
+}
+
+func userFilterQuery(filter *model.UserFilter) bson.M {
+	if filter == nil || filter.Search == "" {
+		return bson.M{}
+	}
+
+	search := containsRegex(filter.Search)
+	return bson.M{"$or": bson.A{
+		bson.M{utils.USER_NAME_FIELD: search},
+		bson.M{utils.USER_LASTNAME_FIELD: search},
+		bson.M{utils.USER_EMAIL_FIELD: search},
+	}}
+}
+
+func customerFilterQuery(filter *model.CustomerFilter) bson.M {
+	if filter == nil || filter.Search == "" {
+		return bson.M{}
+	}
+
+	search := containsRegex(filter.Search)
+	return bson.M{"$or": bson.A{
+		bson.M{utils.CUSTOMER_NAME_FIELD: search},
+		bson.M{utils.CUSTOMER_CUIT_FIELD: search},
+	}}
+}
+
+func (dbManager *mongodbManagerImp) projectFilterQuery(
+	filter *model.ProjectFilter,
+	loggerObj *utils.Logger) (bson.M, error) {
+
+	query := bson.M{}
+	if filter == nil {
+		return query, nil
+	}
+
+	if filter.NameContains != "" {
+		query[utils.PROJECT_NAME_FIELD] = containsRegex(filter.NameContains)
+	}
+
+	if filter.CustomerID != nil {
+		if id, err := dbManager.modelIDtoMongoID(filter.CustomerID, loggerObj); err != nil {
+			return nil, err
+		} else {
+			query[utils.PROJECT_CUSTOMER_ID_FIELD] = id
+		}
+	}
+
+	if filter.OwnerID != nil {
+		if id, err := dbManager.modelIDtoMongoID(filter.OwnerID, loggerObj); err != nil {
+			return nil, err
+		} else {
+			query[utils.PROJECT_OWNER_ID_FIELD] = id
+		}
+	}
+
+	createdAt := bson.M{}
+	if !filter.CreatedAfter.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(filter.CreatedBefore)
+	}
+	if len(createdAt) > 0 {
+		query[utils.PROJECT_CREATED_AT_FIELD] = createdAt
+	}
+
+	return query, nil
+}
+
+func (dbManager *mongodbManagerImp) auditFilterQuery(
+	filter *model.AuditFilter,
+	loggerObj *utils.Logger) (bson.M, error) {
+
+	query := bson.M{}
+	if filter == nil {
+		return query, nil
+	}
+
+	if len(filter.EntityIDs) > 0 {
+		if ids, err := dbManager.modelIDsToMongoIDs(filter.EntityIDs, loggerObj); err != nil {
+			return nil, err
+		} else {
+			query[utils.AUDIT_ENTITY_ID_FIELD] = bson.M{"$in": ids}
+		}
+	}
+
+	if filter.EntityType != nil {
+		query[utils.AUDIT_ENTITY_TYPE_FIELD] = auditEntityTypesToMongo[*filter.EntityType]
+	}
+
+	timestamp := bson.M{}
+	if !filter.Since.IsZero() {
+		timestamp["$gte"] = primitive.NewDateTimeFromTime(filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		timestamp["$lt"] = primitive.NewDateTimeFromTime(filter.Until)
+	}
+	if len(timestamp) > 0 {
+		query[utils.AUDIT_TIMESTAMP_FIELD] = timestamp
+	}
+
+	return query, nil
+}
+
+// sortQuery translates an OrderBy into a MongoDB sort document. _id is always the last key, so documents with the
+// same value keep the same order between requests.
+func sortQuery(orderBy *model.OrderBy, fields map[string]string, loggerObj *utils.Logger) (bson.D, error) {
+	if orderBy == nil {
+		return bson.D{{Key: "_id", Value: 1}}, nil
+	}
+
+	field, ok := fields[orderBy.Field]
+	if !ok {
+		msg := fmt.Sprintf("cannot sort by %s", orderBy.Field)
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
+
+	direction := 1
+	if orderBy.Direction == utils.SORT_DESC {
+		direction = -1
+	}
+
+	result := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		result = append(result, bson.E{Key: "_id", Value: direction})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,226 @@
+package dbmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// withTransaction runs fn in a transaction, so the documents it writes in several collections are written together
+// or not at all. fn must run its operations with the session context it receives, and it is run again when the
+// transaction fails with a transient error. Transactions need a replica set or a sharded cluster.
+func (dbManager *mongodbManagerImp) withTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error) error {
+	loggerObj := utils.ContextLogger(ctx)
+
+	session, err := dbManager.client.StartSession()
+	if err != nil {
+		loggerObj.Error(err)
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// referencingProjects returns the ids of the projects that are not deleted and whose field is id.
+func (dbManager *mongodbManagerImp) referencingProjects(
+	ctx context.Context,
+	field string,
+	id primitive.ObjectID) ([]primitive.ObjectID, error) {
+
+	loggerObj := utils.ContextLogger(ctx)
+
+	cursor, err := dbManager.collection(utils.PROJECTS_COLLECTION).Find(ctx,
+		bson.M{field: id, utils.DELETED_AT_FIELD: nil},
+		options.Find().SetProjection(bson.M{utils.PROJECT_ID_FIELD: 1}))
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		projectDb := &mdbProjectModel{}
+		if err := cursor.Decode(projectDb); err != nil {
+			loggerObj.Error(err)
+			return nil, err
+		}
+		result = append(result, projectDb.ID)
+	}
+
+	if err := cursor.Err(); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// projectCustomers returns the customers referenced by the projects.
+func (dbManager *mongodbManagerImp) projectCustomers(
+	ctx context.Context,
+	projectIds []primitive.ObjectID) ([]primitive.ObjectID, error) {
+
+	loggerObj := utils.ContextLogger(ctx)
+
+	values, err := dbManager.collection(utils.PROJECTS_COLLECTION).Distinct(ctx, utils.PROJECT_CUSTOMER_ID_FIELD,
+		bson.M{utils.PROJECT_ID_FIELD: bson.M{"$in": projectIds}})
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	result := []primitive.ObjectID{}
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// refreshCustomerProjects sets the project list of the customers to the projects that reference them and are not
+// deleted. It runs in the transactions that write the projects, so the lists always match the projects.
+func (dbManager *mongodbManagerImp) refreshCustomerProjects(ctx context.Context, customerIds ...primitive.ObjectID) error {
+	loggerObj := utils.ContextLogger(ctx)
+
+	for _, customerId := range customerIds {
+		projectIds, err := dbManager.referencingProjects(ctx, utils.PROJECT_CUSTOMER_ID_FIELD, customerId)
+		if err != nil {
+			return err
+		}
+
+		if _, err = dbManager.collection(utils.CUSTOMERS_COLLECTION).UpdateOne(ctx,
+			bson.M{utils.CUSTOMER_ID_FIELD: customerId},
+			bson.M{"$set": bson.M{utils.CUSTOMER_PROJECTS_FIELD: projectIds}}); err != nil {
+			loggerObj.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteProjects deletes the projects that are not deleted yet and removes them from the lists of their customers.
+func (dbManager *mongodbManagerImp) deleteProjects(
+	ctx context.Context,
+	projectIds []primitive.ObjectID,
+	deletedAt time.Time) (int64, error) {
+
+	loggerObj := utils.ContextLogger(ctx)
+
+	customerIds, err := dbManager.projectCustomers(ctx, projectIds)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := dbManager.collection(utils.PROJECTS_COLLECTION).UpdateMany(ctx,
+		bson.M{
+			utils.PROJECT_ID_FIELD: bson.M{"$in": projectIds},
+			utils.DELETED_AT_FIELD: nil,
+		},
+		markDeleted(deletedAt))
+	if err != nil {
+		loggerObj.Error(err)
+		return 0, err
+	}
+
+	return result.ModifiedCount, dbManager.refreshCustomerProjects(ctx, customerIds...)
+}
+
+// applyDeleteRule runs the delete rule on the projects whose field references id, the customer or the user deleted.
+// The restrict rule returns a ReferencedError when there are such projects, before anything is written. Removing
+// the reference is an update of the project, so its version is increased.
+func (dbManager *mongodbManagerImp) applyDeleteRule(
+	ctx context.Context,
+	rule utils.OnDeleteEnum,
+	resource, field string,
+	id primitive.ObjectID,
+	deletedAt time.Time) error {
+
+	loggerObj := utils.ContextLogger(ctx)
+
+	projectIds, err := dbManager.referencingProjects(ctx, field, id)
+	if err != nil || len(projectIds) == 0 {
+		return err
+	}
+
+	switch rule {
+	case utils.ON_DELETE_CASCADE:
+		_, err = dbManager.deleteProjects(ctx, projectIds, deletedAt)
+		return err
+	case utils.ON_DELETE_SET_NULL:
+		if _, err = dbManager.collection(utils.PROJECTS_COLLECTION).UpdateMany(ctx,
+			bson.M{utils.PROJECT_ID_FIELD: bson.M{"$in": projectIds}},
+			bson.M{"$set": bson.M{field: nil}, "$inc": bson.M{utils.PROJECT_VERSION_FIELD: 1}}); err != nil {
+			loggerObj.Error(err)
+		}
+		return err
+	default:
+		err := &ReferencedError{Resource: resource, ID: id.Hex(), Projects: dbManager.mongoIDsToModelIDs(projectIds)}
+		loggerObj.Error(err)
+		return err
+	}
+}
+
+// validateProjectRefs checks that the owner and the customer of the project exist and are not deleted. The references
+// that did not change since stored, the project before the update, are not checked again.
+func (dbManager *mongodbManagerImp) validateProjectRefs(ctx context.Context, project, stored *mdbProjectModel) error {
+	loggerObj := utils.ContextLogger(ctx)
+
+	if stored == nil || !sameObjectID(project.OwnerID, stored.OwnerID) {
+		if valid, err := dbManager.validReference(ctx, project.OwnerID, utils.USERS_COLLECTION); err != nil {
+			return err
+		} else if !valid {
+			msg := fmt.Sprintf("invalid project. Owner (%s) not found", project.OwnerID.Hex())
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		}
+	}
+
+	if stored == nil || !sameObjectID(project.CustomerID, stored.CustomerID) {
+		if valid, err := dbManager.validReference(ctx, project.CustomerID, utils.CUSTOMERS_COLLECTION); err != nil {
+			return err
+		} else if !valid {
+			msg := fmt.Sprintf("invalid project. Customer (%s) not found", project.CustomerID.Hex())
+			loggerObj.Error(msg)
+			return errors.New(msg)
+		}
+	}
+
+	return nil
+}
+
+// validReference returns whether a project can reference the document: it is nil or it exists and it is not
+// deleted.
+func (dbManager *mongodbManagerImp) validReference(
+	ctx context.Context,
+	id *primitive.ObjectID,
+	collectionName string) (bool, error) {
+
+	if id == nil {
+		return true, nil
+	}
+
+	return dbManager.existsObject(ctx, *id, collectionName)
+}
+
+func sameObjectID(first, second *primitive.ObjectID) bool {
+	if first == nil || second == nil {
+		return first == second
+	}
+
+	return *first == *second
+}
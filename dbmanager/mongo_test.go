@@ -1,8 +1,10 @@
 package dbmanager
 
 import (
+	"context"
 	"github.com/freddy311082/picnic-server/settings"
 	"testing"
+	"time"
 )
 
 func initMongodbManagerForTesting() (*mongodbManagerImp, error) {
@@ -24,3 +26,20 @@ func TestOpenConnectionWithCloudMongo(t *testing.T) {
 		mongodbManager.Close()
 	}
 }
+
+func TestOperationContextEndsWithTheRequest(t *testing.T) {
+	mongodbManager := &mongodbManagerImp{operationTimeout: time.Minute}
+
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	ctx, cancel := mongodbManager.operationContext(requestCtx)
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Error("The operation timeout was not applied")
+	}
+
+	cancelRequest()
+	if ctx.Err() != context.Canceled {
+		t.Error("The operation was not cancelled with the request")
+	}
+}
@@ -1,6 +1,8 @@
 package dbmanager
 
 import (
+	"time"
+
 	"github.com/freddy311082/picnic-server/model"
 	"github.com/freddy311082/picnic-server/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,10 +17,47 @@ func (mdbIdObj *mdbId) ToString() string {
 }
 
 type mdbUserModel struct {
-	ID       primitive.ObjectID `bson:"_id"`
-	Name     string             `bson:"name"`
-	LastName string             `bson:"last_name"`
-	Email    string             `bson:"email"`
+	ID        primitive.ObjectID  `bson:"_id"`
+	Name      string              `bson:"name"`
+	LastName  string              `bson:"last_name"`
+	Email     string              `bson:"email"`
+	Role      string              `bson:"role"`
+	DeletedAt *primitive.DateTime `bson:"deleted_at,omitempty"`
+}
+
+// deletedAtToMongo leaves the deleted date of the documents that are not deleted unset, which is what the queries
+// of notDeleted look for.
+func deletedAtToMongo(deletedAt time.Time) *primitive.DateTime {
+	if deletedAt.IsZero() {
+		return nil
+	}
+
+	result := primitive.NewDateTimeFromTime(deletedAt)
+	return &result
+}
+
+func deletedAtFromMongo(deletedAt *primitive.DateTime) time.Time {
+	if deletedAt == nil {
+		return time.Time{}
+	}
+
+	return deletedAt.Time().UTC()
+}
+
+func roleToMongo(role utils.UserRoleEnum) string {
+	if role == utils.ROLE_ADMIN {
+		return utils.USER_ROLE_ADMIN
+	}
+
+	return utils.USER_ROLE_USER
+}
+
+func roleFromMongo(role string) utils.UserRoleEnum {
+	if role == utils.USER_ROLE_ADMIN {
+		return utils.ROLE_ADMIN
+	}
+
+	return utils.ROLE_USER
 }
 
 func (dbUser *mdbUserModel) initFromModel(user *model.User) {
@@ -30,6 +69,8 @@ func (dbUser *mdbUserModel) initFromModel(user *model.User) {
 	dbUser.Name = user.Name
 	dbUser.LastName = user.LastName
 	dbUser.Email = user.Email
+	dbUser.Role = roleToMongo(user.Role)
+	dbUser.DeletedAt = deletedAtToMongo(user.DeletedAt)
 }
 
 func (dbUser *mdbUserModel) toModel() *model.User {
@@ -37,73 +78,157 @@ func (dbUser *mdbUserModel) toModel() *model.User {
 		ID: &mdbId{
 			id: dbUser.ID,
 		},
-		Name:     dbUser.Name,
-		LastName: dbUser.LastName,
-		Email:    dbUser.Email,
-		Token:    "",
+		Name:      dbUser.Name,
+		LastName:  dbUser.LastName,
+		Email:     dbUser.Email,
+		Token:     "",
+		Role:      roleFromMongo(dbUser.Role),
+		DeletedAt: deletedAtFromMongo(dbUser.DeletedAt),
 	}
 }
 
 type mdbProjectModel struct {
-	ID          primitive.ObjectID `bson:"_id"`
-	Name        string             `bson:"name"`
-	Description string             `bson:"description"`
-	CreatedAt   primitive.DateTime `bson:"created_at"`
-	OwnerID     primitive.ObjectID `bson:"owner_id"`
-	CustomerID  primitive.ObjectID `bson:"customer_id"`
+	ID          primitive.ObjectID     `bson:"_id"`
+	Name        string                 `bson:"name"`
+	Description string                 `bson:"description"`
+	CreatedAt   primitive.DateTime     `bson:"created_at"`
+	OwnerID     *primitive.ObjectID    `bson:"owner_id"`
+	CustomerID  *primitive.ObjectID    `bson:"customer_id"`
+	Fields      []mdbProjectFieldModel `bson:"fields"`
+	Version     int64                  `bson:"version"`
+	DeletedAt   *primitive.DateTime    `bson:"deleted_at,omitempty"`
+}
+
+type mdbProjectFieldModel struct {
+	Name     string      `bson:"name"`
+	Type     string      `bson:"type"`
+	Required bool        `bson:"required"`
+	Options  []string    `bson:"options,omitempty"`
+	Default  interface{} `bson:"default"`
+	Value    interface{} `bson:"value"`
+}
+
+var fieldTypesToMongo = map[utils.ProjectFieldTypeEnum]string{
+	utils.FIELD_TYPE_TEXT:    utils.PROJECT_FIELD_TYPE_TEXT,
+	utils.FIELD_TYPE_NUMBER:  utils.PROJECT_FIELD_TYPE_NUMBER,
+	utils.FIELD_TYPE_DATE:    utils.PROJECT_FIELD_TYPE_DATE,
+	utils.FIELD_TYPE_ENUM:    utils.PROJECT_FIELD_TYPE_ENUM,
+	utils.FIELD_TYPE_BOOLEAN: utils.PROJECT_FIELD_TYPE_BOOLEAN,
+}
+
+func fieldTypeFromMongo(fieldType string) utils.ProjectFieldTypeEnum {
+	for key, value := range fieldTypesToMongo {
+		if value == fieldType {
+			return key
+		}
+	}
+
+	return utils.FIELD_TYPE_TEXT
+}
+
+// fieldValueFromMongo converts the values decoded by the driver into the types documented in model.ProjectField.
+func fieldValueFromMongo(value interface{}) interface{} {
+	switch value := value.(type) {
+	case primitive.DateTime:
+		return value.Time()
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+
+	return value
+}
+
+func (dbField *mdbProjectFieldModel) initFromModel(field *model.ProjectField) {
+	dbField.Name = field.Name
+	dbField.Type = fieldTypesToMongo[field.Type]
+	dbField.Required = field.Required
+	dbField.Options = field.Options
+	dbField.Default = field.Default
+	dbField.Value = field.Value
+}
+
+func (dbField *mdbProjectFieldModel) toModel() model.ProjectField {
+	return model.ProjectField{
+		Name:     dbField.Name,
+		Type:     fieldTypeFromMongo(dbField.Type),
+		Required: dbField.Required,
+		Options:  dbField.Options,
+		Default:  fieldValueFromMongo(dbField.Default),
+		Value:    fieldValueFromMongo(dbField.Value),
+	}
 }
 
 func (dbProject *mdbProjectModel) initFromModel(project *model.Project) error {
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
 
 	if project.ID != nil {
-		if objId, err := primitive.ObjectIDFromHex(project.ID.ToString()); err != nil {
+		if objId, err := primitive.ObjectIDFromHex(project.ID.ToString()); err == nil {
 			dbProject.ID = objId
 		}
 	}
 
-	if id, err := primitive.ObjectIDFromHex(project.Owner.ID.ToString()); err != nil {
-		loggerObj.Error(err)
-		return err
-	} else {
-		dbProject.OwnerID = id
+	// the references removed by the set-null delete rule are stored as null
+	if ownerId := project.OwnerID(); ownerId != nil {
+		if id, err := primitive.ObjectIDFromHex(ownerId.ToString()); err != nil {
+			loggerObj.Error(err)
+			return err
+		} else {
+			dbProject.OwnerID = &id
+		}
 	}
 
-	if id, err := primitive.ObjectIDFromHex(project.Customer.ID.ToString()); err != nil {
-		loggerObj.Error(err)
-		return err
-	} else {
-		dbProject.CustomerID = id
+	if customerId := project.CustomerID(); customerId != nil {
+		if id, err := primitive.ObjectIDFromHex(customerId.ToString()); err != nil {
+			loggerObj.Error(err)
+			return err
+		} else {
+			dbProject.CustomerID = &id
+		}
 	}
 
 	dbProject.Name = project.Name
 	dbProject.Description = project.Description
 	dbProject.CreatedAt = primitive.NewDateTimeFromTime(project.CreatedAt)
+	dbProject.Version = project.Version
+	dbProject.DeletedAt = deletedAtToMongo(project.DeletedAt)
+
+	dbProject.Fields = []mdbProjectFieldModel{}
+	for _, field := range project.Fields {
+		dbField := mdbProjectFieldModel{}
+		dbField.initFromModel(&field)
+		dbProject.Fields = append(dbProject.Fields, dbField)
+	}
 
 	return nil
 }
 
 func (dbProject *mdbProjectModel) toModel() *model.Project {
-	var ownerId *mdbId
-	var customerId *mdbId
-
-	if dbProject.CustomerID.Hex() != "" {
-		ownerId = &mdbId{id: dbProject.CustomerID}
+	fields := model.ProjectFieldList{}
+	for _, dbField := range dbProject.Fields {
+		fields = append(fields, dbField.toModel())
 	}
 
-	if dbProject.OwnerID.Hex() != "" {
-		customerId = &mdbId{id: dbProject.OwnerID}
-	}
-
-	return &model.Project{
+	project := &model.Project{
 		ID:          &mdbId{id: dbProject.ID},
 		Name:        dbProject.Name,
 		Description: dbProject.Description,
 		CreatedAt:   dbProject.CreatedAt.Time(),
-		Owner:       &model.User{ID: customerId},
-		Customer:    &model.Customer{ID: ownerId},
+		Fields:      fields,
+		Version:     dbProject.Version,
+		DeletedAt:   deletedAtFromMongo(dbProject.DeletedAt),
 	}
+
+	if dbProject.OwnerID != nil {
+		project.Owner = &model.User{ID: &mdbId{id: *dbProject.OwnerID}}
+	}
+
+	if dbProject.CustomerID != nil {
+		project.Customer = &model.Customer{ID: &mdbId{id: *dbProject.CustomerID}}
+	}
+
+	return project
 }
 
 type mdbProjectListModel []mdbProjectModel
@@ -119,30 +244,30 @@ func (dbProjectList mdbProjectListModel) toModel() model.ProjectList {
 }
 
 type mdbCustomerModel struct {
-	ID       primitive.ObjectID   `bson:"_id"`
-	Name     string               `bson:"name"`
-	Cuit     string               `bson:"cuit"`
-	Projects []primitive.ObjectID `bson:"projects"`
+	ID        primitive.ObjectID   `bson:"_id"`
+	Name      string               `bson:"name"`
+	Cuit      string               `bson:"cuit"`
+	Projects  []primitive.ObjectID `bson:"projects"`
+	Version   int64                `bson:"version"`
+	DeletedAt *primitive.DateTime  `bson:"deleted_at,omitempty"`
 }
 
 func (dbCustomer *mdbCustomerModel) toModel() (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
-
 	customer := &model.Customer{
-		ID:   &mdbId{id: dbCustomer.ID},
-		Name: dbCustomer.Name,
-		Cuit: dbCustomer.Cuit,
+		ID:        &mdbId{id: dbCustomer.ID},
+		Name:      dbCustomer.Name,
+		Cuit:      dbCustomer.Cuit,
+		Version:   dbCustomer.Version,
+		DeletedAt: deletedAtFromMongo(dbCustomer.DeletedAt),
 	}
 
-	dbManager := Instance().(*mongodbManagerImp)
-	ids := dbManager.mongoIDsToModelIDs(dbCustomer.Projects)
-	projects, err := dbManager.AllProjectWhereIDIsIn(ids)
-	if err == nil {
-		customer.Projects = projects
+	// only the ids of the projects are set. The projects are loaded by the caller when they are needed.
+	customer.Projects = model.ProjectList{}
+	for _, id := range dbCustomer.Projects {
+		customer.Projects = append(customer.Projects, &model.Project{ID: &mdbId{id: id}})
 	}
 
-	return customer, err
+	return customer, nil
 }
 
 func (dbCustomer *mdbCustomerModel) initFromModel(customer *model.Customer) {
@@ -154,7 +279,124 @@ func (dbCustomer *mdbCustomerModel) initFromModel(customer *model.Customer) {
 
 	dbCustomer.Name = customer.Name
 	dbCustomer.Cuit = customer.Cuit
+	dbCustomer.Version = customer.Version
+	dbCustomer.DeletedAt = deletedAtToMongo(customer.DeletedAt)
 
 	dbManager := Instance().(*mongodbManagerImp)
 	dbCustomer.Projects, _ = dbManager.modelIDsToMongoIDs(customer.Projects.IDs(), utils.LoggerObj())
 }
+
+// mdbPersistedQueryModel is a GraphQL query registered by a client, stored by the sha256 hash of its text.
+type mdbPersistedQueryModel struct {
+	Hash      string    `bson:"_id"`
+	Query     string    `bson:"query"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// mdbAuditEntryModel is an entry of the audit log. ActorID is null for the changes made by anonymous requests.
+type mdbAuditEntryModel struct {
+	ID         primitive.ObjectID    `bson:"_id"`
+	ActorID    *primitive.ObjectID   `bson:"actor_id"`
+	Timestamp  primitive.DateTime    `bson:"timestamp"`
+	EntityType string                `bson:"entity_type"`
+	EntityID   primitive.ObjectID    `bson:"entity_id"`
+	Operation  string                `bson:"operation"`
+	Changes    []mdbAuditChangeModel `bson:"changes"`
+}
+
+type mdbAuditChangeModel struct {
+	Field  string      `bson:"field"`
+	Before interface{} `bson:"before"`
+	After  interface{} `bson:"after"`
+}
+
+var auditEntityTypesToMongo = map[utils.AuditEntityTypeEnum]string{
+	utils.AUDIT_USER:     utils.AUDIT_ENTITY_USER,
+	utils.AUDIT_PROJECT:  utils.AUDIT_ENTITY_PROJECT,
+	utils.AUDIT_CUSTOMER: utils.AUDIT_ENTITY_CUSTOMER,
+}
+
+var auditOperationsToMongo = map[utils.AuditOperationEnum]string{
+	utils.AUDIT_CREATE:  utils.AUDIT_OPERATION_CREATE,
+	utils.AUDIT_UPDATE:  utils.AUDIT_OPERATION_UPDATE,
+	utils.AUDIT_DELETE:  utils.AUDIT_OPERATION_DELETE,
+	utils.AUDIT_RESTORE: utils.AUDIT_OPERATION_RESTORE,
+}
+
+func auditEntityTypeFromMongo(entityType string) utils.AuditEntityTypeEnum {
+	for key, value := range auditEntityTypesToMongo {
+		if value == entityType {
+			return key
+		}
+	}
+
+	return utils.AUDIT_USER
+}
+
+func auditOperationFromMongo(operation string) utils.AuditOperationEnum {
+	for key, value := range auditOperationsToMongo {
+		if value == operation {
+			return key
+		}
+	}
+
+	return utils.AUDIT_UPDATE
+}
+
+func (dbEntry *mdbAuditEntryModel) initFromModel(entry *model.AuditEntry, loggerObj *utils.Logger) error {
+	dbManager := Instance().(*mongodbManagerImp)
+
+	entityId, err := dbManager.modelIDtoMongoID(entry.EntityID, loggerObj)
+	if err != nil {
+		return err
+	}
+
+	if entry.ActorID != nil {
+		actorId, err := dbManager.modelIDtoMongoID(entry.ActorID, loggerObj)
+		if err != nil {
+			return err
+		}
+		dbEntry.ActorID = &actorId
+	}
+
+	dbEntry.ID = primitive.NewObjectID()
+	dbEntry.Timestamp = primitive.NewDateTimeFromTime(entry.Timestamp)
+	dbEntry.EntityType = auditEntityTypesToMongo[entry.EntityType]
+	dbEntry.EntityID = entityId
+	dbEntry.Operation = auditOperationsToMongo[entry.Operation]
+	dbEntry.Changes = make([]mdbAuditChangeModel, 0, len(entry.Changes))
+	for _, change := range entry.Changes {
+		dbEntry.Changes = append(dbEntry.Changes, mdbAuditChangeModel{
+			Field:  change.Field,
+			Before: change.Before,
+			After:  change.After,
+		})
+	}
+
+	return nil
+}
+
+func (dbEntry *mdbAuditEntryModel) toModel() *model.AuditEntry {
+	entry := &model.AuditEntry{
+		ID:         &mdbId{id: dbEntry.ID},
+		Timestamp:  dbEntry.Timestamp.Time().UTC(),
+		EntityType: auditEntityTypeFromMongo(dbEntry.EntityType),
+		EntityID:   &mdbId{id: dbEntry.EntityID},
+		Operation:  auditOperationFromMongo(dbEntry.Operation),
+		Changes:    []model.AuditChange{},
+	}
+
+	if dbEntry.ActorID != nil {
+		entry.ActorID = &mdbId{id: *dbEntry.ActorID}
+	}
+
+	for _, change := range dbEntry.Changes {
+		entry.Changes = append(entry.Changes, model.AuditChange{
+			Field:  change.Field,
+			Before: fieldValueFromMongo(change.Before),
+			After:  fieldValueFromMongo(change.After),
+		})
+	}
+
+	return entry
+}
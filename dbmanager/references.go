@@ -0,0 +1,44 @@
+package dbmanager
+
+import (
+	"fmt"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// ReferencedError is returned by DeleteUser, DeleteCustomer and DeleteCustomers when the delete rule of the relation
+// is restrict and there are projects that reference the user or the customer. Nothing is deleted in that case.
+type ReferencedError struct {
+	Resource string
+	ID       string
+	Projects model.IDList
+}
+
+func (err *ReferencedError) Error() string {
+	return fmt.Sprintf("cannot delete %s %s. It is referenced by %d projects", err.Resource, err.ID, len(err.Projects))
+}
+
+// deleteRules are what happens to the projects that are not deleted when their customer or their owner is deleted:
+// the delete is rejected (restrict), the projects are deleted with it (cascade) or the projects lose the reference
+// (set null).
+type deleteRules struct {
+	customerProjects utils.OnDeleteEnum
+	ownerProjects    utils.OnDeleteEnum
+}
+
+func deleteRulesFromSettings() deleteRules {
+	dbSettings := settings.SettingsObj().DBSettingsValues()
+
+	return deleteRules{
+		customerProjects: dbSettings.OnDeleteCustomerProjects(),
+		ownerProjects:    dbSettings.OnDeleteOwnerProjects(),
+	}
+}
+
+// mergedUserEmail returns the email written in the deleted duplicate user whose email is the new one of the user it
+// was merged into. The emails of the deleted users are still unique, so the duplicate must release it.
+func mergedUserEmail(email, id string) string {
+	return fmt.Sprintf("%s#merged-%s", email, id)
+}
@@ -1,19 +1,144 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"github.com/freddy311082/picnic-server/api"
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/service"
+	"github.com/freddy311082/picnic-server/settings"
 	"github.com/freddy311082/picnic-server/utils"
 )
 
-func startServer() {
+// startServer runs the web server until it fails or the process receives SIGINT or SIGTERM, and returns the exit
+// code of the process.
+func startServer() int {
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+
+	if err := settings.Load(); err != nil {
+		loggerObj.Error("Cannot load the settings: ", err.Error())
+		return 1
+	}
+	utils.SetLogLevel(settings.SettingsObj().LogLevel())
+
 	server := api.WebServerInstance()
-	server.Start()
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- server.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		if err != nil {
+			loggerObj.Error("Picnic Web Server failed: ", err.Error())
+			server.Stop(context.Background())
+			return 1
+		}
+	case sig := <-signals:
+		loggerObj.Infof("Received %s. Stopping Picnic Web Server", sig)
+		ctx, cancel := context.WithTimeout(context.Background(),
+			settings.SettingsObj().APISettings().ShutdownTimeout())
+		defer cancel()
+
+		if err := server.Stop(ctx); err != nil {
+			loggerObj.Error("Error stopping the server: ", err.Error())
+			return 1
+		}
+
+		if err := <-serverErrors; err != nil {
+			return 1
+		}
+	}
+
 	loggerObj.Info("Stopped Picnic Web Server")
+	return 0
+}
+
+// encryptSecret prints the value of the standard input encrypted for the keyfile secrets provider.
+func encryptSecret(keyFile string) int {
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encrypted, err := settings.EncryptSecret(keyFile, strings.TrimRight(value, "\r\n"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(encrypted)
+	return 0
+}
+
+// checkConsistency prints the inconsistencies of the stored data, repairing them with fix. It returns 1 when there
+// are inconsistencies left, so it can be used in scripts.
+func checkConsistency(fix bool) int {
+	if err := settings.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot load the settings:", err.Error())
+		return 1
+	}
+	utils.SetLogLevel(settings.SettingsObj().LogLevel())
+
+	// the database is opened without starting the service, so the check does not purge the deleted records
+	if err := dbmanager.Instance().Open(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer dbmanager.Instance().Close()
+
+	inconsistencies, err := service.Instance().CheckConsistency(context.Background(), fix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, inconsistency := range inconsistencies {
+		fmt.Println(inconsistency)
+		if !inconsistency.Fixed {
+			code = 1
+		}
+	}
+
+	fmt.Printf("%d inconsistencies found\n", len(inconsistencies))
+	return code
 }
 
 func main() {
-	startServer()
+	configFile := flag.String(utils.CONFIG_FILE_FLAG, "",
+		"path of the settings file. Overrides the "+utils.CONFIG_FILE_ENV_VAR+" environment variable")
+	encryptSecretKeyFile := flag.String(utils.ENCRYPT_SECRET_FLAG, "",
+		"encrypts the secret read from the standard input with this key file, prints it and exits")
+	flag.Parse()
+	settings.SetConfigFile(*configFile)
+
+	if *encryptSecretKeyFile != "" {
+		os.Exit(encryptSecret(*encryptSecretKeyFile))
+	}
+
+	if flag.Arg(0) == utils.CHECK_COMMAND {
+		checkFlags := flag.NewFlagSet(utils.CHECK_COMMAND, flag.ExitOnError)
+		fix := checkFlags.Bool(utils.FIX_FLAG, false,
+			"repairs the inconsistencies found: merges the duplicate users, reassigns the orphaned projects and "+
+				"rebuilds the project lists of the customers")
+		checkFlags.Parse(flag.Args()[1:])
+		os.Exit(checkConsistency(*fix))
+	}
+
+	os.Exit(startServer())
 	//api.StartTest()
 }
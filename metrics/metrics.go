@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Counters and histograms exposed in the Prometheus text format. Every metric is registered when it is created and
+// is written by Handler.
+
+// maxSeries limits the label combinations of a metric, so labels sent by the clients, like the operation names,
+// cannot grow the memory without limit. Once it is reached the new combinations are counted with every label set to
+// overflowLabel.
+const maxSeries = 500
+const overflowLabel = "other"
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(writer *bufio.Writer)
+}
+
+var registry = struct {
+	mutex   sync.Mutex
+	metrics []metric
+}{}
+
+func register(value metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = append(registry.metrics, value)
+}
+
+// ******************************* Counter ***********************************
+
+type Counter struct {
+	mutex  sync.Mutex
+	desc   metricDesc
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	counter := &Counter{
+		desc:   metricDesc{metricName: name, help: help, labels: labels},
+		values: map[string]*counterValue{},
+	}
+	register(counter)
+	return counter
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	key, labelValues := counter.desc.seriesKey(labelValues)
+	if _, ok := counter.values[key]; !ok && len(counter.values) >= maxSeries {
+		key, labelValues = counter.desc.overflowKey()
+	}
+
+	if series, ok := counter.values[key]; ok {
+		series.value += value
+	} else {
+		counter.values[key] = &counterValue{labels: labelValues, value: value}
+	}
+}
+
+func (counter *Counter) name() string {
+	return counter.desc.metricName
+}
+
+func (counter *Counter) write(writer *bufio.Writer) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.desc.writeHeader(writer, "counter")
+	var keys []string
+	for key := range counter.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := counter.values[key]
+		fmt.Fprintf(writer, "%s%s %s\n", counter.desc.metricName,
+			counter.desc.formatLabels(series.labels, "", ""), formatValue(series.value))
+	}
+}
+
+// ******************************* Histogram ***********************************
+
+type Histogram struct {
+	mutex   sync.Mutex
+	desc    metricDesc
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	histogram := &Histogram{
+		desc:    metricDesc{metricName: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+	register(histogram)
+	return histogram
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	key, labelValues := histogram.desc.seriesKey(labelValues)
+	if _, ok := histogram.values[key]; !ok && len(histogram.values) >= maxSeries {
+		key, labelValues = histogram.desc.overflowKey()
+	}
+
+	series, ok := histogram.values[key]
+	if !ok {
+		series = &histogramValue{labels: labelValues, counts: make([]uint64, len(histogram.buckets))}
+		histogram.values[key] = series
+	}
+
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (histogram *Histogram) name() string {
+	return histogram.desc.metricName
+}
+
+func (histogram *Histogram) write(writer *bufio.Writer) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	desc := &histogram.desc
+	desc.writeHeader(writer, "histogram")
+	var keys []string
+	for key := range histogram.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := histogram.values[key]
+		for i, bound := range histogram.buckets {
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", desc.metricName,
+				desc.formatLabels(series.labels, "le", formatValue(bound)), series.counts[i])
+		}
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", desc.metricName,
+			desc.formatLabels(series.labels, "le", "+Inf"), series.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", desc.metricName,
+			desc.formatLabels(series.labels, "", ""), formatValue(series.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", desc.metricName,
+			desc.formatLabels(series.labels, "", ""), series.count)
+	}
+}
+
+// ******************************* Helpers ***********************************
+
+type metricDesc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+// seriesKey returns the key of the label values. Missing values are empty.
+func (desc *metricDesc) seriesKey(labelValues []string) (string, []string) {
+	values := make([]string, len(desc.labels))
+	copy(values, labelValues)
+	return strings.Join(values, "\xff"), values
+}
+
+func (desc *metricDesc) overflowKey() (string, []string) {
+	values := make([]string, len(desc.labels))
+	for i := range values {
+		values[i] = overflowLabel
+	}
+	return strings.Join(values, "\xff"), values
+}
+
+func (desc *metricDesc) writeHeader(writer *bufio.Writer, metricType string) {
+	fmt.Fprintf(writer, "# HELP %s %s\n", desc.metricName, desc.help)
+	fmt.Fprintf(writer, "# TYPE %s %s\n", desc.metricName, metricType)
+}
+
+// formatLabels writes the labels of a series, followed by the extra label when it is not empty.
+func (desc *metricDesc) formatLabels(values []string, extraLabel, extraValue string) string {
+	var pairs []string
+	for i, label := range desc.labels {
+		pairs = append(pairs, label+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(value)
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		registry.mutex.Lock()
+		metrics := append([]metric{}, registry.metrics...)
+		registry.mutex.Unlock()
+
+		sort.Slice(metrics, func(i, j int) bool {
+			return metrics[i].name() < metrics[j].name()
+		})
+
+		response.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writer := bufio.NewWriter(response)
+		for _, value := range metrics {
+			value.write(writer)
+		}
+		writer.Flush()
+	})
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerWritesPrometheusTextFormat(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Requests.", "operation")
+	histogram := NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 1}, "operation")
+
+	counter.Inc("allUsers")
+	counter.Inc("allUsers")
+	counter.Inc(`say "hi"`)
+	histogram.Observe(0.05, "allUsers")
+	histogram.Observe(0.5, "allUsers")
+
+	response := httptest.NewRecorder()
+	Handler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(response.Body)
+
+	expected := []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{operation="allUsers"} 2`,
+		`test_requests_total{operation="say \"hi\""} 1`,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{operation="allUsers",le="0.1"} 1`,
+		`test_duration_seconds_bucket{operation="allUsers",le="1"} 2`,
+		`test_duration_seconds_bucket{operation="allUsers",le="+Inf"} 2`,
+		`test_duration_seconds_sum{operation="allUsers"} 0.55`,
+		`test_duration_seconds_count{operation="allUsers"} 2`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Line %s not found in:\n%s", line, body)
+		}
+	}
+}
+
+func TestCounterLimitsSeries(t *testing.T) {
+	counter := NewCounter("test_limited_total", "Limited.", "operation")
+
+	for i := 0; i < maxSeries+10; i++ {
+		counter.Inc(strings.Repeat("a", i+1))
+	}
+
+	if len(counter.values) != maxSeries+1 {
+		t.Errorf("Expected %d series. Value received: %d", maxSeries+1, len(counter.values))
+	} else if counter.values[overflowLabel].value != 10 {
+		t.Errorf("Expected 10 values in the overflow series. Value received: %v", counter.values[overflowLabel].value)
+	}
+}
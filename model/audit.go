@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// AuditEntry records a change written by the service. ActorID is nil for the changes made by anonymous requests.
+type AuditEntry struct {
+	ID         ID
+	ActorID    ID
+	Timestamp  time.Time
+	EntityType utils.AuditEntityTypeEnum
+	EntityID   ID
+	Operation  utils.AuditOperationEnum
+	Changes    []AuditChange
+}
+
+type AuditEntryList []*AuditEntry
+
+// AuditChange is the value of a field before and after a change. Before is nil when the entity is created and After
+// is nil when it is deleted. The values are strings, float64, bool or time.Time.
+type AuditChange struct {
+	Field  string
+	Before interface{}
+	After  interface{}
+}
+
+// AuditFilter matches the entries that satisfy every non zero field. The time range includes Since and excludes
+// Until.
+type AuditFilter struct {
+	EntityIDs  IDList
+	EntityType *utils.AuditEntityTypeEnum
+	Since      time.Time
+	Until      time.Time
+}
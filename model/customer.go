@@ -1,10 +1,17 @@
 package model
 
+import "time"
+
 type Customer struct {
 	ID       ID
 	Name     string
 	Cuit     string
 	Projects ProjectList
+	// Version starts at 1 and is increased by every update. An update is only written when it carries the stored
+	// version, so the changes made since the customer was read are not overwritten.
+	Version int64
+	// DeletedAt is zero unless the customer was deleted and it was not purged yet.
+	DeletedAt time.Time
 }
 
 type CustomerList []*Customer
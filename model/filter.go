@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// OrderBy sorts a list by one of the utils.SORT_FIELD_* fields. Items with the same value are always sorted by ID, in
+// the same direction, so the order is stable between requests. A nil OrderBy sorts by ID in ascending order.
+type OrderBy struct {
+	Field     string
+	Direction utils.SortDirectionEnum
+}
+
+// UserFilter matches the users whose name, last name or email contain Search, ignoring case.
+type UserFilter struct {
+	Search string
+}
+
+// ProjectFilter matches the projects that satisfy every non zero field. The name comparison ignores case and the
+// creation date range includes CreatedAfter and excludes CreatedBefore.
+type ProjectFilter struct {
+	NameContains  string
+	CustomerID    ID
+	OwnerID       ID
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// CustomerFilter matches the customers whose name or CUIT contain Search, ignoring case.
+type CustomerFilter struct {
+	Search string
+}
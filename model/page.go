@@ -0,0 +1,16 @@
+package model
+
+// PageRequest describes a keyset page of a collection ordered by ID. After and Before are exclusive bounds. First
+// takes the first items after the lower bound and Last takes the last items before the upper bound. When both First
+// and Last are zero every item between the bounds is returned.
+type PageRequest struct {
+	First  int
+	After  ID
+	Last   int
+	Before ID
+}
+
+type PageInfo struct {
+	HasNextPage     bool
+	HasPreviousPage bool
+}
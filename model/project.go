@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
 
 type Project struct {
 	ID          ID
@@ -10,12 +14,44 @@ type Project struct {
 	Owner       *User
 	Customer    *Customer
 	Fields      ProjectFieldList
+	// Version starts at 1 and is increased by every update. An update is only written when it carries the stored
+	// version, so the changes made since the project was read are not overwritten.
+	Version int64
+	// DeletedAt is zero unless the project was deleted and it was not purged yet.
+	DeletedAt time.Time
 }
 
 type ProjectList []*Project
 
+// OwnerID returns the id of the owner of the project, or nil when the project has no owner, which happens when its
+// owner was deleted with the set-null delete rule.
+func (project *Project) OwnerID() ID {
+	if project.Owner == nil {
+		return nil
+	}
+
+	return project.Owner.ID
+}
+
+// CustomerID returns the id of the customer of the project, or nil when the project has no customer, which happens
+// when its customer was deleted with the set-null delete rule.
+func (project *Project) CustomerID() ID {
+	if project.Customer == nil {
+		return nil
+	}
+
+	return project.Customer.ID
+}
+
+// ProjectField is a custom field defined on a project. Default and Value hold a string for text and enum fields, a
+// float64 for number fields, a time.Time for date fields and a bool for boolean fields. They are nil when not set.
 type ProjectField struct {
-	Name string
+	Name     string
+	Type     utils.ProjectFieldTypeEnum
+	Required bool
+	Options  []string
+	Default  interface{}
+	Value    interface{}
 }
 
 type ProjectFieldList []ProjectField
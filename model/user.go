@@ -1,11 +1,31 @@
 package model
 
+import (
+	"strings"
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
 type User struct {
 	ID       ID
 	Name     string
 	LastName string
 	Email    string
 	Token    string
+	Role     utils.UserRoleEnum
+	// DeletedAt is zero unless the user was deleted and it was not purged yet.
+	DeletedAt time.Time
+}
+
+func (user *User) IsAdmin() bool {
+	return user != nil && user.Role == utils.ROLE_ADMIN
 }
 
 type UserList []*User
+
+// NormalizeEmail returns the email the way it is stored and looked up, so emails that only differ in letter case or in
+// surrounding spaces are the same email.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
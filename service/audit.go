@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// auditValues are the audited fields of an entity by name. Every value is a string, float64, bool, time.Time or nil,
+// so the entries can be stored by any DBManager.
+type auditValues map[string]interface{}
+
+func userAuditValues(user *model.User) auditValues {
+	role := utils.USER_ROLE_USER
+	if user.Role == utils.ROLE_ADMIN {
+		role = utils.USER_ROLE_ADMIN
+	}
+
+	return auditValues{
+		utils.USER_NAME_FIELD:     user.Name,
+		utils.USER_LASTNAME_FIELD: user.LastName,
+		utils.USER_EMAIL_FIELD:    user.Email,
+		utils.USER_ROLE_FIELD:     role,
+	}
+}
+
+func customerAuditValues(customer *model.Customer) auditValues {
+	return auditValues{
+		utils.CUSTOMER_NAME_FIELD: customer.Name,
+		utils.CUSTOMER_CUIT_FIELD: customer.Cuit,
+	}
+}
+
+// projectAuditValues records the value of every custom field as fields.<name>.
+func projectAuditValues(project *model.Project) auditValues {
+	values := auditValues{
+		utils.PROJECT_NAME_FIELD:        project.Name,
+		utils.PROJECT_DESCRIPTION_FIELD: project.Description,
+		utils.PROJECT_OWNER_ID_FIELD:    nil,
+		utils.PROJECT_CUSTOMER_ID_FIELD: nil,
+	}
+
+	if project.Owner != nil && project.Owner.ID != nil {
+		values[utils.PROJECT_OWNER_ID_FIELD] = project.Owner.ID.ToString()
+	}
+	if project.Customer != nil && project.Customer.ID != nil {
+		values[utils.PROJECT_CUSTOMER_ID_FIELD] = project.Customer.ID.ToString()
+	}
+	for _, field := range project.Fields {
+		values["fields."+field.Name] = field.Value
+	}
+
+	return values
+}
+
+// auditChanges returns the fields whose value differs between before and after, sorted by name. before is nil when
+// the entity is created and after is nil when it is deleted.
+func auditChanges(before, after auditValues) []model.AuditChange {
+	fields := []string{}
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []model.AuditChange{}
+	for _, field := range fields {
+		if !sameAuditValue(before[field], after[field]) {
+			changes = append(changes, model.AuditChange{Field: field, Before: before[field], After: after[field]})
+		}
+	}
+
+	return changes
+}
+
+func sameAuditValue(first, second interface{}) bool {
+	if firstTime, ok := first.(time.Time); ok {
+		secondTime, ok := second.(time.Time)
+		return ok && firstTime.Equal(secondTime)
+	}
+
+	return first == second
+}
+
+// audit records a change already written to the database. The change is committed at this point, so an audit entry
+// that cannot be written is logged and the operation is still reported as done: failing it would make the clients
+// retry a change already made, and the subscribers would not be told about it.
+func (service *serviceImp) audit(
+	ctx context.Context,
+	actor *model.User,
+	entityType utils.AuditEntityTypeEnum,
+	entityId model.ID,
+	operation utils.AuditOperationEnum,
+	before, after auditValues) {
+
+	entry := &model.AuditEntry{
+		Timestamp:  time.Now().UTC(),
+		EntityType: entityType,
+		EntityID:   entityId,
+		Operation:  operation,
+		Changes:    auditChanges(before, after),
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+	}
+
+	if err := dbmanager.Instance().AddAuditEntry(ctx, entry); err != nil {
+		loggerObj := utils.ContextLogger(ctx)
+		loggerObj.Errorf("cannot record the change of %s in the audit log: %s", entityId.ToString(), err.Error())
+	}
+}
+
+// AuditLog returns the entries of the filter in chronological order. Only admins can read the audit log.
+func (service *serviceImp) AuditLog(ctx context.Context, actor *model.User, filter *model.AuditFilter) (model.AuditEntryList, error) {
+	loggerObj := utils.ContextLogger(ctx)
+
+	if err := service.policy.CanReadAuditLog(actor); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	if filter != nil && !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		const msg = "invalid audit log range. The start date must be before the end date"
+		loggerObj.Error(msg)
+		return nil, errors.New(msg)
+	}
+
+	return dbmanager.Instance().AuditLog(ctx, filter)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+func TestAuditChangesOnlyContainTheModifiedFields(t *testing.T) {
+	due := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := projectAuditValues(&model.Project{
+		Name:   "Picnic",
+		Fields: model.ProjectFieldList{{Name: "due", Value: due}},
+	})
+	after := projectAuditValues(&model.Project{
+		Name:        "Picnic",
+		Description: "Summer picnic",
+		Fields:      model.ProjectFieldList{{Name: "due", Value: due.In(time.FixedZone("ART", -3*60*60))}},
+	})
+
+	changes := auditChanges(before, after)
+	if len(changes) != 1 || changes[0] != (model.AuditChange{Field: "description", Before: "", After: "Summer picnic"}) {
+		t.Error("Only the description changed: ", changes)
+	}
+}
+
+func TestAuditChangesOfDeletedEntity(t *testing.T) {
+	changes := auditChanges(customerAuditValues(&model.Customer{Name: "ACME", Cuit: "1"}), nil)
+
+	if len(changes) != 2 || changes[0].Field != "cuit" || changes[1].Field != "name" || changes[1].After != nil {
+		t.Error("Every field must be recorded, sorted by name, without the value after the change: ", changes)
+	}
+}
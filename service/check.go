@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// Inconsistency is a problem in the stored data found by CheckConsistency, most of them written before the references
+// between users, projects and customers were enforced.
+type Inconsistency struct {
+	Kind utils.InconsistencyEnum
+	// ID is the project, the customer or the user with the problem. For duplicate users, it is the user that is kept.
+	ID model.ID
+	// Related are the owner or the customer not found, the projects wrongly listed or missing in the project list of
+	// the customer, or the users with the same email as ID.
+	Related model.IDList
+	// Fixed is set when the inconsistency was repaired.
+	Fixed bool
+}
+
+func (inconsistency *Inconsistency) String() string {
+	related := make([]string, 0, len(inconsistency.Related))
+	for _, id := range inconsistency.Related {
+		related = append(related, id.ToString())
+	}
+
+	var description string
+	switch inconsistency.Kind {
+	case utils.INCONSISTENCY_MISSING_OWNER:
+		description = fmt.Sprintf("project %s: owner %s not found", inconsistency.ID.ToString(), related[0])
+	case utils.INCONSISTENCY_MISSING_CUSTOMER:
+		description = fmt.Sprintf("project %s: customer %s not found", inconsistency.ID.ToString(), related[0])
+	case utils.INCONSISTENCY_DELETED_CUSTOMER_PROJECTS:
+		description = fmt.Sprintf("customer %s: lists projects not found or not of the customer: %s",
+			inconsistency.ID.ToString(), strings.Join(related, ", "))
+	case utils.INCONSISTENCY_UNLISTED_CUSTOMER_PROJECTS:
+		description = fmt.Sprintf("customer %s: does not list its projects: %s",
+			inconsistency.ID.ToString(), strings.Join(related, ", "))
+	case utils.INCONSISTENCY_DUPLICATE_USERS:
+		description = fmt.Sprintf("user %s: same email as users %s",
+			inconsistency.ID.ToString(), strings.Join(related, ", "))
+	}
+
+	if inconsistency.Fixed {
+		description += " (fixed)"
+	}
+
+	return description
+}
+
+type InconsistencyList []*Inconsistency
+
+// CheckConsistency scans the users, projects and customers that are not deleted and returns the inconsistencies found.
+// With fix, it also repairs them and sets Fixed on the ones repaired: the duplicate users are merged into the admin or
+// the oldest of them, the projects whose owner is not found are reassigned to the orphaned projects owner, the projects
+// whose customer is not found lose it, and the project lists of the customers are rebuilt. A repair that fails is
+// logged and the next one is tried. The repairs are refused when the lists read look incomplete, because the projects
+// would lose owners and customers that exist.
+func (service *serviceImp) CheckConsistency(ctx context.Context, fix bool) (InconsistencyList, error) {
+	users, err := dbmanager.Instance().AllUsers(ctx, nil, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := dbmanager.Instance().AllProjects(ctx, nil, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	customers, err := dbmanager.Instance().AllCustomers(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := findInconsistencies(users, projects, customers)
+	if fix {
+		if err := checkComplete(users, projects, customers); err != nil {
+			utils.ContextLogger(ctx).Error(err)
+			return nil, err
+		}
+
+		service.fixInconsistencies(ctx, result, users)
+	}
+
+	return result, nil
+}
+
+// checkComplete returns an error when the projects reference users or customers but none was read, which is what a
+// query that failed without reporting it looks like, not data that can be repaired.
+func checkComplete(users model.UserList, projects model.ProjectList, customers model.CustomerList) error {
+	owners, projectCustomers := 0, 0
+	for _, project := range projects {
+		if project.OwnerID() != nil {
+			owners++
+		}
+		if project.CustomerID() != nil {
+			projectCustomers++
+		}
+	}
+
+	if len(users) == 0 && owners > 0 {
+		return fmt.Errorf("no users were read, but %d projects have an owner. Nothing was repaired", owners)
+	} else if len(customers) == 0 && projectCustomers > 0 {
+		return fmt.Errorf("no customers were read, but %d projects have a customer. Nothing was repaired",
+			projectCustomers)
+	}
+
+	return nil
+}
+
+// findInconsistencies returns the inconsistencies between the users, the projects and the customers, which are all the
+// ones that are not deleted.
+func findInconsistencies(
+	users model.UserList,
+	projects model.ProjectList,
+	customers model.CustomerList) InconsistencyList {
+
+	result := InconsistencyList{}
+
+	userIds := map[string]bool{}
+	for _, user := range users {
+		userIds[user.ID.ToString()] = true
+	}
+
+	customerIds := map[string]bool{}
+	for _, customer := range customers {
+		customerIds[customer.ID.ToString()] = true
+	}
+
+	customerProjects := map[string]model.IDList{}
+	for _, project := range projects {
+		if ownerId := project.OwnerID(); ownerId != nil && !userIds[ownerId.ToString()] {
+			result = append(result, &Inconsistency{
+				Kind:    utils.INCONSISTENCY_MISSING_OWNER,
+				ID:      project.ID,
+				Related: model.IDList{ownerId},
+			})
+		}
+
+		if customerId := project.CustomerID(); customerId != nil && !customerIds[customerId.ToString()] {
+			result = append(result, &Inconsistency{
+				Kind:    utils.INCONSISTENCY_MISSING_CUSTOMER,
+				ID:      project.ID,
+				Related: model.IDList{customerId},
+			})
+		} else if customerId != nil {
+			customerProjects[customerId.ToString()] = append(customerProjects[customerId.ToString()], project.ID)
+		}
+	}
+
+	for _, customer := range customers {
+		expected := customerProjects[customer.ID.ToString()]
+		listed := customer.Projects.IDs()
+
+		if deleted := missingIds(listed, expected); len(deleted) > 0 {
+			result = append(result, &Inconsistency{
+				Kind:    utils.INCONSISTENCY_DELETED_CUSTOMER_PROJECTS,
+				ID:      customer.ID,
+				Related: deleted,
+			})
+		}
+
+		if unlisted := missingIds(expected, listed); len(unlisted) > 0 {
+			result = append(result, &Inconsistency{
+				Kind:    utils.INCONSISTENCY_UNLISTED_CUSTOMER_PROJECTS,
+				ID:      customer.ID,
+				Related: unlisted,
+			})
+		}
+	}
+
+	return append(result, duplicateUsers(users)...)
+}
+
+// duplicateUsers groups the users whose emails only differ in letter case. The user kept for each group is the first
+// admin, or the first user of the list when none is admin.
+func duplicateUsers(users model.UserList) InconsistencyList {
+	emails := []string{}
+	groups := map[string]model.UserList{}
+	for _, user := range users {
+		email := model.NormalizeEmail(user.Email)
+		if _, ok := groups[email]; !ok {
+			emails = append(emails, email)
+		}
+		groups[email] = append(groups[email], user)
+	}
+
+	result := InconsistencyList{}
+	for _, email := range emails {
+		group := groups[email]
+		if len(group) < 2 {
+			continue
+		}
+
+		kept := group[0]
+		for _, user := range group {
+			if user.IsAdmin() {
+				kept = user
+				break
+			}
+		}
+
+		duplicates := model.IDList{}
+		for _, user := range group {
+			if user != kept {
+				duplicates = append(duplicates, user.ID)
+			}
+		}
+
+		result = append(result, &Inconsistency{Kind: utils.INCONSISTENCY_DUPLICATE_USERS, ID: kept.ID, Related: duplicates})
+	}
+
+	return result
+}
+
+// fixInconsistencies repairs the inconsistencies found in the data of users. The duplicate users are merged first, so
+// the projects they owned are moved before the orphaned projects are repaired.
+func (service *serviceImp) fixInconsistencies(ctx context.Context, inconsistencies InconsistencyList, users model.UserList) {
+	usersById := map[string]*model.User{}
+	for _, user := range users {
+		usersById[user.ID.ToString()] = user
+	}
+
+	for _, inconsistency := range inconsistencies {
+		if inconsistency.Kind == utils.INCONSISTENCY_DUPLICATE_USERS {
+			inconsistency.Fixed = service.mergeUsers(ctx, inconsistency.ID, inconsistency.Related, usersById) == nil
+		}
+	}
+
+	var orphanedOwner *model.User
+	for _, inconsistency := range inconsistencies {
+		switch inconsistency.Kind {
+		case utils.INCONSISTENCY_MISSING_OWNER:
+			// an owner or a customer found now was missing from a list that was not complete
+			if _, err := dbmanager.Instance().GetUserByID(ctx, inconsistency.Related[0]); err == nil {
+				continue
+			}
+
+			if orphanedOwner == nil {
+				var err error
+				if orphanedOwner, err = service.orphanedProjectsOwner(ctx); err != nil {
+					continue
+				}
+			}
+			inconsistency.Fixed = service.updateCheckedProject(ctx, inconsistency.ID, func(project *model.Project) {
+				project.Owner = &model.User{ID: orphanedOwner.ID}
+			}) == nil
+		case utils.INCONSISTENCY_MISSING_CUSTOMER:
+			if _, err := dbmanager.Instance().GetCustomerByID(ctx, inconsistency.Related[0]); err == nil {
+				continue
+			}
+			inconsistency.Fixed = service.updateCheckedProject(ctx, inconsistency.ID, func(project *model.Project) {
+				project.Customer = nil
+			}) == nil
+		}
+	}
+
+	for _, inconsistency := range inconsistencies {
+		if inconsistency.Kind == utils.INCONSISTENCY_DELETED_CUSTOMER_PROJECTS ||
+			inconsistency.Kind == utils.INCONSISTENCY_UNLISTED_CUSTOMER_PROJECTS {
+			inconsistency.Fixed = dbmanager.Instance().RefreshCustomerProjects(ctx, model.IDList{inconsistency.ID}) == nil
+		}
+	}
+}
+
+// mergeUsers moves the projects of the duplicates to the user kept, deletes the duplicates and writes the email of the
+// user kept in lower case, which is how the login codes are sent. The database writes the merge together or not at
+// all, so a merge that fails is found again by the next check.
+func (service *serviceImp) mergeUsers(
+	ctx context.Context,
+	keptId model.ID,
+	duplicates model.IDList,
+	usersById map[string]*model.User) error {
+
+	kept := usersById[keptId.ToString()]
+	email := model.NormalizeEmail(kept.Email)
+
+	moved, err := dbmanager.Instance().MergeUsers(ctx, keptId, duplicates, email)
+	if err != nil {
+		return err
+	}
+
+	for _, stored := range moved {
+		project := *stored
+		project.Owner = &model.User{ID: keptId}
+		project.Version++
+
+		service.audit(ctx, nil, utils.AUDIT_PROJECT, project.ID, utils.AUDIT_UPDATE,
+			projectAuditValues(stored), projectAuditValues(&project))
+		service.events.Publish(Event{Type: utils.EVENT_PROJECT_UPDATED, Project: &project})
+	}
+
+	for _, id := range duplicates {
+		duplicate := usersById[id.ToString()]
+		service.audit(ctx, nil, utils.AUDIT_USER, duplicate.ID, utils.AUDIT_DELETE, userAuditValues(duplicate), nil)
+	}
+
+	if kept.Email != email {
+		updated := *kept
+		updated.Email = email
+		service.audit(ctx, nil, utils.AUDIT_USER, kept.ID, utils.AUDIT_UPDATE,
+			userAuditValues(kept), userAuditValues(&updated))
+	}
+
+	return nil
+}
+
+// orphanedProjectsOwner returns the user that owns the projects whose owner was not found, which is registered the
+// first time it is needed. Nobody can log in as this user, because its email cannot receive the login codes.
+func (service *serviceImp) orphanedProjectsOwner(ctx context.Context) (*model.User, error) {
+	if user, err := dbmanager.Instance().GetUserByEmail(ctx, utils.ORPHANED_PROJECTS_OWNER_EMAIL); err == nil {
+		return user, nil
+	}
+
+	user, err := dbmanager.Instance().RegisterNewUser(ctx, &model.User{
+		Name:  utils.ORPHANED_PROJECTS_OWNER_NAME,
+		Email: utils.ORPHANED_PROJECTS_OWNER_EMAIL,
+		Role:  utils.ROLE_USER,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, nil, utils.AUDIT_USER, user.ID, utils.AUDIT_CREATE, nil, userAuditValues(user))
+	return user, nil
+}
+
+// updateCheckedProject reads the project again, so the repair is written on its current version, and writes the
+// change made by update. The repairs are not made by a user, so the audit entries have no actor.
+func (service *serviceImp) updateCheckedProject(ctx context.Context, projectId model.ID, update func(project *model.Project)) error {
+	stored, err := dbmanager.Instance().GetProject(ctx, projectId)
+	if err != nil {
+		return err
+	}
+
+	project := *stored
+	update(&project)
+	result, err := dbmanager.Instance().UpdateProject(ctx, &project)
+	if err != nil {
+		return err
+	}
+
+	service.audit(ctx, nil, utils.AUDIT_PROJECT, result.ID, utils.AUDIT_UPDATE,
+		projectAuditValues(stored), projectAuditValues(result))
+	service.events.Publish(Event{Type: utils.EVENT_PROJECT_UPDATED, Project: result})
+	return nil
+}
+
+// missingIds returns the ids of first that are not in second.
+func missingIds(first, second model.IDList) model.IDList {
+	present := idSet(second)
+
+	result := model.IDList{}
+	for _, id := range first {
+		if !present[id.ToString()] {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
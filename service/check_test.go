@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/settings"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+func TestFindInconsistencies(t *testing.T) {
+	john := &model.User{ID: &privateId{id: "u1"}, Email: "john@picnic.com"}
+	johnAdmin := &model.User{ID: &privateId{id: "u2"}, Email: "John@Picnic.com", Role: utils.ROLE_ADMIN}
+	jane := &model.User{ID: &privateId{id: "u3"}, Email: "jane@picnic.com"}
+	acme := &model.Customer{
+		ID:       &privateId{id: "c1"},
+		Projects: model.ProjectList{{ID: &privateId{id: "p1"}}, {ID: &privateId{id: "p9"}}},
+	}
+
+	projects := model.ProjectList{
+		{ID: &privateId{id: "p1"}, Owner: jane, Customer: acme},
+		{ID: &privateId{id: "p2"}, Owner: &model.User{ID: &privateId{id: "u9"}}, Customer: acme},
+		{ID: &privateId{id: "p3"}, Owner: jane, Customer: &model.Customer{ID: &privateId{id: "c9"}}},
+		{ID: &privateId{id: "p4"}, Owner: nil, Customer: nil},
+	}
+
+	inconsistencies := findInconsistencies(model.UserList{john, johnAdmin, jane}, projects, model.CustomerList{acme})
+	if len(inconsistencies) != 5 {
+		t.Fatal("There must be five inconsistencies: ", inconsistencies)
+	}
+
+	expected := []string{
+		"project p2: owner u9 not found",
+		"project p3: customer c9 not found",
+		"customer c1: lists projects not found or not of the customer: p9",
+		"customer c1: does not list its projects: p2",
+		"user u2: same email as users u1",
+	}
+	for i, inconsistency := range inconsistencies {
+		if inconsistency.String() != expected[i] {
+			t.Errorf("Inconsistency %d must be %q, not %q", i, expected[i], inconsistency.String())
+		}
+	}
+}
+
+func TestFindInconsistenciesOfConsistentData(t *testing.T) {
+	john := &model.User{ID: &privateId{id: "u1"}, Email: "john@picnic.com"}
+	acme := &model.Customer{ID: &privateId{id: "c1"}, Projects: model.ProjectList{{ID: &privateId{id: "p1"}}}}
+	projects := model.ProjectList{{ID: &privateId{id: "p1"}, Owner: john, Customer: acme}}
+
+	if inconsistencies := findInconsistencies(model.UserList{john}, projects, model.CustomerList{acme}); len(inconsistencies) != 0 {
+		t.Error("Consistent data cannot have inconsistencies: ", inconsistencies)
+	}
+}
+
+// legacyDbManager is a database written by a previous version: a user was removed before the owners of the projects
+// were checked, so its projects reference an owner that is not found, and the emails were stored as they were typed.
+type legacyDbManager struct {
+	dbmanager.DBManager
+	removed model.ID
+	// emails maps the emails stored to the ones the previous version wrote.
+	emails map[string]string
+	// customersLost makes AllCustomers return nothing, like a query that failed without reporting it.
+	customersLost bool
+}
+
+func (dbManager *legacyDbManager) isRemoved(id model.ID) bool {
+	return id != nil && dbManager.removed != nil && id.ToString() == dbManager.removed.ToString()
+}
+
+func (dbManager *legacyDbManager) GetUserByID(ctx context.Context, id model.ID) (*model.User, error) {
+	if dbManager.isRemoved(id) {
+		return nil, errors.New("user not found")
+	}
+
+	return dbManager.DBManager.GetUserByID(ctx, id)
+}
+
+func (dbManager *legacyDbManager) AllCustomers(
+	ctx context.Context,
+	filter *model.CustomerFilter,
+	orderBy *model.OrderBy) (model.CustomerList, error) {
+
+	if dbManager.customersLost {
+		return model.CustomerList{}, nil
+	}
+
+	return dbManager.DBManager.AllCustomers(ctx, filter, orderBy)
+}
+
+func (dbManager *legacyDbManager) AllUsers(
+	ctx context.Context,
+	filter *model.UserFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.UserList, error) {
+
+	users, err := dbManager.DBManager.AllUsers(ctx, filter, orderBy, startPosition, offset)
+	result := model.UserList{}
+	for _, user := range users {
+		if dbManager.isRemoved(user.ID) {
+			continue
+		} else if email, ok := dbManager.emails[user.Email]; ok {
+			user.Email = email
+		}
+		result = append(result, user)
+	}
+
+	return result, err
+}
+
+// useMemoryDatabase installs a new in-memory database, with the settings loaded for it. The function returned
+// restores the previous database and environment, and loads the settings of that environment again.
+func useMemoryDatabase(t *testing.T) (dbmanager.DBManager, func()) {
+	driver, driverSet := os.LookupEnv("PICNIC_DB_DRIVER")
+	os.Setenv("PICNIC_DB_DRIVER", "memory")
+	previous := dbmanager.SetInstance(nil)
+
+	restore := func() {
+		dbmanager.SetInstance(previous)
+		if driverSet {
+			os.Setenv("PICNIC_DB_DRIVER", driver)
+		} else {
+			os.Unsetenv("PICNIC_DB_DRIVER")
+		}
+		settings.Load()
+	}
+
+	if err := settings.Load(); err != nil {
+		restore()
+		t.Fatal(err)
+	}
+
+	memory := dbmanager.Instance()
+	if err := memory.Open(); err != nil {
+		restore()
+		t.Fatal(err)
+	}
+
+	return memory, restore
+}
+
+func TestCheckConsistencyFixesTheMemoryDatabase(t *testing.T) {
+	ctx := context.Background()
+	memory, restore := useMemoryDatabase(t)
+	defer restore()
+
+	john, err := memory.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	johnAdmin, err := memory.RegisterNewUser(ctx, &model.User{Email: "john.smith@picnic.com", Role: utils.ROLE_ADMIN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := memory.RegisterNewUser(ctx, &model.User{Email: "removed@picnic.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	customer, err := memory.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	johnProject, err := memory.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: john, Customer: customer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanedProject, err := memory.CreateProject(ctx, &model.Project{Name: "Orphaned", Owner: removed, Customer: customer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbmanager.SetInstance(&legacyDbManager{
+		DBManager: memory,
+		removed:   removed.ID,
+		emails:    map[string]string{johnAdmin.Email: "John@Picnic.com"},
+	})
+
+	service := &serviceImp{events: NewEventBus(EVENT_BUFFER_SIZE)}
+	inconsistencies, err := service.CheckConsistency(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(inconsistencies) != 2 {
+		t.Fatal("There must be a missing owner and duplicate users: ", inconsistencies)
+	}
+
+	for _, inconsistency := range inconsistencies {
+		if !inconsistency.Fixed {
+			t.Errorf("Inconsistency %q was not fixed.", inconsistency.String())
+		}
+	}
+
+	if project, err := memory.GetProject(ctx, johnProject.ID); err != nil {
+		t.Error(err)
+	} else if project.OwnerID().ToString() != johnAdmin.ID.ToString() {
+		t.Error("The project of the duplicate must be moved to the user kept. Owner: ", project.OwnerID().ToString())
+	}
+
+	if _, err := memory.GetUserByID(ctx, john.ID); err == nil {
+		t.Error("The duplicate user must be deleted.")
+	} else if user, err := memory.GetUserByID(ctx, johnAdmin.ID); err != nil {
+		t.Error(err)
+	} else if user.Email != "john@picnic.com" {
+		t.Error("The user kept must have the email in lower case, not ", user.Email)
+	}
+
+	if owner, err := memory.GetUserByEmail(ctx, utils.ORPHANED_PROJECTS_OWNER_EMAIL); err != nil {
+		t.Error("The orphaned projects owner must be created: ", err)
+	} else if project, err := memory.GetProject(ctx, orphanedProject.ID); err != nil {
+		t.Error(err)
+	} else if project.OwnerID().ToString() != owner.ID.ToString() {
+		t.Error("The orphaned project must be moved to the orphaned projects owner. Owner: ", project.OwnerID().ToString())
+	}
+
+	if inconsistencies, err := service.CheckConsistency(ctx, false); err != nil {
+		t.Error(err)
+	} else if len(inconsistencies) != 0 {
+		t.Error("The inconsistencies fixed cannot be found again: ", inconsistencies)
+	}
+}
+
+func TestCheckConsistencyDoesNotFixIncompleteData(t *testing.T) {
+	ctx := context.Background()
+	memory, restore := useMemoryDatabase(t)
+	defer restore()
+
+	john, err := memory.RegisterNewUser(ctx, &model.User{Email: "john@picnic.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	customer, err := memory.CreateCustomer(ctx, &model.Customer{Name: "ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := memory.CreateProject(ctx, &model.Project{Name: "Picnic", Owner: john, Customer: customer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbmanager.SetInstance(&legacyDbManager{DBManager: memory, customersLost: true})
+
+	service := &serviceImp{events: NewEventBus(EVENT_BUFFER_SIZE)}
+	if _, err := service.CheckConsistency(ctx, true); err == nil {
+		t.Error("The repairs must be refused when no customer is read but the projects have one.")
+	}
+
+	if stored, err := memory.GetProject(ctx, project.ID); err != nil {
+		t.Error(err)
+	} else if stored.CustomerID() == nil {
+		t.Error("The customer of the project cannot be removed.")
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// ConflictError is returned by the updates sent with a version that is not the stored one, because the entity was
+// modified since the caller read it. Project is set in the conflicts of projects and Customer in the conflicts of
+// customers, with their current state, so the caller can apply its changes again on top of it.
+type ConflictError struct {
+	Resource string
+	ID       string
+	Version  int64
+	Project  *model.Project
+	Customer *model.Customer
+}
+
+func (err *ConflictError) Error() string {
+	var current int64
+	if err.Project != nil {
+		current = err.Project.Version
+	} else if err.Customer != nil {
+		current = err.Customer.Version
+	}
+
+	return fmt.Sprintf("conflict: %s %s was modified since version %d. The current version is %d",
+		err.Resource, err.ID, err.Version, current)
+}
+
+// projectConflict returns the conflict of an update of the project. current is the stored project, or nil when it was
+// written by another update after it was read, in which case it is read again.
+func projectConflict(ctx context.Context, project, current *model.Project) error {
+	if current == nil {
+		var err error
+		if current, err = dbmanager.Instance().GetProject(ctx, project.ID); err != nil {
+			return err
+		}
+	}
+
+	err := &ConflictError{Resource: "project", ID: project.ID.ToString(), Version: project.Version, Project: current}
+	utils.ContextLogger(ctx).Error(err)
+	return err
+}
+
+// customerConflict returns the conflict of an update of the customer. current is the stored customer, or nil when it
+// was written by another update after it was read, in which case it is read again.
+func customerConflict(ctx context.Context, customer, current *model.Customer) error {
+	if current == nil {
+		var err error
+		if current, err = dbmanager.Instance().GetCustomerByID(ctx, customer.ID); err != nil {
+			return err
+		}
+	}
+
+	err := &ConflictError{Resource: "customer", ID: customer.ID.ToString(), Version: customer.Version, Customer: current}
+	utils.ContextLogger(ctx).Error(err)
+	return err
+}
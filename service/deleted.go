@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/metrics"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+var purgedRecords = metrics.NewCounter(
+	"picnic_purged_records_total",
+	"Deleted users, projects and customers removed permanently once their retention period was over.")
+
+// IncludeDeleted returns a copy of ctx whose reads include the deleted users, projects and customers that were not
+// purged yet. Only admins can read them.
+func (service *serviceImp) IncludeDeleted(ctx context.Context, actor *model.User) (context.Context, error) {
+	if err := service.policy.CanReadDeleted(actor); err != nil {
+		utils.ContextLogger(ctx).Error(err)
+		return nil, err
+	}
+
+	return dbmanager.WithDeleted(ctx), nil
+}
+
+// RestoreProject undoes the deletion of a project that was not purged yet. The subscribers receive it as a created
+// project.
+func (service *serviceImp) RestoreProject(ctx context.Context, actor *model.User, projectId model.ID) (*model.Project, error) {
+	stored, err := dbmanager.Instance().GetProject(dbmanager.WithDeleted(ctx), projectId)
+	if err != nil {
+		return nil, err
+	} else if err = service.policy.CanModifyProject(actor, stored); err != nil {
+		return nil, err
+	}
+
+	result, err := dbmanager.Instance().RestoreProject(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_PROJECT, result.ID, utils.AUDIT_RESTORE,
+		deletedAuditValues(stored.DeletedAt), deletedAuditValues(result.DeletedAt))
+	service.events.Publish(Event{Type: utils.EVENT_PROJECT_CREATED, Project: result})
+	return result, nil
+}
+
+// RestoreCustomer undoes the deletion of a customer that was not purged yet. Only admins can restore customers, as
+// only they can delete them. The subscribers receive it as a created customer, and the projects restored with it as
+// created projects.
+func (service *serviceImp) RestoreCustomer(ctx context.Context, actor *model.User, customerId model.ID) (*model.Customer, error) {
+	if err := service.policy.CanDeleteCustomer(actor, &model.Customer{ID: customerId}); err != nil {
+		return nil, err
+	}
+
+	stored, err := dbmanager.Instance().GetCustomerByID(dbmanager.WithDeleted(ctx), customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := dbmanager.Instance().AllProjectsFromCustomer(ctx, customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := dbmanager.Instance().RestoreCustomer(ctx, customerId)
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_CUSTOMER, result.ID, utils.AUDIT_RESTORE,
+		deletedAuditValues(stored.DeletedAt), deletedAuditValues(result.DeletedAt))
+	service.events.Publish(Event{Type: utils.EVENT_CUSTOMER_CREATED, Customer: result})
+	service.auditRestoredProjects(ctx, actor, result.ID, stored.DeletedAt, projects)
+	return result, nil
+}
+
+// deletedAuditValues records the deleted date of an entity, which is the only field changed by a restore.
+func deletedAuditValues(deletedAt time.Time) auditValues {
+	if deletedAt.IsZero() {
+		return auditValues{utils.DELETED_AT_FIELD: nil}
+	}
+
+	return auditValues{utils.DELETED_AT_FIELD: deletedAt}
+}
+
+// startPurge removes the records deleted for longer than the retention period once now and then every interval,
+// until stopPurgeLoop is called.
+func (service *serviceImp) startPurge(retention, interval time.Duration) {
+	if service.stopPurge != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	service.stopPurge = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		service.purge(retention)
+		for {
+			select {
+			case <-ticker.C:
+				service.purge(retention)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (service *serviceImp) stopPurgeLoop() {
+	if service.stopPurge != nil {
+		close(service.stopPurge)
+		service.stopPurge = nil
+	}
+}
+
+func (service *serviceImp) purge(retention time.Duration) {
+	loggerObj := utils.LoggerObj()
+
+	deletedBefore := time.Now().UTC().Add(-retention)
+	if count, err := service.dbManager.PurgeDeleted(context.Background(), deletedBefore); err != nil {
+		loggerObj.Errorf("cannot purge the records deleted before %s: %s", deletedBefore.Format(time.RFC3339), err.Error())
+	} else if count > 0 {
+		purgedRecords.Add(float64(count))
+		loggerObj.Infof("Purged %d records deleted before %s", count, deletedBefore.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/freddy311082/picnic-server/metrics"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// EVENT_BUFFER_SIZE is how many events a subscriber can have pending before the new ones are dropped for it.
+const EVENT_BUFFER_SIZE = 64
+
+var droppedEvents = metrics.NewCounter(
+	"picnic_events_dropped_total",
+	"Events not delivered to a subscriber that was not reading them fast enough.")
+
+// Event is a change written by the service. Project is set in the project events and Customer in the customer
+// events. The deleted entities are sent as they were before being deleted.
+type Event struct {
+	Type     utils.EventTypeEnum
+	Project  *model.Project
+	Customer *model.Customer
+}
+
+// EventBus delivers the events published by the service to the subscribers of the same process, so no external
+// broker is needed. Publish never blocks: the events are dropped for the subscribers whose buffer is full. Subscribe
+// returns a channel that is closed when the context is done.
+type EventBus interface {
+	Publish(event Event)
+	Subscribe(ctx context.Context) <-chan Event
+}
+
+type eventBusImp struct {
+	mutex       sync.RWMutex
+	bufferSize  int
+	subscribers map[chan Event]bool
+}
+
+func NewEventBus(bufferSize int) EventBus {
+	return &eventBusImp{
+		bufferSize:  bufferSize,
+		subscribers: map[chan Event]bool{},
+	}
+}
+
+func (bus *eventBusImp) Publish(event Event) {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	for subscriber := range bus.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			droppedEvents.Inc()
+		}
+	}
+}
+
+func (bus *eventBusImp) Subscribe(ctx context.Context) <-chan Event {
+	subscriber := make(chan Event, bus.bufferSize)
+
+	bus.mutex.Lock()
+	bus.subscribers[subscriber] = true
+	bus.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		// the channel is closed with the write lock, so Publish never sends to a closed channel
+		bus.mutex.Lock()
+		delete(bus.subscribers, subscriber)
+		close(subscriber)
+		bus.mutex.Unlock()
+	}()
+
+	return subscriber
+}
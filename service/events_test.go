@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+func TestEventBusDeliversToEverySubscriber(t *testing.T) {
+	bus := NewEventBus(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	first, second := bus.Subscribe(ctx), bus.Subscribe(ctx)
+
+	bus.Publish(Event{Type: utils.EVENT_CUSTOMER_CREATED, Customer: &model.Customer{Name: "ACME"}})
+	// the buffers are full, so this event is dropped instead of blocking the publisher
+	bus.Publish(Event{Type: utils.EVENT_CUSTOMER_DELETED})
+
+	for _, events := range []<-chan Event{first, second} {
+		if event := <-events; event.Type != utils.EVENT_CUSTOMER_CREATED || event.Customer.Name != "ACME" {
+			t.Error("The subscriber received a wrong event: ", event)
+		}
+	}
+
+	cancel()
+	if _, ok := <-first; ok {
+		t.Error("The channel was not closed when the context was done")
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+// ForbiddenError is returned by every mutating Service method when the actor is not allowed to run it.
+type ForbiddenError struct {
+	Action   string
+	Resource string
+	ID       string
+}
+
+func (err *ForbiddenError) Error() string {
+	if err.ID == "" {
+		return fmt.Sprintf("forbidden: not allowed to %s %s", err.Action, err.Resource)
+	}
+
+	return fmt.Sprintf("forbidden: not allowed to %s %s %s", err.Action, err.Resource, err.ID)
+}
+
+// Policy decides whether an actor can run a mutating operation. The actor is nil for anonymous requests.
+type Policy interface {
+	CanCreateProject(actor *model.User, project *model.Project) error
+	CanModifyProject(actor *model.User, project *model.Project) error
+	CanTransferProject(actor *model.User, project *model.Project, owner model.ID) error
+	CanCreateCustomer(actor *model.User) error
+	CanModifyCustomer(actor *model.User, customer *model.Customer) error
+	CanDeleteCustomer(actor *model.User, customer *model.Customer) error
+	CanModifyUser(actor *model.User, user *model.User) error
+	CanChangeRole(actor *model.User, user *model.User) error
+	CanReadAuditLog(actor *model.User) error
+	CanReadDeleted(actor *model.User) error
+}
+
+// ownershipPolicyImp only allows the owner of a project, or an admin, to change it. Only admins can give a project to
+// another owner. Customers can be created and updated by any authenticated user, but only admins can delete them. Users
+// can only modify themselves unless they are admins. Only admins can read the audit log and the deleted records. When
+// authentication is disabled in settings.json anonymous actors are allowed to do everything.
+type ownershipPolicyImp struct {
+	authRequired bool
+}
+
+func (policy *ownershipPolicyImp) CanCreateProject(actor *model.User, project *model.Project) error {
+	if policy.isSuperUser(actor) {
+		return nil
+	}
+
+	if actor == nil || project.Owner == nil || !sameID(actor.ID, project.Owner.ID) {
+		return &ForbiddenError{Action: "create", Resource: "project owned by another user"}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanModifyProject(actor *model.User, project *model.Project) error {
+	if policy.isSuperUser(actor) {
+		return nil
+	}
+
+	if actor == nil || project.Owner == nil || !sameID(actor.ID, project.Owner.ID) {
+		return &ForbiddenError{Action: "modify", Resource: "project", ID: idString(project.ID)}
+	}
+
+	return nil
+}
+
+// CanTransferProject checks the change of the owner of the stored project to owner.
+func (policy *ownershipPolicyImp) CanTransferProject(actor *model.User, project *model.Project, owner model.ID) error {
+	if policy.isSuperUser(actor) || idString(project.OwnerID()) == idString(owner) {
+		return nil
+	}
+
+	return &ForbiddenError{Action: "transfer", Resource: "project", ID: idString(project.ID)}
+}
+
+func (policy *ownershipPolicyImp) CanCreateCustomer(actor *model.User) error {
+	if actor == nil && !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "create", Resource: "customer"}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanModifyCustomer(actor *model.User, customer *model.Customer) error {
+	if actor == nil && !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "modify", Resource: "customer", ID: idString(customer.ID)}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanDeleteCustomer(actor *model.User, customer *model.Customer) error {
+	if !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "delete", Resource: "customer", ID: idString(customer.ID)}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanModifyUser(actor *model.User, user *model.User) error {
+	if policy.isSuperUser(actor) {
+		return nil
+	}
+
+	if actor == nil || !sameID(actor.ID, user.ID) {
+		return &ForbiddenError{Action: "modify", Resource: "user", ID: idString(user.ID)}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanChangeRole(actor *model.User, user *model.User) error {
+	if !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "change the role of", Resource: "user", ID: idString(user.ID)}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanReadAuditLog(actor *model.User) error {
+	if !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "read", Resource: "audit log"}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) CanReadDeleted(actor *model.User) error {
+	if !policy.isSuperUser(actor) {
+		return &ForbiddenError{Action: "read", Resource: "deleted records"}
+	}
+
+	return nil
+}
+
+func (policy *ownershipPolicyImp) isSuperUser(actor *model.User) bool {
+	return actor.IsAdmin() || (actor == nil && !policy.authRequired)
+}
+
+func sameID(first, second model.ID) bool {
+	return first != nil && second != nil && first.ToString() == second.ToString()
+}
+
+func idString(id model.ID) string {
+	if id == nil {
+		return ""
+	}
+
+	return id.ToString()
+}
+
+func NewOwnershipPolicy(authRequired bool) Policy {
+	return &ownershipPolicyImp{authRequired: authRequired}
+}
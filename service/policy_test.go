@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+func TestOnlyOwnerOrAdminCanModifyProject(t *testing.T) {
+	policy := NewOwnershipPolicy(true)
+	owner := &model.User{ID: &privateId{id: "1"}}
+	stranger := &model.User{ID: &privateId{id: "2"}}
+	admin := &model.User{ID: &privateId{id: "3"}, Role: utils.ROLE_ADMIN}
+	project := &model.Project{ID: &privateId{id: "4"}, Owner: &model.User{ID: &privateId{id: "1"}}}
+
+	if err := policy.CanModifyProject(owner, project); err != nil {
+		t.Error("The owner must be allowed to modify the project.")
+	}
+
+	if err := policy.CanModifyProject(admin, project); err != nil {
+		t.Error("An admin must be allowed to modify the project.")
+	}
+
+	if _, ok := policy.CanModifyProject(stranger, project).(*ForbiddenError); !ok {
+		t.Error("A user who is not the owner must get a ForbiddenError.")
+	}
+
+	if _, ok := policy.CanModifyProject(nil, project).(*ForbiddenError); !ok {
+		t.Error("An anonymous actor must get a ForbiddenError.")
+	}
+}
+
+func TestOnlyAdminCanTransferProject(t *testing.T) {
+	policy := NewOwnershipPolicy(true)
+	owner := &model.User{ID: &privateId{id: "1"}}
+	admin := &model.User{ID: &privateId{id: "3"}, Role: utils.ROLE_ADMIN}
+	project := &model.Project{ID: &privateId{id: "4"}, Owner: &model.User{ID: &privateId{id: "1"}}}
+
+	if err := policy.CanTransferProject(owner, project, &privateId{id: "1"}); err != nil {
+		t.Error("Keeping the owner of the project is not a transfer.")
+	}
+
+	if _, ok := policy.CanTransferProject(owner, project, &privateId{id: "2"}).(*ForbiddenError); !ok {
+		t.Error("The owner must get a ForbiddenError when giving the project to another user.")
+	}
+
+	if err := policy.CanTransferProject(admin, project, &privateId{id: "2"}); err != nil {
+		t.Error("An admin must be allowed to give the project to another user.")
+	}
+}
+
+func TestAnonymousActorIsAllowedWhenAuthIsDisabled(t *testing.T) {
+	policy := NewOwnershipPolicy(false)
+	project := &model.Project{ID: &privateId{id: "4"}, Owner: &model.User{ID: &privateId{id: "1"}}}
+
+	if err := policy.CanModifyProject(nil, project); err != nil {
+		t.Error("Anonymous actors must be allowed when authentication is disabled.")
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// ValidationError is returned when a value sent by the caller does not satisfy the rules of the model.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Message)
+}
+
+// validateProjectFields checks the definition of every custom field and its value. Fields without a value take their
+// default value.
+func validateProjectFields(fields model.ProjectFieldList) error {
+	names := map[string]bool{}
+
+	for i := range fields {
+		field := &fields[i]
+		fieldName := "fields." + field.Name
+
+		if field.Name == "" {
+			return &ValidationError{Field: "fields", Message: "field name cannot be empty"}
+		} else if names[field.Name] {
+			return &ValidationError{Field: fieldName, Message: "field name is duplicated"}
+		} else if field.Type < utils.FIELD_TYPE_TEXT || field.Type > utils.FIELD_TYPE_BOOLEAN {
+			return &ValidationError{Field: fieldName, Message: "unknown field type"}
+		}
+		names[field.Name] = true
+
+		if err := validateFieldOptions(field); err != nil {
+			return &ValidationError{Field: fieldName, Message: err.Error()}
+		}
+
+		if field.Default != nil && !isValidFieldValue(field, field.Default) {
+			return &ValidationError{Field: fieldName, Message: "default value does not match the field type"}
+		}
+
+		if field.Value == nil {
+			field.Value = field.Default
+		}
+
+		if field.Value == nil && field.Required {
+			return &ValidationError{Field: fieldName, Message: "value is required"}
+		} else if field.Value != nil && !isValidFieldValue(field, field.Value) {
+			return &ValidationError{Field: fieldName, Message: "value does not match the field type"}
+		}
+	}
+
+	return nil
+}
+
+func validateFieldOptions(field *model.ProjectField) error {
+	if field.Type != utils.FIELD_TYPE_ENUM {
+		if len(field.Options) > 0 {
+			return errors.New("only enum fields can have options")
+		}
+		return nil
+	}
+
+	if len(field.Options) == 0 {
+		return errors.New("enum fields must have at least one option")
+	}
+
+	options := map[string]bool{}
+	for _, option := range field.Options {
+		if option == "" || options[option] {
+			return errors.New("enum options cannot be empty or duplicated")
+		}
+		options[option] = true
+	}
+
+	return nil
+}
+
+func isValidFieldValue(field *model.ProjectField, value interface{}) bool {
+	switch field.Type {
+	case utils.FIELD_TYPE_TEXT:
+		_, ok := value.(string)
+		return ok
+	case utils.FIELD_TYPE_NUMBER:
+		_, ok := value.(float64)
+		return ok
+	case utils.FIELD_TYPE_DATE:
+		_, ok := value.(time.Time)
+		return ok
+	case utils.FIELD_TYPE_BOOLEAN:
+		_, ok := value.(bool)
+		return ok
+	case utils.FIELD_TYPE_ENUM:
+		if option, ok := value.(string); ok {
+			for _, value := range field.Options {
+				if value == option {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
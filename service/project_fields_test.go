@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+func TestDefaultValueIsAppliedToProjectField(t *testing.T) {
+	fields := model.ProjectFieldList{
+		{Name: "budget", Type: utils.FIELD_TYPE_NUMBER, Required: true, Default: 100.0},
+	}
+
+	if err := validateProjectFields(fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields[0].Value != 100.0 {
+		t.Error("The default value must be used when the field has no value.")
+	}
+}
+
+func TestInvalidProjectFieldValuesAreRejected(t *testing.T) {
+	invalidFields := []model.ProjectFieldList{
+		{{Name: "budget", Type: utils.FIELD_TYPE_NUMBER, Required: true}},
+		{{Name: "budget", Type: utils.FIELD_TYPE_NUMBER, Value: "100"}},
+		{{Name: "stage", Type: utils.FIELD_TYPE_ENUM, Options: []string{"draft", "done"}, Value: "closed"}},
+		{{Name: "stage", Type: utils.FIELD_TYPE_TEXT, Options: []string{"draft"}}},
+		{{Name: "note", Type: utils.FIELD_TYPE_TEXT}, {Name: "note", Type: utils.FIELD_TYPE_TEXT}},
+	}
+
+	for _, fields := range invalidFields {
+		if _, ok := validateProjectFields(fields).(*ValidationError); !ok {
+			t.Errorf("Fields %v must be rejected with a ValidationError.", fields)
+		}
+	}
+}
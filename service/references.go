@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/freddy311082/picnic-server/dbmanager"
+	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// ReferencedError is returned by the deletes of users and customers rejected by the restrict delete rule, because
+// there are projects that reference them.
+type ReferencedError = dbmanager.ReferencedError
+
+// auditDeleteRule records and publishes the changes made by the delete rule to projects, the projects that referenced
+// the customers or the user deleted, as they were read before the delete.
+func (service *serviceImp) auditDeleteRule(
+	ctx context.Context,
+	actor *model.User,
+	rule utils.OnDeleteEnum,
+	projects model.ProjectList) {
+
+	if len(projects) == 0 {
+		return
+	}
+
+	switch rule {
+	case utils.ON_DELETE_CASCADE:
+		for _, project := range projects {
+			service.audit(ctx, actor, utils.AUDIT_PROJECT, project.ID, utils.AUDIT_DELETE, projectAuditValues(project), nil)
+			service.events.Publish(Event{Type: utils.EVENT_PROJECT_DELETED, Project: project})
+		}
+	case utils.ON_DELETE_SET_NULL:
+		updated, err := dbmanager.Instance().AllProjectWhereIDIsIn(ctx, projects.IDs())
+		if err != nil {
+			loggerObj := utils.ContextLogger(ctx)
+			loggerObj.Errorf("cannot read the projects updated by the delete rule: %s", err.Error())
+			return
+		}
+
+		before := map[string]*model.Project{}
+		for _, project := range projects {
+			before[project.ID.ToString()] = project
+		}
+
+		for _, project := range updated {
+			service.audit(ctx, actor, utils.AUDIT_PROJECT, project.ID, utils.AUDIT_UPDATE,
+				projectAuditValues(before[project.ID.ToString()]), projectAuditValues(project))
+			service.events.Publish(Event{Type: utils.EVENT_PROJECT_UPDATED, Project: project})
+		}
+	}
+}
+
+// auditRestoredProjects records and publishes the projects restored with a customer deleted at deletedAt, which are
+// the projects of the customer that were not in projects, the projects read before the restore.
+func (service *serviceImp) auditRestoredProjects(
+	ctx context.Context,
+	actor *model.User,
+	customerId model.ID,
+	deletedAt time.Time,
+	projects model.ProjectList) {
+
+	restored, err := dbmanager.Instance().AllProjectsFromCustomer(ctx, customerId)
+	if err != nil {
+		loggerObj := utils.ContextLogger(ctx)
+		loggerObj.Errorf("cannot read the projects restored with customer %s: %s", customerId.ToString(), err.Error())
+		return
+	}
+
+	before := idSet(projects.IDs())
+	for _, project := range restored {
+		if !before[project.ID.ToString()] {
+			service.audit(ctx, actor, utils.AUDIT_PROJECT, project.ID, utils.AUDIT_RESTORE,
+				deletedAuditValues(deletedAt), deletedAuditValues(project.DeletedAt))
+			service.events.Publish(Event{Type: utils.EVENT_PROJECT_CREATED, Project: project})
+		}
+	}
+}
+
+func idSet(ids model.IDList) map[string]bool {
+	result := map[string]bool{}
+	for _, id := range ids {
+		result[id.ToString()] = true
+	}
+
+	return result
+}
@@ -1,10 +1,15 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"github.com/freddy311082/picnic-server/auth"
 	"github.com/freddy311082/picnic-server/dbmanager"
 	"github.com/freddy311082/picnic-server/model"
+	"github.com/freddy311082/picnic-server/settings"
 	"github.com/freddy311082/picnic-server/utils"
+	"strings"
+	"time"
 )
 
 type privateId struct {
@@ -17,214 +22,613 @@ func (objId *privateId) ToString() string {
 
 type Service interface {
 	Init() error
-	AllUsers(startPosition, offset int) (model.UserList, error)
-	RegisterUser(user *model.User) (*model.User, error)
-	GetUser(user *model.User) (*model.User, error)
-	DeleteUser(user *model.User) error
-	AllUsersWhereIDIsIn(ids model.IDList) (model.UserList, error)
-	CreateProject(project *model.Project) (*model.Project, error)
-	AllProjects(startPosition, offset int) (model.ProjectList, error)
-	AllProjectsByUser(user *model.User) (model.ProjectList, error)
-	AddProject(project *model.Project) (*model.Project, error)
-	UpdateProject(project *model.Project) (*model.Project, error)
-	DeleteProject(projectId model.ID) error
-	DeleteProjects(ids model.IDList) error
-	AllProjectWhereIDIsIn(ids model.IDList) (model.ProjectList, error)
-	CreateCustomer(customer *model.Customer) (*model.Customer, error)
-	UpdateCustomer(customer *model.Customer) (*model.Customer, error)
-	DeleteCustomer(customerId model.ID) error
-	DeleteCustomers(ids model.IDList) error
-	AllCustomers() (model.CustomerList, error)
-	AllCustomersWhereIDIsIn(ids model.IDList) (model.CustomerList, error)
+	Close() error
+	Ping(ctx context.Context) error
+	AllUsers(ctx context.Context, filter *model.UserFilter, orderBy *model.OrderBy, startPosition, offset int) (model.UserList, error)
+	UsersPage(ctx context.Context, page *model.PageRequest) (model.UserList, *model.PageInfo, error)
+	CountUsers(ctx context.Context) (int64, error)
+	RegisterUser(ctx context.Context, user *model.User) (*model.User, error)
+	GetUser(ctx context.Context, user *model.User) (*model.User, error)
+	DeleteUser(ctx context.Context, actor *model.User, user *model.User) error
+	SetUserRole(ctx context.Context, actor *model.User, userId model.ID, role utils.UserRoleEnum) (*model.User, error)
+	AllUsersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.UserList, error)
+	CreateProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error)
+	AllProjects(
+		ctx context.Context,
+		filter *model.ProjectFilter,
+		orderBy *model.OrderBy,
+		startPosition, offset int) (model.ProjectList, error)
+	ProjectsPage(ctx context.Context, page *model.PageRequest) (model.ProjectList, *model.PageInfo, error)
+	CountProjects(ctx context.Context) (int64, error)
+	AllProjectsByUser(ctx context.Context, user *model.User) (model.ProjectList, error)
+	AddProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error)
+	UpdateProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error)
+	DeleteProject(ctx context.Context, actor *model.User, projectId model.ID) error
+	DeleteProjects(ctx context.Context, actor *model.User, ids model.IDList) error
+	AllProjectWhereIDIsIn(ctx context.Context, ids model.IDList) (model.ProjectList, error)
+	CreateCustomer(ctx context.Context, actor *model.User, customer *model.Customer) (*model.Customer, error)
+	UpdateCustomer(ctx context.Context, actor *model.User, customer *model.Customer) (*model.Customer, error)
+	DeleteCustomer(ctx context.Context, actor *model.User, customerId model.ID) error
+	DeleteCustomers(ctx context.Context, actor *model.User, ids model.IDList) error
+	AllCustomers(ctx context.Context, filter *model.CustomerFilter, orderBy *model.OrderBy) (model.CustomerList, error)
+	CustomersPage(ctx context.Context, page *model.PageRequest) (model.CustomerList, *model.PageInfo, error)
+	CountCustomers(ctx context.Context) (int64, error)
+	AllCustomersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.CustomerList, error)
 	CreateModelIDFromString(strId string) model.ID
-	GetOwnerFromProjectID(projectId model.ID) (*model.User, error)
-	GetCustomerByID(customerId model.ID) (*model.Customer, error)
-	AllProjectsFromCustomer(customerId model.ID) (model.ProjectList, error)
-	GetProjectByID(projectId model.ID) (*model.Project, error)
+	GetOwnerFromProjectID(ctx context.Context, projectId model.ID) (*model.User, error)
+	GetCustomerByID(ctx context.Context, customerId model.ID) (*model.Customer, error)
+	AllProjectsFromCustomer(ctx context.Context, customerId model.ID) (model.ProjectList, error)
+	AllProjectsFromCustomers(ctx context.Context, customerIds model.IDList) (model.ProjectList, error)
+	AllProjectsFromUsers(ctx context.Context, userIds model.IDList) (model.ProjectList, error)
+	GetProjectByID(ctx context.Context, projectId model.ID) (*model.Project, error)
+	RequestLoginCode(ctx context.Context, email string) error
+	Login(ctx context.Context, email, code string) (*model.User, time.Time, error)
+	Authenticate(ctx context.Context, token string) (*model.User, error)
+	GetPersistedQuery(ctx context.Context, hash string) (string, error)
+	SavePersistedQuery(ctx context.Context, hash, query string) error
+	Subscribe(ctx context.Context) <-chan Event
+	AuditLog(ctx context.Context, actor *model.User, filter *model.AuditFilter) (model.AuditEntryList, error)
+	IncludeDeleted(ctx context.Context, actor *model.User) (context.Context, error)
+	RestoreProject(ctx context.Context, actor *model.User, projectId model.ID) (*model.Project, error)
+	RestoreCustomer(ctx context.Context, actor *model.User, customerId model.ID) (*model.Customer, error)
+	CheckConsistency(ctx context.Context, fix bool) (InconsistencyList, error)
 }
 
+// Every mutating method receives the user running it as actor, which is checked against the service policy before
+// anything is written. The actor is nil for anonymous requests. The projects and customers written are published to
+// the event bus once the database confirms the change, and every change is recorded in the audit log.
 type serviceImp struct {
-	dbManager dbmanager.DBManager
+	dbManager    dbmanager.DBManager
+	tokenManager auth.TokenManager
+	loginCodes   auth.LoginCodes
+	policy       Policy
+	events       EventBus
+	// stopPurge is closed by Close to stop the purge of the deleted records started by Init.
+	stopPurge chan struct{}
 }
 
-func (service *serviceImp) GetProjectByID(projectId model.ID) (*model.Project, error) {
-	return dbmanager.Instance().GetProject(projectId)
+func (service *serviceImp) RequestLoginCode(ctx context.Context, email string) error {
+	loggerObj := utils.ContextLogger(ctx)
+
+	// the code is generated for unknown emails too, so the requests are limited the same way and the caller is not
+	// told whether the email is registered or not.
+	code, err := service.loginCodes.Generate(email)
+	if err != nil {
+		loggerObj.Error(err)
+		return err
+	}
+
+	if _, err := dbmanager.Instance().GetUserByEmail(ctx, email); err != nil {
+		loggerObj.Warningf("login code requested for an unknown email %s", email)
+		return nil
+	}
+
+	return auth.MailerObj().Send(email, "Your Picnic login code",
+		fmt.Sprintf("Use the code %s to log in to Picnic. It expires in %s.",
+			code, settings.SettingsObj().AuthSettings().CodeTTL()))
+}
+
+func (service *serviceImp) Login(ctx context.Context, email, code string) (*model.User, time.Time, error) {
+	loggerObj := utils.ContextLogger(ctx)
+
+	if err := service.loginCodes.Verify(email, code); err != nil {
+		loggerObj.Errorf("failed login for %s", email)
+		return nil, time.Time{}, err
+	}
+
+	user, err := dbmanager.Instance().GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	token, claims, err := service.tokenManager.Issue(user.ID.ToString(), user.Email)
+	if err != nil {
+		loggerObj.Error(err)
+		return nil, time.Time{}, err
+	}
+
+	user.Token = token
+	return user, claims.Expiration(), nil
+}
+
+func (service *serviceImp) Authenticate(ctx context.Context, token string) (*model.User, error) {
+	claims, err := service.tokenManager.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dbmanager.Instance().GetUserByID(ctx, service.CreateModelIDFromString(claims.UserID))
+	if err != nil {
+		// the user was removed after the token was issued.
+		return nil, auth.ErrInvalidToken
+	}
+
+	user.Token = token
+	return user, nil
 }
 
-func (service *serviceImp) AllProjectsFromCustomer(customerId model.ID) (model.ProjectList, error) {
-	return dbmanager.Instance().AllProjectsFromCustomer(customerId)
+func (service *serviceImp) GetProjectByID(ctx context.Context, projectId model.ID) (*model.Project, error) {
+	return dbmanager.Instance().GetProject(ctx, projectId)
 }
 
-func (service *serviceImp) GetCustomerByID(customerId model.ID) (*model.Customer, error) {
+func (service *serviceImp) AllProjectsFromCustomer(ctx context.Context, customerId model.ID) (model.ProjectList, error) {
+	return dbmanager.Instance().AllProjectsFromCustomer(ctx, customerId)
+}
+
+func (service *serviceImp) AllProjectsFromCustomers(ctx context.Context, customerIds model.IDList) (model.ProjectList, error) {
+	return dbmanager.Instance().AllProjectsFromCustomers(ctx, customerIds)
+}
+
+func (service *serviceImp) AllProjectsFromUsers(ctx context.Context, userIds model.IDList) (model.ProjectList, error) {
+	return dbmanager.Instance().AllProjectsFromUsers(ctx, userIds)
+}
+
+func (service *serviceImp) GetCustomerByID(ctx context.Context, customerId model.ID) (*model.Customer, error) {
 	if customerId == nil {
-		return nil, errors.New("customerID cannot be null")
+		return nil, invalidInput(ctx, "customer_id", "cannot be null")
 	}
 
-	return dbmanager.Instance().GetCustomerByID(customerId)
+	return dbmanager.Instance().GetCustomerByID(ctx, customerId)
 }
 
-func (service *serviceImp) GetOwnerFromProjectID(projectId model.ID) (*model.User, error) {
-	return dbmanager.Instance().GetOwnerFromProjectID(projectId)
+func (service *serviceImp) GetOwnerFromProjectID(ctx context.Context, projectId model.ID) (*model.User, error) {
+	return dbmanager.Instance().GetOwnerFromProjectID(ctx, projectId)
 }
 
-func (service *serviceImp) AllUsersWhereIDIsIn(ids model.IDList) (model.UserList, error) {
-	return dbmanager.Instance().AllUsersWhereIDIsIn(ids)
+// GetPersistedQuery returns the GraphQL query registered with the sha256 hash, or an empty string when there is none.
+func (service *serviceImp) GetPersistedQuery(ctx context.Context, hash string) (string, error) {
+	return dbmanager.Instance().GetPersistedQuery(ctx, hash)
 }
 
-func (service *serviceImp) AllProjectWhereIDIsIn(ids model.IDList) (model.ProjectList, error) {
-	return dbmanager.Instance().AllProjectWhereIDIsIn(ids)
+func (service *serviceImp) SavePersistedQuery(ctx context.Context, hash, query string) error {
+	return dbmanager.Instance().SavePersistedQuery(ctx, hash, query)
 }
 
-func (service *serviceImp) CreateCustomer(customer *model.Customer) (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+// Subscribe returns the events of the changes written from now on, until the context is done.
+func (service *serviceImp) Subscribe(ctx context.Context) <-chan Event {
+	return service.events.Subscribe(ctx)
+}
 
-	if customer == nil || customer.Name == "" {
-		const msg = "unable to create a customer. CustomerID cannot be null or name cannot be empty"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+func (service *serviceImp) AllUsersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.UserList, error) {
+	return dbmanager.Instance().AllUsersWhereIDIsIn(ctx, ids)
+}
+
+func (service *serviceImp) AllProjectWhereIDIsIn(ctx context.Context, ids model.IDList) (model.ProjectList, error) {
+	return dbmanager.Instance().AllProjectWhereIDIsIn(ctx, ids)
+}
+
+func (service *serviceImp) CreateCustomer(ctx context.Context, actor *model.User, customer *model.Customer) (*model.Customer, error) {
+	loggerObj := utils.ContextLogger(ctx)
+
+	if customer == nil {
+		return nil, invalidInput(ctx, "customer", "cannot be null")
+	} else if customer.Name == "" {
+		return nil, invalidInput(ctx, "name", "cannot be empty")
+	}
+
+	if err := service.policy.CanCreateCustomer(actor); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	result, err := dbmanager.Instance().CreateCustomer(ctx, customer)
+	if err != nil {
+		return nil, err
 	}
 
-	return dbmanager.Instance().CreateCustomer(customer)
+	service.audit(ctx, actor, utils.AUDIT_CUSTOMER, result.ID, utils.AUDIT_CREATE, nil, customerAuditValues(result))
+	service.events.Publish(Event{Type: utils.EVENT_CUSTOMER_CREATED, Customer: result})
+	return result, nil
 }
 
-func (service *serviceImp) UpdateCustomer(customer *model.Customer) (*model.Customer, error) {
-	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
+func (service *serviceImp) UpdateCustomer(ctx context.Context, actor *model.User, customer *model.Customer) (*model.Customer, error) {
+	loggerObj := utils.ContextLogger(ctx)
 
-	if customer != nil || customer.Name == "" {
-		const msg = "unable to create a customer. CustomerID cannot be null or name cannot be empty"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+	if customer == nil {
+		return nil, invalidInput(ctx, "customer", "cannot be null")
+	} else if customer.ID == nil {
+		return nil, invalidInput(ctx, "id", "cannot be null")
+	} else if customer.Name == "" {
+		return nil, invalidInput(ctx, "name", "cannot be empty")
 	}
 
-	return dbmanager.Instance().UpdateCustomer(customer)
+	if err := service.policy.CanModifyCustomer(actor, customer); err != nil {
+		loggerObj.Error(err)
+		return nil, err
+	}
+
+	stored, err := dbmanager.Instance().GetCustomerByID(ctx, customer.ID)
+	if err != nil {
+		return nil, err
+	} else if stored.Version != customer.Version {
+		return nil, customerConflict(ctx, customer, stored)
+	}
+
+	result, err := dbmanager.Instance().UpdateCustomer(ctx, customer)
+	if err == dbmanager.ErrVersionConflict {
+		return nil, customerConflict(ctx, customer, nil)
+	} else if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_CUSTOMER, result.ID, utils.AUDIT_UPDATE,
+		customerAuditValues(stored), customerAuditValues(result))
+	service.events.Publish(Event{Type: utils.EVENT_CUSTOMER_UPDATED, Customer: result})
+	return result, nil
 }
 
-func (service *serviceImp) DeleteCustomer(customerId model.ID) error {
-	return dbmanager.Instance().DeleteCustomer(customerId)
+func (service *serviceImp) DeleteCustomer(ctx context.Context, actor *model.User, customerId model.ID) error {
+	if err := service.policy.CanDeleteCustomer(actor, &model.Customer{ID: customerId}); err != nil {
+		return err
+	}
+
+	// the customer and its projects are read before deleting them, so the subscribers and the audit log know which
+	// ones were deleted or updated by the delete rule
+	stored, err := dbmanager.Instance().GetCustomerByID(ctx, customerId)
+	if err != nil {
+		return err
+	}
+
+	projects, err := dbmanager.Instance().AllProjectsFromCustomer(ctx, customerId)
+	if err != nil {
+		return err
+	} else if err = dbmanager.Instance().DeleteCustomer(ctx, customerId); err != nil {
+		return err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_CUSTOMER, stored.ID, utils.AUDIT_DELETE, customerAuditValues(stored), nil)
+	service.events.Publish(Event{Type: utils.EVENT_CUSTOMER_DELETED, Customer: stored})
+	service.auditDeleteRule(ctx, actor, settings.SettingsObj().DBSettingsValues().OnDeleteCustomerProjects(), projects)
+	return nil
 }
 
-func (service *serviceImp) DeleteCustomers(ids model.IDList) error {
-	return dbmanager.Instance().DeleteCustomers(ids)
+func (service *serviceImp) DeleteCustomers(ctx context.Context, actor *model.User, ids model.IDList) error {
+	for _, id := range ids {
+		if err := service.policy.CanDeleteCustomer(actor, &model.Customer{ID: id}); err != nil {
+			return err
+		}
+	}
+
+	customers, err := dbmanager.Instance().AllCustomersWhereIDIsIn(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	projects, err := dbmanager.Instance().AllProjectsFromCustomers(ctx, ids)
+	if err != nil {
+		return err
+	} else if err = dbmanager.Instance().DeleteCustomers(ctx, ids); err != nil {
+		return err
+	}
+
+	for _, customer := range customers {
+		service.audit(ctx, actor, utils.AUDIT_CUSTOMER, customer.ID, utils.AUDIT_DELETE, customerAuditValues(customer), nil)
+		service.events.Publish(Event{Type: utils.EVENT_CUSTOMER_DELETED, Customer: customer})
+	}
+
+	service.auditDeleteRule(ctx, actor, settings.SettingsObj().DBSettingsValues().OnDeleteCustomerProjects(), projects)
+	return nil
+}
+
+func (service *serviceImp) AllCustomers(
+	ctx context.Context,
+	filter *model.CustomerFilter,
+	orderBy *model.OrderBy) (model.CustomerList, error) {
+
+	return dbmanager.Instance().AllCustomers(ctx, filter, orderBy)
+}
+
+func (service *serviceImp) CustomersPage(ctx context.Context, page *model.PageRequest) (model.CustomerList, *model.PageInfo, error) {
+	if err := validatePageRequest(ctx, page); err != nil {
+		return nil, nil, err
+	}
+
+	return dbmanager.Instance().CustomersPage(ctx, page)
 }
 
-func (service *serviceImp) AllCustomers() (model.CustomerList, error) {
-	return dbmanager.Instance().AllCustomers()
+func (service *serviceImp) CountCustomers(ctx context.Context) (int64, error) {
+	return dbmanager.Instance().CountCustomers(ctx)
 }
 
-func (service *serviceImp) AllCustomersWhereIDIsIn(ids model.IDList) (model.CustomerList, error) {
-	return dbmanager.Instance().AllCustomersWhereIDIsIn(ids)
+func (service *serviceImp) AllCustomersWhereIDIsIn(ctx context.Context, ids model.IDList) (model.CustomerList, error) {
+	return dbmanager.Instance().AllCustomersWhereIDIsIn(ctx, ids)
 }
 
-func (service *serviceImp) GetUser(user *model.User) (*model.User, error) {
+func (service *serviceImp) GetUser(ctx context.Context, user *model.User) (*model.User, error) {
 	if user == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		const msg = "user object cannot be null"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+		return nil, invalidInput(ctx, "user", "cannot be null")
 	}
 
 	if user.ID != nil {
-		return dbmanager.Instance().GetUserByID(user.ID)
+		return dbmanager.Instance().GetUserByID(ctx, user.ID)
 	} else {
-		return dbmanager.Instance().GetUserByEmail(user.Email)
+		return dbmanager.Instance().GetUserByEmail(ctx, user.Email)
 	}
 }
 
-func (service *serviceImp) DeleteUser(user *model.User) error {
+func (service *serviceImp) DeleteUser(ctx context.Context, actor *model.User, user *model.User) error {
 	if user == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		loggerObj.Error()
+		return invalidInput(ctx, "user", "cannot be null")
+	}
+
+	if err := service.policy.CanModifyUser(actor, user); err != nil {
+		return err
+	}
+
+	stored, err := dbmanager.Instance().GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	projects, err := dbmanager.Instance().AllProjectsFromUsers(ctx, model.IDList{stored.ID})
+	if err != nil {
+		return err
+	} else if err = dbmanager.Instance().DeleteUser(ctx, user.Email); err != nil {
+		return err
 	}
 
-	return dbmanager.Instance().DeleteUser(user.Email)
+	service.audit(ctx, actor, utils.AUDIT_USER, stored.ID, utils.AUDIT_DELETE, userAuditValues(stored), nil)
+	service.auditDeleteRule(ctx, actor, settings.SettingsObj().DBSettingsValues().OnDeleteOwnerProjects(), projects)
+	return nil
 }
 
-func (service *serviceImp) CreateProject(project *model.Project) (*model.Project, error) {
+func (service *serviceImp) SetUserRole(ctx context.Context, actor *model.User, userId model.ID, role utils.UserRoleEnum) (*model.User, error) {
+	user, err := dbmanager.Instance().GetUserByID(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.policy.CanChangeRole(actor, user); err != nil {
+		return nil, err
+	}
+
+	before := userAuditValues(user)
+	user.Role = role
+	result, err := dbmanager.Instance().UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_USER, result.ID, utils.AUDIT_UPDATE, before, userAuditValues(result))
+	return result, nil
+}
+
+func (service *serviceImp) CreateProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error) {
 	if project == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		const msg = "project object cannot be null"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+		return nil, invalidInput(ctx, "project", "cannot be null")
+	}
+
+	if (project.Owner == nil || project.Owner.ID == nil) && actor != nil {
+		// projects belong to the user who creates them, unless another owner is given.
+		project.Owner = &model.User{ID: actor.ID}
+	}
+
+	if err := service.policy.CanCreateProject(actor, project); err != nil {
+		return nil, err
+	}
+
+	if err := validateProjectFields(project.Fields); err != nil {
+		return nil, err
+	}
+
+	result, err := dbmanager.Instance().CreateProject(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_PROJECT, result.ID, utils.AUDIT_CREATE, nil, projectAuditValues(result))
+	service.events.Publish(Event{Type: utils.EVENT_PROJECT_CREATED, Project: result})
+	return result, nil
+}
+
+func (service *serviceImp) AllProjects(
+	ctx context.Context,
+	filter *model.ProjectFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.ProjectList, error) {
+
+	if filter != nil && !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() &&
+		!filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return nil, invalidInput(ctx, "created_at", "the start date must be before the end date")
 	}
 
-	return dbmanager.Instance().CreateProject(project)
+	return dbmanager.Instance().AllProjects(ctx, filter, orderBy, startPosition, offset)
 }
 
-func (service *serviceImp) AllProjects(startPosition, offset int) (model.ProjectList, error) {
-	return dbmanager.Instance().AllProjects(startPosition, offset)
+func (service *serviceImp) ProjectsPage(ctx context.Context, page *model.PageRequest) (model.ProjectList, *model.PageInfo, error) {
+	if err := validatePageRequest(ctx, page); err != nil {
+		return nil, nil, err
+	}
+
+	return dbmanager.Instance().ProjectsPage(ctx, page)
 }
 
-func (service *serviceImp) AllProjectsByUser(user *model.User) (model.ProjectList, error) {
+func (service *serviceImp) CountProjects(ctx context.Context) (int64, error) {
+	return dbmanager.Instance().CountProjects(ctx)
+}
+
+func (service *serviceImp) AllProjectsByUser(ctx context.Context, user *model.User) (model.ProjectList, error) {
 	if user == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		const msg = "user object cannot be null"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+		return nil, invalidInput(ctx, "user", "cannot be null")
 	}
 
-	return dbmanager.Instance().AllProjectFromUser(user)
+	return dbmanager.Instance().AllProjectFromUser(ctx, user)
 }
 
-func (service *serviceImp) AddProject(project *model.Project) (*model.Project, error) {
+func (service *serviceImp) AddProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error) {
+	return service.CreateProject(ctx, actor, project)
+}
+
+func (service *serviceImp) UpdateProject(ctx context.Context, actor *model.User, project *model.Project) (*model.Project, error) {
 	if project == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		const msg = "project object cannot be null"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+		return nil, invalidInput(ctx, "project", "cannot be null")
+	} else if project.ID == nil {
+		return nil, invalidInput(ctx, "id", "cannot be null")
+	} else if project.Name == "" {
+		return nil, invalidInput(ctx, "name", "cannot be empty")
 	}
 
-	return dbmanager.Instance().CreateProject(project)
-}
+	// ownership is checked against the stored project, not against the owner sent by the caller.
+	stored, err := dbmanager.Instance().GetProject(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	} else if err = service.policy.CanModifyProject(actor, stored); err != nil {
+		return nil, err
+	} else if err = service.policy.CanTransferProject(actor, stored, project.OwnerID()); err != nil {
+		return nil, err
+	} else if stored.Version != project.Version {
+		return nil, projectConflict(ctx, project, stored)
+	}
 
-func (service *serviceImp) UpdateProject(project *model.Project) (*model.Project, error) {
-	if project == nil {
-		loggerObj := utils.LoggerObj()
-		defer loggerObj.Close()
-		const msg = "project object cannot be null"
-		loggerObj.Error(msg)
-		return nil, errors.New(msg)
+	if err := validateProjectFields(project.Fields); err != nil {
+		return nil, err
 	}
 
-	return dbmanager.Instance().UpdateProject(project)
+	result, err := dbmanager.Instance().UpdateProject(ctx, project)
+	if err == dbmanager.ErrVersionConflict {
+		return nil, projectConflict(ctx, project, nil)
+	} else if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_PROJECT, result.ID, utils.AUDIT_UPDATE,
+		projectAuditValues(stored), projectAuditValues(result))
+	service.events.Publish(Event{Type: utils.EVENT_PROJECT_UPDATED, Project: result})
+	return result, nil
 }
 
-func (service *serviceImp) DeleteProject(projectId model.ID) error {
-	return dbmanager.Instance().DeleteProject(projectId)
+func (service *serviceImp) DeleteProject(ctx context.Context, actor *model.User, projectId model.ID) error {
+	stored, err := dbmanager.Instance().GetProject(ctx, projectId)
+	if err != nil {
+		return err
+	} else if err = service.policy.CanModifyProject(actor, stored); err != nil {
+		return err
+	} else if err = dbmanager.Instance().DeleteProject(ctx, projectId); err != nil {
+		return err
+	}
+
+	service.audit(ctx, actor, utils.AUDIT_PROJECT, stored.ID, utils.AUDIT_DELETE, projectAuditValues(stored), nil)
+	service.events.Publish(Event{Type: utils.EVENT_PROJECT_DELETED, Project: stored})
+	return nil
 }
 
-func (service *serviceImp) DeleteProjects(ids model.IDList) error {
-	return dbmanager.Instance().DeleteProjects(ids)
+func (service *serviceImp) DeleteProjects(ctx context.Context, actor *model.User, ids model.IDList) error {
+	projects, err := dbmanager.Instance().AllProjectWhereIDIsIn(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := service.policy.CanModifyProject(actor, project); err != nil {
+			return err
+		}
+	}
+
+	if err := dbmanager.Instance().DeleteProjects(ctx, ids); err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		service.audit(ctx, actor, utils.AUDIT_PROJECT, project.ID, utils.AUDIT_DELETE, projectAuditValues(project), nil)
+		service.events.Publish(Event{Type: utils.EVENT_PROJECT_DELETED, Project: project})
+	}
+
+	return nil
 }
 
 func (service *serviceImp) Init() error {
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
 	if err := serviceInstance.dbManager.Open(); err != nil {
 		loggerObj.Error(err.Error())
-		panic(err.Error())
+		return err
+	}
+
+	dbSettings := settings.SettingsObj().DBSettingsValues()
+	service.startPurge(dbSettings.DeletedRetention(), dbSettings.PurgeInterval())
+	return nil
+}
+
+// Close stops the purge and releases the database connection opened by Init.
+func (service *serviceImp) Close() error {
+	loggerObj := utils.LoggerObj()
+	service.stopPurgeLoop()
+	if err := serviceInstance.dbManager.Close(); err != nil {
+		loggerObj.Error(err.Error())
 		return err
 	}
 
 	return nil
 }
 
+// Ping checks that the database answers.
+func (service *serviceImp) Ping(ctx context.Context) error {
+	return serviceInstance.dbManager.Ping(ctx)
+}
+
 func (service *serviceImp) CreateModelIDFromString(strId string) model.ID {
 	return &privateId{id: strId}
 }
 
-func (service *serviceImp) RegisterUser(user *model.User) (*model.User, error) {
-	return dbmanager.Instance().RegisterNewUser(user)
+func (service *serviceImp) RegisterUser(ctx context.Context, user *model.User) (*model.User, error) {
+	user.Role = utils.ROLE_USER
+	for _, email := range settings.SettingsObj().AuthSettings().AdminEmails() {
+		if strings.EqualFold(email, user.Email) {
+			user.Role = utils.ROLE_ADMIN
+		}
+	}
+
+	result, err := dbmanager.Instance().RegisterNewUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// users register themselves, so the actor is the user of the request, if any
+	service.audit(ctx, auth.UserFromContext(ctx), utils.AUDIT_USER, result.ID, utils.AUDIT_CREATE,
+		nil, userAuditValues(result))
+	return result, nil
+}
+
+func (service *serviceImp) AllUsers(
+	ctx context.Context,
+	filter *model.UserFilter,
+	orderBy *model.OrderBy,
+	startPosition, offset int) (model.UserList, error) {
+
+	return dbmanager.Instance().AllUsers(ctx, filter, orderBy, startPosition, offset)
+}
+
+func (service *serviceImp) UsersPage(ctx context.Context, page *model.PageRequest) (model.UserList, *model.PageInfo, error) {
+	if err := validatePageRequest(ctx, page); err != nil {
+		return nil, nil, err
+	}
+
+	return dbmanager.Instance().UsersPage(ctx, page)
+}
+
+func (service *serviceImp) CountUsers(ctx context.Context) (int64, error) {
+	return dbmanager.Instance().CountUsers(ctx)
+}
+
+func validatePageRequest(ctx context.Context, page *model.PageRequest) error {
+	if page == nil {
+		return invalidInput(ctx, "page", "cannot be null")
+	} else if page.First < 0 {
+		return invalidInput(ctx, "first", "cannot be a negative number")
+	} else if page.Last < 0 {
+		return invalidInput(ctx, "last", "cannot be a negative number")
+	} else if page.First > 0 && page.Last > 0 {
+		return invalidInput(ctx, "last", "cannot be used with first")
+	}
+
+	return nil
 }
 
-func (service *serviceImp) AllUsers(startPosition, offset int) (model.UserList, error) {
-	return dbmanager.Instance().AllUsers(startPosition, offset)
+// invalidInput logs and returns the ValidationError of a value sent by the caller, which the API reports as a bad
+// input instead of an internal error.
+func invalidInput(ctx context.Context, field, message string) error {
+	err := &ValidationError{Field: field, Message: message}
+	utils.ContextLogger(ctx).CallerSkip(1).Error(err)
+	return err
 }
 
 var serviceInstance *serviceImp
@@ -234,8 +638,13 @@ func Instance() Service {
 
 	go func() {
 		if serviceInstance == nil {
+			authSettings := settings.SettingsObj().AuthSettings()
 			serviceInstance = &serviceImp{
-				dbManager: dbmanager.Instance(),
+				dbManager:    dbmanager.Instance(),
+				tokenManager: auth.NewTokenManager(authSettings.Secret(), authSettings.TokenTTL()),
+				loginCodes:   auth.NewLoginCodes(authSettings.CodeTTL()),
+				policy:       NewOwnershipPolicy(authSettings.Required()),
+				events:       NewEventBus(EVENT_BUFFER_SIZE),
 			}
 		}
 
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/freddy311082/picnic-server/model"
+)
+
+func TestInvalidInputIsRejectedWithAValidationError(t *testing.T) {
+	ctx := context.Background()
+	service := &serviceImp{}
+	id := &privateId{id: "000000000000000000000001"}
+	now := time.Now()
+
+	calls := map[string]func() error{
+		"create null customer": func() error {
+			_, err := service.CreateCustomer(ctx, nil, nil)
+			return err
+		},
+		"create customer without name": func() error {
+			_, err := service.CreateCustomer(ctx, nil, &model.Customer{})
+			return err
+		},
+		"update customer without id": func() error {
+			_, err := service.UpdateCustomer(ctx, nil, &model.Customer{Name: "ACME"})
+			return err
+		},
+		"update customer without name": func() error {
+			_, err := service.UpdateCustomer(ctx, nil, &model.Customer{ID: id})
+			return err
+		},
+		"get customer without id": func() error {
+			_, err := service.GetCustomerByID(ctx, nil)
+			return err
+		},
+		"create null project": func() error {
+			_, err := service.CreateProject(ctx, nil, nil)
+			return err
+		},
+		"update project without id": func() error {
+			_, err := service.UpdateProject(ctx, nil, &model.Project{Name: "Picnic"})
+			return err
+		},
+		"update project without name": func() error {
+			_, err := service.UpdateProject(ctx, nil, &model.Project{ID: id})
+			return err
+		},
+		"projects with an empty created_at range": func() error {
+			_, err := service.AllProjects(ctx, &model.ProjectFilter{CreatedAfter: now, CreatedBefore: now}, nil, 0, 0)
+			return err
+		},
+		"delete null user": func() error {
+			return service.DeleteUser(ctx, nil, nil)
+		},
+		"page with first and last": func() error {
+			_, _, err := service.UsersPage(ctx, &model.PageRequest{First: 1, Last: 1})
+			return err
+		},
+		"page with a negative first": func() error {
+			_, _, err := service.ProjectsPage(ctx, &model.PageRequest{First: -1})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		if _, ok := call().(*ValidationError); !ok {
+			t.Errorf("%s must be rejected with a ValidationError.", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// Every value of settings.json can be overridden with an environment variable. The overrides are applied to the
+// parsed file before it is loaded, so they go through the same validation as the values of the file.
+
+type envValueKind int
+
+const (
+	envString envValueKind = iota
+	envNumber
+	envBool
+	envList
+)
+
+type envOverride struct {
+	name string
+	path []string
+	kind envValueKind
+}
+
+var envOverrides = []envOverride{
+	{"PICNIC_DB_DRIVER", []string{utils.DB_JSON_KEY, utils.DB_DRIVER_JSON_KEY}, envString},
+	{"PICNIC_DB_OPERATION_TIMEOUT_SECONDS", []string{utils.DB_JSON_KEY, utils.DB_OPERATION_TIMEOUT_JSON_KEY}, envNumber},
+	{"PICNIC_DB_DELETED_RETENTION_DAYS",
+		[]string{utils.DB_JSON_KEY, utils.DB_DELETED_RETENTION_JSON_KEY}, envNumber},
+	{"PICNIC_DB_PURGE_INTERVAL_MINUTES", []string{utils.DB_JSON_KEY, utils.DB_PURGE_INTERVAL_JSON_KEY}, envNumber},
+	{"PICNIC_DB_ON_DELETE_CUSTOMER_PROJECTS",
+		[]string{utils.DB_JSON_KEY, utils.DB_ON_DELETE_JSON_KEY, utils.DB_ON_DELETE_CUSTOMER_PROJECTS_JSON_KEY}, envString},
+	{"PICNIC_DB_ON_DELETE_OWNER_PROJECTS",
+		[]string{utils.DB_JSON_KEY, utils.DB_ON_DELETE_JSON_KEY, utils.DB_ON_DELETE_OWNER_PROJECTS_JSON_KEY}, envString},
+	{"PICNIC_DB_URI", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_URI_JSON_KEY}, envString},
+	{"PICNIC_DB_SCHEME", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_SCHEME_JSON_KEY}, envString},
+	{"PICNIC_DB_HOST", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_HOSTS_JSON_KEY}, envList},
+	{"PICNIC_DB_PORT", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_PORT_JSON_KEY}, envNumber},
+	{"PICNIC_DB_NAME", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_DBNAME_JSON_KEY}, envString},
+	{"PICNIC_DB_USER", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_USER_JSON_KEY}, envString},
+	{"PICNIC_DB_PASSWORD", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_PASSWORD_JSON_KEY}, envString},
+	{"PICNIC_DB_PASSWORD_SECRET",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_PASSWORD_SECRET_JSON_KEY}, envString},
+	{"PICNIC_DB_AUTH_SOURCE",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_AUTH_SOURCE_JSON_KEY}, envString},
+	{"PICNIC_DB_REPLICA_SET",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_REPLICA_SET_JSON_KEY}, envString},
+	{"PICNIC_DB_TLS", []string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_TLS_JSON_KEY}, envBool},
+	{"PICNIC_DB_TLS_CA_FILE",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_TLS_CA_FILE_JSON_KEY}, envString},
+	{"PICNIC_DB_TLS_CERTIFICATE_KEY_FILE",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_TLS_CERTIFICATE_KEY_FILE_JSON_KEY}, envString},
+	{"PICNIC_DB_TLS_INSECURE",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_TLS_INSECURE_JSON_KEY}, envBool},
+	{"PICNIC_DB_READ_PREFERENCE",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_READ_PREFERENCE_JSON_KEY}, envString},
+	{"PICNIC_DB_READ_CONCERN",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_READ_CONCERN_JSON_KEY}, envString},
+	{"PICNIC_DB_WRITE_CONCERN",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_WRITE_CONCERN_JSON_KEY}, envString},
+	{"PICNIC_DB_RETRY_WRITES",
+		[]string{utils.DB_JSON_KEY, utils.MONGODB_JSON_KEY, utils.MONGODB_RETRY_WRITES_JSON_KEY}, envBool},
+
+	{"PICNIC_SECRETS_PROVIDER", []string{utils.SECRETS_JSON_KEY, utils.SECRETS_PROVIDER_JSON_KEY}, envString},
+	{"PICNIC_SECRETS_DIR", []string{utils.SECRETS_JSON_KEY, utils.SECRETS_DIR_JSON_KEY}, envString},
+	{"PICNIC_SECRETS_KEY_FILE", []string{utils.SECRETS_JSON_KEY, utils.SECRETS_KEY_FILE_JSON_KEY}, envString},
+	{"PICNIC_SECRETS_FILE", []string{utils.SECRETS_JSON_KEY, utils.SECRETS_FILE_JSON_KEY}, envString},
+
+	{"PICNIC_GRAPHIQL", []string{utils.WEBSERVER_JSON_KEY, utils.GRAPHIQL_JSON_KEY}, envBool},
+	{"PICNIC_HTTP_PORT", []string{utils.WEBSERVER_JSON_KEY, utils.HTTP_PORT_JSON_KEY}, envNumber},
+	{"PICNIC_ALLOWED_ORIGINS", []string{utils.WEBSERVER_JSON_KEY, utils.ALLOWED_ORIGINS_JSON_KEY}, envList},
+	{"PICNIC_READ_TIMEOUT_SECONDS", []string{utils.WEBSERVER_JSON_KEY, utils.READ_TIMEOUT_JSON_KEY}, envNumber},
+	{"PICNIC_WRITE_TIMEOUT_SECONDS", []string{utils.WEBSERVER_JSON_KEY, utils.WRITE_TIMEOUT_JSON_KEY}, envNumber},
+	{"PICNIC_IDLE_TIMEOUT_SECONDS", []string{utils.WEBSERVER_JSON_KEY, utils.IDLE_TIMEOUT_JSON_KEY}, envNumber},
+	{"PICNIC_SHUTDOWN_TIMEOUT_SECONDS", []string{utils.WEBSERVER_JSON_KEY, utils.SHUTDOWN_TIMEOUT_JSON_KEY}, envNumber},
+	{"PICNIC_MAX_BODY_BYTES", []string{utils.WEBSERVER_JSON_KEY, utils.MAX_BODY_BYTES_JSON_KEY}, envNumber},
+	{"PICNIC_MAX_BATCH_SIZE", []string{utils.WEBSERVER_JSON_KEY, utils.MAX_BATCH_SIZE_JSON_KEY}, envNumber},
+	{"PICNIC_QUERY_CACHE_SIZE", []string{utils.WEBSERVER_JSON_KEY, utils.QUERY_CACHE_SIZE_JSON_KEY}, envNumber},
+	{"PICNIC_MAX_QUERY_DEPTH", []string{utils.WEBSERVER_JSON_KEY, utils.MAX_QUERY_DEPTH_JSON_KEY}, envNumber},
+	{"PICNIC_MAX_QUERY_COMPLEXITY", []string{utils.WEBSERVER_JSON_KEY, utils.MAX_QUERY_COMPLEXITY_JSON_KEY}, envNumber},
+	{"PICNIC_DEFAULT_LIST_SIZE", []string{utils.WEBSERVER_JSON_KEY, utils.DEFAULT_LIST_SIZE_JSON_KEY}, envNumber},
+	{"PICNIC_SUBSCRIPTION_KEEP_ALIVE_SECONDS",
+		[]string{utils.WEBSERVER_JSON_KEY, utils.SUBSCRIPTION_KEEP_ALIVE_JSON_KEY}, envNumber},
+	{"PICNIC_METRICS_TOKEN", []string{utils.WEBSERVER_JSON_KEY, utils.METRICS_TOKEN_JSON_KEY}, envString},
+	{"PICNIC_PERSISTED_QUERIES_STORE", []string{utils.WEBSERVER_JSON_KEY, utils.PERSISTED_QUERIES_JSON_KEY,
+		utils.PERSISTED_QUERIES_STORE_JSON_KEY}, envString},
+	{"PICNIC_PERSISTED_QUERIES_STRICT", []string{utils.WEBSERVER_JSON_KEY, utils.PERSISTED_QUERIES_JSON_KEY,
+		utils.PERSISTED_QUERIES_STRICT_JSON_KEY}, envBool},
+	{"PICNIC_PERSISTED_QUERIES_ALLOWLIST_FILE", []string{utils.WEBSERVER_JSON_KEY, utils.PERSISTED_QUERIES_JSON_KEY,
+		utils.PERSISTED_QUERIES_ALLOWLIST_FILE_JSON_KEY}, envString},
+
+	{"PICNIC_LOG_LEVEL", []string{utils.LOG_JSON_KEY, utils.LOG_LEVEL_JSON_KEY}, envString},
+
+	{"PICNIC_AUTH_REQUIRED", []string{utils.AUTH_JSON_KEY, utils.AUTH_REQUIRED_JSON_KEY}, envBool},
+	{"PICNIC_AUTH_SECRET", []string{utils.AUTH_JSON_KEY, utils.AUTH_SECRET_JSON_KEY}, envString},
+	{"PICNIC_AUTH_TOKEN_TTL_MINUTES", []string{utils.AUTH_JSON_KEY, utils.AUTH_TOKEN_TTL_JSON_KEY}, envNumber},
+	{"PICNIC_AUTH_CODE_TTL_MINUTES", []string{utils.AUTH_JSON_KEY, utils.AUTH_CODE_TTL_JSON_KEY}, envNumber},
+	{"PICNIC_AUTH_ADMIN_EMAILS", []string{utils.AUTH_JSON_KEY, utils.AUTH_ADMIN_EMAILS_JSON_KEY}, envList},
+}
+
+// applyEnvOverrides replaces the values of data with the environment variables that are set. Lists are separated by
+// commas.
+func applyEnvOverrides(data map[string]interface{}) error {
+	for _, override := range envOverrides {
+		raw, ok := os.LookupEnv(override.name)
+		if !ok {
+			continue
+		}
+
+		if value, err := override.parse(raw); err != nil {
+			return err
+		} else {
+			setValue(data, override.path, value)
+		}
+	}
+
+	return nil
+}
+
+func (override *envOverride) parse(raw string) (interface{}, error) {
+	switch override.kind {
+	case envNumber:
+		if value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil {
+			return value, nil
+		}
+		return nil, override.invalidValueError(raw, "a number")
+	case envBool:
+		if value, err := strconv.ParseBool(strings.TrimSpace(raw)); err == nil {
+			return value, nil
+		}
+		return nil, override.invalidValueError(raw, "true or false")
+	case envList:
+		values := []interface{}{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values, nil
+	}
+
+	return raw, nil
+}
+
+func (override *envOverride) invalidValueError(raw, expected string) error {
+	loggerObj := utils.LoggerObj()
+
+	msg := fmt.Sprintf("invalid value %q in environment variable %s. Expected %s", raw, override.name, expected)
+	loggerObj.Error(msg)
+	return errors.New(msg)
+}
+
+// setValue sets the value of a nested key, creating the objects of the path that do not exist.
+func setValue(data map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := data[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			data[key] = child
+		}
+		data = child
+	}
+
+	data[path[len(path)-1]] = value
+}
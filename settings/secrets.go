@@ -0,0 +1,197 @@
+package settings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// SecretsProvider returns the secrets referenced by name in settings.json, so the file does not contain them.
+type SecretsProvider interface {
+	Secret(name string) (string, error)
+}
+
+// ******************************* fileSecretsProvider ***********************************
+
+const defaultSecretsDir = "/run/secrets"
+
+// fileSecretsProvider reads every secret from a file named after it, like the secrets mounted by Docker and
+// Kubernetes.
+type fileSecretsProvider struct {
+	dir string
+}
+
+func (provider *fileSecretsProvider) Secret(name string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(provider.dir, name))
+	if err != nil {
+		return "", secretError(name, err.Error())
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// ******************************* envSecretsProvider ***********************************
+
+const secretsEnvPrefix = "PICNIC_SECRET_"
+
+// envSecretsProvider reads every secret from an environment variable. The secret db-password is read from
+// PICNIC_SECRET_DB_PASSWORD.
+type envSecretsProvider struct{}
+
+func (provider *envSecretsProvider) Secret(name string) (string, error) {
+	envName := secretsEnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if value, ok := os.LookupEnv(envName); ok {
+		return value, nil
+	}
+
+	return "", secretError(name, "environment variable "+envName+" is not set")
+}
+
+// ******************************* keyfileSecretsProvider ***********************************
+
+// keyfileSecretsProvider reads the secrets from a JSON file that maps every name to its value encrypted with
+// AES-256-GCM. The key file contains the 32 bytes of the key in base64, like the output of openssl rand -base64 32,
+// and must be kept out of the repository. EncryptSecret encrypts the values of the file.
+type keyfileSecretsProvider struct {
+	keyFile     string
+	secretsFile string
+}
+
+func (provider *keyfileSecretsProvider) Secret(name string) (string, error) {
+	var secrets map[string]string
+
+	if aead, err := newSecretsCipher(provider.keyFile); err != nil {
+		return "", secretError(name, err.Error())
+	} else if content, err := ioutil.ReadFile(provider.secretsFile); err != nil {
+		return "", secretError(name, err.Error())
+	} else if err = json.Unmarshal(content, &secrets); err != nil {
+		return "", secretError(name, "invalid secrets file "+provider.secretsFile)
+	} else if encrypted, ok := secrets[name]; !ok {
+		return "", secretError(name, "it is not in "+provider.secretsFile)
+	} else if data, err := base64.StdEncoding.DecodeString(encrypted); err != nil || len(data) < aead.NonceSize() {
+		return "", secretError(name, "invalid encrypted value")
+	} else if value, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil); err != nil {
+		return "", secretError(name, "it cannot be decrypted with "+provider.keyFile)
+	} else {
+		return string(value), nil
+	}
+}
+
+func newSecretsCipher(keyFile string) (cipher.AEAD, error) {
+	content, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("key file %s must contain 32 bytes encoded in base64", keyFile)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret encrypts a value with the key of keyFile, and returns it in the format of the secrets file.
+func EncryptSecret(keyFile, value string) (string, error) {
+	aead, err := newSecretsCipher(keyFile)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// ******************************* Helpers ***********************************
+
+func secretError(name, problem string) error {
+	loggerObj := utils.LoggerObj()
+
+	msg := fmt.Sprintf("cannot read secret %s: %s", name, problem)
+	loggerObj.Error(msg)
+	return errors.New(msg)
+}
+
+// loadSecretsProvider creates the provider configured in the secrets section. The environment provider is used when
+// the section is missing.
+func loadSecretsProvider(data map[string]interface{}) (SecretsProvider, error) {
+	providerName := utils.SECRETS_PROVIDER_ENV
+	dir := defaultSecretsDir
+	var keyFile, secretsFile string
+
+	if secretsSection, err := newSettingsSection(data, utils.SECRETS_JSON_KEY, utils.SECRETS_JSON_KEY, false); err != nil {
+		return nil, err
+	} else if err = secretsSection.stringValue(utils.SECRETS_PROVIDER_JSON_KEY, false, &providerName); err != nil {
+		return nil, err
+	} else if err = secretsSection.stringValue(utils.SECRETS_DIR_JSON_KEY, false, &dir); err != nil {
+		return nil, err
+	} else if err = secretsSection.stringValue(utils.SECRETS_KEY_FILE_JSON_KEY, false, &keyFile); err != nil {
+		return nil, err
+	} else if err = secretsSection.stringValue(utils.SECRETS_FILE_JSON_KEY, false, &secretsFile); err != nil {
+		return nil, err
+	} else {
+		switch providerName {
+		case utils.SECRETS_PROVIDER_ENV:
+			return &envSecretsProvider{}, nil
+		case utils.SECRETS_PROVIDER_FILE:
+			return &fileSecretsProvider{dir: dir}, nil
+		case utils.SECRETS_PROVIDER_KEYFILE:
+			if keyFile == "" {
+				return nil, secretsSection.error(utils.SECRETS_KEY_FILE_JSON_KEY, "is missing")
+			} else if secretsFile == "" {
+				return nil, secretsSection.error(utils.SECRETS_FILE_JSON_KEY, "is missing")
+			}
+			return &keyfileSecretsProvider{keyFile: keyFile, secretsFile: secretsFile}, nil
+		default:
+			return nil, secretsSection.error(utils.SECRETS_PROVIDER_JSON_KEY, fmt.Sprintf(
+				"must be \"%s\", \"%s\" or \"%s\"",
+				utils.SECRETS_PROVIDER_ENV, utils.SECRETS_PROVIDER_FILE, utils.SECRETS_PROVIDER_KEYFILE))
+		}
+	}
+}
+
+const redactedValue = "*****"
+
+// redactURI hides the password of a connection string.
+func redactURI(uri string) string {
+	schemeEnd := strings.Index(uri, "://")
+	if schemeEnd < 0 {
+		return uri
+	}
+
+	authority := uri[schemeEnd+3:]
+	if slash := strings.Index(authority, "/"); slash >= 0 {
+		authority = authority[:slash]
+	}
+
+	userInfoEnd := strings.LastIndex(authority, "@")
+	if userInfoEnd < 0 {
+		return uri
+	}
+
+	userInfo := authority[:userInfoEnd]
+	if colon := strings.Index(userInfo, ":"); colon >= 0 {
+		userInfo = userInfo[:colon+1] + redactedValue
+	}
+
+	return uri[:schemeEnd+3] + userInfo + uri[schemeEnd+3+userInfoEnd:]
+}
@@ -1,16 +1,21 @@
 package settings
 
 import (
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/freddy311082/picnic-server/utils"
 	"io/ioutil"
+	"math"
+	"net/url"
 	"os"
 	"path"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const CONFIG_FILE_PATH = "./config/settings.json"
@@ -18,14 +23,21 @@ const CONFIG_FILE_PATH = "./config/settings.json"
 // ******************************* Interfaces ***********************************
 
 type DBSettings interface {
-	Host() string
+	Hosts() []string
 	Port() int
 	DbName() string
 	User() string
 	Password() string
+	ReplicaSet() string
 	DriverType() utils.DBTypeEnum
+	OperationTimeout() time.Duration
+	DeletedRetention() time.Duration
+	PurgeInterval() time.Duration
+	OnDeleteCustomerProjects() utils.OnDeleteEnum
+	OnDeleteOwnerProjects() utils.OnDeleteEnum
 
 	ChangeDatabase(dbName string)
+	ChangeDriverType(driverType utils.DBTypeEnum)
 	ConnectionString() string
 	ToString() string
 }
@@ -33,12 +45,47 @@ type DBSettings interface {
 type APISettings interface {
 	GraphiQL() bool
 	HttpPort() int
+	AllowedOrigins() []string
+	ReadTimeout() time.Duration
+	WriteTimeout() time.Duration
+	IdleTimeout() time.Duration
+	ShutdownTimeout() time.Duration
+	MaxBodyBytes() int
+	MaxBatchSize() int
+	QueryCacheSize() int
+	MaxQueryDepth() int
+	MaxQueryComplexity() int
+	DefaultListSize() int
+	FieldCosts() map[string]int
+	SubscriptionKeepAlive() time.Duration
+	PersistedQueries() PersistedQueriesSettings
+	MetricsToken() string
+	ToString() string
+}
+
+// PersistedQueriesSettings configures the automatic persisted queries, which clients send as the sha256 hash of the
+// query text. In strict mode only the queries of the allowlist file are executed.
+type PersistedQueriesSettings interface {
+	Store() string
+	CacheSize() int
+	Strict() bool
+	AllowlistFile() string
+}
+
+type AuthSettings interface {
+	Required() bool
+	Secret() string
+	TokenTTL() time.Duration
+	CodeTTL() time.Duration
+	AdminEmails() []string
 	ToString() string
 }
 
 type Settings interface {
 	DBSettingsValues() DBSettings
 	APISettings() APISettings
+	AuthSettings() AuthSettings
+	LogLevel() utils.LogLevelEnum
 	ToString() string
 	filename() string
 }
@@ -47,9 +94,38 @@ type Settings interface {
 
 // ******************************* apiSettingsImp ***********************************
 
+const defaultReadTimeout = 15 * time.Second
+const defaultWriteTimeout = 30 * time.Second
+const defaultIdleTimeout = 60 * time.Second
+const defaultShutdownTimeout = 30 * time.Second
+const defaultMaxBodyBytes = 1 << 20
+const defaultMaxBatchSize = 10
+const defaultQueryCacheSize = 1000
+const defaultMaxQueryDepth = 15 // the introspection query of GraphiQL has depth 13
+const defaultMaxQueryComplexity = 1000
+const defaultListSize = 10
+const defaultSubscriptionKeepAlive = 15 * time.Second
+
 type apiSettingsImp struct {
-	allowGraphiQL bool
-	httpPort      int
+	allowGraphiQL   bool
+	httpPort        int
+	allowedOrigins  []string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownTimeout time.Duration
+	maxBodyBytes    int
+	maxBatchSize    int
+	queryCacheSize  int
+
+	maxQueryDepth      int
+	maxQueryComplexity int
+	defaultListSize    int
+	fieldCosts         map[string]int
+	persistedQueries   *persistedQueriesSettingsImp
+
+	subscriptionKeepAlive time.Duration
+	metricsToken          string
 }
 
 func (apiSettings *apiSettingsImp) ToString() string {
@@ -57,9 +133,98 @@ func (apiSettings *apiSettingsImp) ToString() string {
 ========== API Settings =========
 Allowed GraphiQL: %s
 HTTP Port: %d
+Allowed Origins: %s
+Read Timeout: %s
+Write Timeout: %s
+Idle Timeout: %s
+Shutdown Timeout: %s
+Max Body Bytes: %d
+Max Batch Size: %d
+Query Cache Size: %d
+Max Query Depth: %d
+Max Query Complexity: %d
+Subscription Keep Alive: %s
+Persisted Queries Store: %s
+Persisted Queries Strict: %s
+Metrics Enabled: %s
 =================================
 
-`, fmt.Sprint(apiSettings.allowGraphiQL), apiSettings.httpPort)
+`, fmt.Sprint(apiSettings.allowGraphiQL), apiSettings.httpPort, strings.Join(apiSettings.allowedOrigins, ", "),
+		apiSettings.readTimeout, apiSettings.writeTimeout, apiSettings.idleTimeout, apiSettings.shutdownTimeout,
+		apiSettings.maxBodyBytes, apiSettings.maxBatchSize, apiSettings.queryCacheSize,
+		apiSettings.maxQueryDepth, apiSettings.maxQueryComplexity, apiSettings.subscriptionKeepAlive,
+		apiSettings.persistedQueries.store, fmt.Sprint(apiSettings.persistedQueries.strict),
+		fmt.Sprint(apiSettings.metricsToken != ""))
+}
+
+func (apiSettings *apiSettingsImp) ReadTimeout() time.Duration {
+	return apiSettings.readTimeout
+}
+
+func (apiSettings *apiSettingsImp) WriteTimeout() time.Duration {
+	return apiSettings.writeTimeout
+}
+
+func (apiSettings *apiSettingsImp) IdleTimeout() time.Duration {
+	return apiSettings.idleTimeout
+}
+
+// ShutdownTimeout returns how long the server waits for the in-flight requests when it is stopped.
+func (apiSettings *apiSettingsImp) ShutdownTimeout() time.Duration {
+	return apiSettings.shutdownTimeout
+}
+
+// MaxBodyBytes returns the size limit of the body of the GraphQL requests.
+func (apiSettings *apiSettingsImp) MaxBodyBytes() int {
+	return apiSettings.maxBodyBytes
+}
+
+// MaxBatchSize returns how many operations a batched GraphQL request can have.
+func (apiSettings *apiSettingsImp) MaxBatchSize() int {
+	return apiSettings.maxBatchSize
+}
+
+// QueryCacheSize returns how many parsed GraphQL queries are kept in memory.
+func (apiSettings *apiSettingsImp) QueryCacheSize() int {
+	return apiSettings.queryCacheSize
+}
+
+// MaxQueryDepth returns how many levels of fields a GraphQL query can have. Zero disables the limit.
+func (apiSettings *apiSettingsImp) MaxQueryDepth() int {
+	return apiSettings.maxQueryDepth
+}
+
+// MaxQueryComplexity returns the highest cost of a GraphQL query. Zero disables the limit.
+func (apiSettings *apiSettingsImp) MaxQueryComplexity() int {
+	return apiSettings.maxQueryComplexity
+}
+
+// DefaultListSize returns the number of items expected from the lists of a query that do not say how many they want.
+func (apiSettings *apiSettingsImp) DefaultListSize() int {
+	return apiSettings.defaultListSize
+}
+
+// FieldCosts returns the cost of the fields that are more expensive than a single lookup, by "Type.field".
+func (apiSettings *apiSettingsImp) FieldCosts() map[string]int {
+	return apiSettings.fieldCosts
+}
+
+// SubscriptionKeepAlive returns how often the WebSocket connections of the subscriptions are sent a keep-alive message.
+func (apiSettings *apiSettingsImp) SubscriptionKeepAlive() time.Duration {
+	return apiSettings.subscriptionKeepAlive
+}
+
+// MetricsToken is the bearer token that the requests to /metrics must send. The endpoint is disabled when it is empty.
+func (apiSettings *apiSettingsImp) MetricsToken() string {
+	return apiSettings.metricsToken
+}
+
+func (apiSettings *apiSettingsImp) PersistedQueries() PersistedQueriesSettings {
+	return apiSettings.persistedQueries
+}
+
+func (apiSettings *apiSettingsImp) AllowedOrigins() []string {
+	return apiSettings.allowedOrigins
 }
 
 func (apiSettings *apiSettingsImp) HttpPort() int {
@@ -71,13 +236,205 @@ func (apiSettings *apiSettingsImp) GraphiQL() bool {
 }
 
 func (apiSettings *apiSettingsImp) loadData(data map[string]interface{}) error {
-	if apiMap, ok := data[utils.WEBSERVER_JSON_KEY].(map[string]interface{}); !ok {
-		const msg = "invalid settings.json. Error or missing API config"
-		utils.LoggerObj().Error(msg)
-		return errors.New(msg)
-	} else {
-		apiSettings.allowGraphiQL = apiMap[utils.GRAPHIQL_JSON_KEY].(bool)
-		apiSettings.httpPort = int(apiMap[utils.HTTP_PORT_JSON_KEY].(float64))
+	apiSettings.allowedOrigins = []string{}
+	apiSettings.readTimeout = defaultReadTimeout
+	apiSettings.writeTimeout = defaultWriteTimeout
+	apiSettings.idleTimeout = defaultIdleTimeout
+	apiSettings.shutdownTimeout = defaultShutdownTimeout
+	apiSettings.maxBodyBytes = defaultMaxBodyBytes
+	apiSettings.maxBatchSize = defaultMaxBatchSize
+	apiSettings.queryCacheSize = defaultQueryCacheSize
+	apiSettings.maxQueryDepth = defaultMaxQueryDepth
+	apiSettings.maxQueryComplexity = defaultMaxQueryComplexity
+	apiSettings.defaultListSize = defaultListSize
+	apiSettings.fieldCosts = map[string]int{}
+	apiSettings.subscriptionKeepAlive = defaultSubscriptionKeepAlive
+
+	if apiSection, err := newSettingsSection(data, utils.WEBSERVER_JSON_KEY, utils.WEBSERVER_JSON_KEY, true); err != nil {
+		return err
+	} else if err = apiSection.boolValue(utils.GRAPHIQL_JSON_KEY, false, &apiSettings.allowGraphiQL); err != nil {
+		return err
+	} else if err = apiSection.intValue(utils.HTTP_PORT_JSON_KEY, true, 1, 65535, &apiSettings.httpPort); err != nil {
+		return err
+	} else if err = apiSection.stringListValue(utils.ALLOWED_ORIGINS_JSON_KEY, &apiSettings.allowedOrigins); err != nil {
+		return err
+	} else if err = apiSection.durationValue(utils.READ_TIMEOUT_JSON_KEY, time.Second, &apiSettings.readTimeout); err != nil {
+		return err
+	} else if err = apiSection.durationValue(utils.WRITE_TIMEOUT_JSON_KEY, time.Second, &apiSettings.writeTimeout); err != nil {
+		return err
+	} else if err = apiSection.durationValue(utils.IDLE_TIMEOUT_JSON_KEY, time.Second, &apiSettings.idleTimeout); err != nil {
+		return err
+	} else if err = apiSection.durationValue(
+		utils.SHUTDOWN_TIMEOUT_JSON_KEY, time.Second, &apiSettings.shutdownTimeout); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.MAX_BODY_BYTES_JSON_KEY, false, 1, math.MaxInt32, &apiSettings.maxBodyBytes); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.MAX_BATCH_SIZE_JSON_KEY, false, 1, 1000, &apiSettings.maxBatchSize); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.QUERY_CACHE_SIZE_JSON_KEY, false, 1, 1000000, &apiSettings.queryCacheSize); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.MAX_QUERY_DEPTH_JSON_KEY, false, 0, 1000, &apiSettings.maxQueryDepth); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.MAX_QUERY_COMPLEXITY_JSON_KEY, false, 0, math.MaxInt32, &apiSettings.maxQueryComplexity); err != nil {
+		return err
+	} else if err = apiSection.intValue(
+		utils.DEFAULT_LIST_SIZE_JSON_KEY, false, 1, 10000, &apiSettings.defaultListSize); err != nil {
+		return err
+	} else if err = apiSection.intMapValue(
+		utils.FIELD_COSTS_JSON_KEY, 0, 1000000, &apiSettings.fieldCosts); err != nil {
+		return err
+	} else if err = apiSection.durationValue(
+		utils.SUBSCRIPTION_KEEP_ALIVE_JSON_KEY, time.Second, &apiSettings.subscriptionKeepAlive); err != nil {
+		return err
+	} else if err = apiSection.stringValue(utils.METRICS_TOKEN_JSON_KEY, false, &apiSettings.metricsToken); err != nil {
+		return err
+	} else if apiSettings.persistedQueries, err = loadPersistedQueriesSettings(apiSection); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ******************************* persistedQueriesSettingsImp ***********************************
+
+const defaultPersistedQueriesCacheSize = 1000
+
+type persistedQueriesSettingsImp struct {
+	store         string
+	cacheSize     int
+	strict        bool
+	allowlistFile string
+}
+
+// Store returns where the registered queries are kept: memory, or the MongoDB database with a memory cache in front.
+func (persistedQueries *persistedQueriesSettingsImp) Store() string {
+	return persistedQueries.store
+}
+
+func (persistedQueries *persistedQueriesSettingsImp) CacheSize() int {
+	return persistedQueries.cacheSize
+}
+
+func (persistedQueries *persistedQueriesSettingsImp) Strict() bool {
+	return persistedQueries.strict
+}
+
+func (persistedQueries *persistedQueriesSettingsImp) AllowlistFile() string {
+	return persistedQueries.allowlistFile
+}
+
+func loadPersistedQueriesSettings(apiSection *settingsSection) (*persistedQueriesSettingsImp, error) {
+	persistedQueries := &persistedQueriesSettingsImp{
+		store:     utils.PERSISTED_QUERIES_STORE_MEMORY,
+		cacheSize: defaultPersistedQueriesCacheSize,
+	}
+
+	if section, err := apiSection.subsection(utils.PERSISTED_QUERIES_JSON_KEY, false); err != nil {
+		return nil, err
+	} else if err = section.stringValue(
+		utils.PERSISTED_QUERIES_STORE_JSON_KEY, false, &persistedQueries.store); err != nil {
+		return nil, err
+	} else if err = section.intValue(
+		utils.PERSISTED_QUERIES_CACHE_SIZE_JSON_KEY, false, 1, 1000000, &persistedQueries.cacheSize); err != nil {
+		return nil, err
+	} else if err = section.boolValue(utils.PERSISTED_QUERIES_STRICT_JSON_KEY, false, &persistedQueries.strict); err != nil {
+		return nil, err
+	} else if err = section.stringValue(
+		utils.PERSISTED_QUERIES_ALLOWLIST_FILE_JSON_KEY, false, &persistedQueries.allowlistFile); err != nil {
+		return nil, err
+	} else if persistedQueries.store != utils.PERSISTED_QUERIES_STORE_MEMORY &&
+		persistedQueries.store != utils.PERSISTED_QUERIES_STORE_MONGODB {
+		return nil, section.error(utils.PERSISTED_QUERIES_STORE_JSON_KEY, fmt.Sprintf("must be \"%s\" or \"%s\"",
+			utils.PERSISTED_QUERIES_STORE_MEMORY, utils.PERSISTED_QUERIES_STORE_MONGODB))
+	} else if persistedQueries.strict && persistedQueries.allowlistFile == "" {
+		return nil, section.error(utils.PERSISTED_QUERIES_ALLOWLIST_FILE_JSON_KEY, "is required in strict mode")
+	}
+
+	return persistedQueries, nil
+}
+
+// ******************************* authSettingsImp ***********************************
+
+const defaultTokenTTL = 24 * time.Hour
+const defaultCodeTTL = 10 * time.Minute
+
+type authSettingsImp struct {
+	required    bool
+	secret      string
+	tokenTTL    time.Duration
+	codeTTL     time.Duration
+	adminEmails []string
+}
+
+func (authSettings *authSettingsImp) ToString() string {
+	return fmt.Sprintf(`
+========== Auth Settings =========
+Authentication Required: %s
+Token TTL: %s
+Login Code TTL: %s
+Admin Emails: %s
+=================================
+
+`, fmt.Sprint(authSettings.required), authSettings.tokenTTL, authSettings.codeTTL,
+		strings.Join(authSettings.adminEmails, ", "))
+}
+
+// AdminEmails returns the emails of the users that get the admin role when they register.
+func (authSettings *authSettingsImp) AdminEmails() []string {
+	return authSettings.adminEmails
+}
+
+func (authSettings *authSettingsImp) Required() bool {
+	return authSettings.required
+}
+
+// Secret returns the key used to sign the access tokens. When it is not configured a random key is generated, so
+// the tokens issued are only valid until the process is restarted.
+func (authSettings *authSettingsImp) Secret() string {
+	return authSettings.secret
+}
+
+func (authSettings *authSettingsImp) TokenTTL() time.Duration {
+	return authSettings.tokenTTL
+}
+
+func (authSettings *authSettingsImp) CodeTTL() time.Duration {
+	return authSettings.codeTTL
+}
+
+func (authSettings *authSettingsImp) loadData(data map[string]interface{}) error {
+	authSettings.required = true
+	authSettings.tokenTTL = defaultTokenTTL
+	authSettings.codeTTL = defaultCodeTTL
+
+	if authSection, err := newSettingsSection(data, utils.AUTH_JSON_KEY, utils.AUTH_JSON_KEY, false); err != nil {
+		return err
+	} else if err = authSection.boolValue(utils.AUTH_REQUIRED_JSON_KEY, false, &authSettings.required); err != nil {
+		return err
+	} else if err = authSection.stringValue(utils.AUTH_SECRET_JSON_KEY, false, &authSettings.secret); err != nil {
+		return err
+	} else if err = authSection.durationValue(utils.AUTH_TOKEN_TTL_JSON_KEY, time.Minute, &authSettings.tokenTTL); err != nil {
+		return err
+	} else if err = authSection.durationValue(utils.AUTH_CODE_TTL_JSON_KEY, time.Minute, &authSettings.codeTTL); err != nil {
+		return err
+	} else if err = authSection.stringListValue(utils.AUTH_ADMIN_EMAILS_JSON_KEY, &authSettings.adminEmails); err != nil {
+		return err
+	}
+
+	if authSettings.secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+
+		authSettings.secret = base64.StdEncoding.EncodeToString(key)
+		loggerObj := utils.LoggerObj()
+		loggerObj.Warning("no auth secret configured. Access tokens will be invalidated when the server restarts")
 	}
 
 	return nil
@@ -85,32 +442,107 @@ func (apiSettings *apiSettingsImp) loadData(data map[string]interface{}) error {
 
 // ******************************* dbSettingsImp ***********************************
 
+const mongodbScheme = "mongodb"
+const mongodbSrvScheme = "mongodb+srv"
+const defaultMongodbPort = 27017
+const defaultOperationTimeout = 10 * time.Second
+const defaultDeletedRetention = 30 * 24 * time.Hour
+const defaultPurgeInterval = time.Hour
+
+var mongodbReadPreferences = []string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"}
+var mongodbReadConcerns = []string{"local", "available", "majority", "linearizable", "snapshot"}
+
+// dbSettingsImp holds the connection values of MongoDB. The connection string is built from them unless a raw URI is
+// configured, in which case the URI is used as it is.
 type dbSettingsImp struct {
-	_host     string
-	_port     int
-	_dbName   string
-	_user     string
-	_password string
+	_driverType            utils.DBTypeEnum
+	_operationTimeout      time.Duration
+	_deletedRetention      time.Duration
+	_purgeInterval         time.Duration
+	_onDeleteCustomer      utils.OnDeleteEnum
+	_onDeleteOwner         utils.OnDeleteEnum
+	_uri                   string
+	_scheme                string
+	_hosts                 []string
+	_port                  int
+	_dbName                string
+	_user                  string
+	_password              string
+	_authSource            string
+	_replicaSet            string
+	_tls                   bool
+	_tlsCAFile             string
+	_tlsCertificateKeyFile string
+	_tlsInsecure           bool
+	_readPreference        string
+	_readConcern           string
+	_writeConcern          string
+	_retryWrites           bool
 }
 
 func (dbSettings *dbSettingsImp) ToString() string {
 	return fmt.Sprintf(`
 ========== Database Settings =========
-Host: %s
+Hosts: %s
 DB Port: %d
 DB Name: %s
 DB User: %s
 DB Password: %s
+Replica Set: %s
+TLS: %s
+Operation Timeout: %s
+Deleted Retention: %s
+Purge Interval: %s
+On Delete Customer Projects: %s
+On Delete Owner Projects: %s
 Connection String: %s
 =================================
-`, dbSettings._host, dbSettings._port, dbSettings._dbName, dbSettings._user, dbSettings._password,
-		dbSettings.ConnectionString())
+`, strings.Join(dbSettings._hosts, ", "), dbSettings._port, dbSettings._dbName, dbSettings._user,
+		dbSettings.redactedPassword(), dbSettings._replicaSet, fmt.Sprint(dbSettings._tls),
+		dbSettings._operationTimeout, dbSettings._deletedRetention, dbSettings._purgeInterval,
+		onDeleteName(dbSettings._onDeleteCustomer), onDeleteName(dbSettings._onDeleteOwner),
+		redactURI(dbSettings.ConnectionString()))
+}
+
+// OperationTimeout returns how long a database operation can take before it is cancelled.
+func (dbSettings *dbSettingsImp) OperationTimeout() time.Duration {
+	return dbSettings._operationTimeout
+}
+
+// DeletedRetention returns how long the deleted users, projects and customers are kept before they are purged.
+func (dbSettings *dbSettingsImp) DeletedRetention() time.Duration {
+	return dbSettings._deletedRetention
+}
+
+// PurgeInterval returns how often the records deleted for longer than the retention period are purged.
+func (dbSettings *dbSettingsImp) PurgeInterval() time.Duration {
+	return dbSettings._purgeInterval
 }
 
-func (dbSettings *dbSettingsImp) Host() string {
-	return dbSettings._host
+// OnDeleteCustomerProjects returns what happens to the projects of a customer when the customer is deleted.
+func (dbSettings *dbSettingsImp) OnDeleteCustomerProjects() utils.OnDeleteEnum {
+	return dbSettings._onDeleteCustomer
 }
 
+// OnDeleteOwnerProjects returns what happens to the projects of a user when the user is deleted.
+func (dbSettings *dbSettingsImp) OnDeleteOwnerProjects() utils.OnDeleteEnum {
+	return dbSettings._onDeleteOwner
+}
+
+func (dbSettings *dbSettingsImp) redactedPassword() string {
+	if dbSettings._password == "" {
+		return ""
+	}
+
+	return redactedValue
+}
+
+// Hosts returns the hosts of the cluster as host:port. A mongodb+srv connection has a single host without port.
+func (dbSettings *dbSettingsImp) Hosts() []string {
+	return dbSettings._hosts
+}
+
+// Port returns the port used by the hosts that do not set one.
 func (dbSettings *dbSettingsImp) Port() int {
 	return dbSettings._port
 }
@@ -127,100 +559,357 @@ func (dbSettings *dbSettingsImp) Password() string {
 	return dbSettings._password
 }
 
+func (dbSettings *dbSettingsImp) ReplicaSet() string {
+	return dbSettings._replicaSet
+}
+
 func (dbSettings *dbSettingsImp) DriverType() utils.DBTypeEnum {
-	return utils.DBType_MONGODB
+	return dbSettings._driverType
 }
 
 func (dbSettings *dbSettingsImp) ChangeDatabase(dbName string) {
 	dbSettings._dbName = dbName
 }
 
+func (dbSettings *dbSettingsImp) ChangeDriverType(driverType utils.DBTypeEnum) {
+	dbSettings._driverType = driverType
+}
+
 func (dbSettings *dbSettingsImp) ConnectionString() string {
-	hostWithDb := fmt.Sprintf(dbSettings._host, dbSettings._dbName)
-	connectionString := fmt.Sprintf("mongodb+srv://%s:%s@%s", dbSettings._user, dbSettings._password, hostWithDb)
-	return connectionString
+	if dbSettings._uri != "" {
+		return dbSettings._uri
+	}
+
+	options := url.Values{}
+	if dbSettings._authSource != "" {
+		options.Set("authSource", dbSettings._authSource)
+	}
+	if dbSettings._replicaSet != "" {
+		options.Set("replicaSet", dbSettings._replicaSet)
+	}
+	if dbSettings._tls {
+		options.Set("tls", "true")
+	}
+	if dbSettings._tlsCAFile != "" {
+		options.Set("tlsCAFile", dbSettings._tlsCAFile)
+	}
+	if dbSettings._tlsCertificateKeyFile != "" {
+		options.Set("tlsCertificateKeyFile", dbSettings._tlsCertificateKeyFile)
+	}
+	if dbSettings._tlsInsecure {
+		options.Set("tlsInsecure", "true")
+	}
+	if dbSettings._readPreference != "" {
+		options.Set("readPreference", dbSettings._readPreference)
+	}
+	if dbSettings._readConcern != "" {
+		options.Set("readConcernLevel", dbSettings._readConcern)
+	}
+	if dbSettings._writeConcern != "" {
+		options.Set("w", dbSettings._writeConcern)
+	}
+	options.Set("retryWrites", fmt.Sprint(dbSettings._retryWrites))
+
+	connectionString := url.URL{
+		Scheme:   dbSettings._scheme,
+		Host:     strings.Join(dbSettings._hosts, ","),
+		Path:     "/" + dbSettings._dbName,
+		RawQuery: options.Encode(),
+	}
+	if dbSettings._user != "" {
+		connectionString.User = url.UserPassword(dbSettings._user, dbSettings._password)
+	}
+
+	return connectionString.String()
 }
 
 func (dbSettings *dbSettingsImp) loadData(data map[string]interface{}) error {
-	if dbMap, okDb := data["db"].(map[string]interface{}); !okDb {
-		return errors.New("missing \"db\" key in settings.json")
-	} else if mongodbMap, okMongodb := dbMap["mongodb"].(map[string]interface{}); !okMongodb {
-		return errors.New("missing \"mongodb\" key in settings.json")
-	} else {
-		dbSettings._host = mongodbMap["host"].(string)
-		dbSettings._port = int(mongodbMap["port"].(float64))
-		dbSettings._dbName = mongodbMap["dbname"].(string)
-		dbSettings._user = mongodbMap["user"].(string)
-		dbSettings._password = mongodbMap["password"].(string)
+	dbSection, err := newSettingsSection(data, utils.DB_JSON_KEY, utils.DB_JSON_KEY, true)
+	if err != nil {
+		return err
+	}
+
+	dbSettings._operationTimeout = defaultOperationTimeout
+	dbSettings._deletedRetention = defaultDeletedRetention
+	dbSettings._purgeInterval = defaultPurgeInterval
+
+	if err := dbSettings.loadDriverType(dbSection); err != nil {
+		return err
+	} else if err = dbSection.durationValue(
+		utils.DB_OPERATION_TIMEOUT_JSON_KEY, time.Second, &dbSettings._operationTimeout); err != nil {
+		return err
+	} else if err = dbSection.durationValue(
+		utils.DB_DELETED_RETENTION_JSON_KEY, 24*time.Hour, &dbSettings._deletedRetention); err != nil {
+		return err
+	} else if err = dbSection.durationValue(
+		utils.DB_PURGE_INTERVAL_JSON_KEY, time.Minute, &dbSettings._purgeInterval); err != nil {
+		return err
+	} else if err = dbSettings.loadOnDelete(dbSection); err != nil {
+		return err
+	} else if dbSettings._driverType == utils.DBType_MEMORY {
+		// the in-memory database does not need any connection values
+		return nil
+	}
+
+	mongodbSection, err := dbSection.subsection(utils.MONGODB_JSON_KEY, true)
+	if err != nil {
+		return err
+	}
+
+	dbSettings._scheme = mongodbScheme
+	dbSettings._port = defaultMongodbPort
+	dbSettings._retryWrites = true
+
+	if err = mongodbSection.stringValue(utils.MONGODB_URI_JSON_KEY, false, &dbSettings._uri); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(utils.MONGODB_DBNAME_JSON_KEY, true, &dbSettings._dbName); err != nil {
+		return err
+	} else if dbSettings._uri != "" {
+		// the URI already has every connection value
+		return nil
+	}
+
+	if err = mongodbSection.stringValue(utils.MONGODB_SCHEME_JSON_KEY, false, &dbSettings._scheme); err != nil {
+		return err
+	} else if err = mongodbSection.intValue(utils.MONGODB_PORT_JSON_KEY, false, 1, 65535, &dbSettings._port); err != nil {
+		return err
+	} else if err = dbSettings.loadHosts(mongodbSection); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(utils.MONGODB_USER_JSON_KEY, false, &dbSettings._user); err != nil {
+		return err
+	} else if err = dbSettings.loadPassword(data, mongodbSection); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(
+		utils.MONGODB_AUTH_SOURCE_JSON_KEY, false, &dbSettings._authSource); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(
+		utils.MONGODB_REPLICA_SET_JSON_KEY, false, &dbSettings._replicaSet); err != nil {
+		return err
+	} else if err = dbSettings.loadTLS(mongodbSection); err != nil {
+		return err
+	} else if err = dbSettings.loadConcerns(mongodbSection); err != nil {
+		return err
 	}
 
-	var err error
+	return nil
+}
+
+// loadPassword reads the password, or the secret named by password-secret when the password is not set. The password
+// is given to the driver as it is.
+func (dbSettings *dbSettingsImp) loadPassword(data map[string]interface{}, mongodbSection *settingsSection) error {
+	var secretName string
 
-	if err = dbSettings.validate(); err == nil {
-		dbSettings.encryptPassword()
+	if err := mongodbSection.stringValue(utils.MONGODB_PASSWORD_JSON_KEY, false, &dbSettings._password); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(
+		utils.MONGODB_PASSWORD_SECRET_JSON_KEY, false, &secretName); err != nil {
+		return err
+	} else if dbSettings._password != "" || secretName == "" {
+		return nil
 	}
 
-	return err
+	if provider, err := loadSecretsProvider(data); err != nil {
+		return err
+	} else if dbSettings._password, err = provider.Secret(secretName); err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (dbSettings *dbSettingsImp) validate() error {
-	if (len(dbSettings._host) == 0 &&
-		dbSettings._port <= 1024 &&
-		len(dbSettings._dbName) == 0 &&
-		len(dbSettings._user) == 0) &&
-		len(dbSettings._password) == 0 {
-		loggerObj := utils.LoggerObj()
-		const msg = "invalid database settings values. Please check and rerun the server again"
-		loggerObj.Error(msg)
-		loggerObj.Info(fmt.Sprintf(`host: %s
-port: %d
-dbname: %s
-user: %s
-password: %s`, dbSettings._host, dbSettings._port, dbSettings._dbName, dbSettings._user, dbSettings._password))
-		return errors.New(msg)
+// loadHosts reads the list of hosts, or the single host of the configurations that predate the list. Hosts without
+// port use the port setting, except in mongodb+srv connections, which cannot have a port.
+func (dbSettings *dbSettingsImp) loadHosts(mongodbSection *settingsSection) error {
+	var host string
+	if err := mongodbSection.stringListValue(utils.MONGODB_HOSTS_JSON_KEY, &dbSettings._hosts); err != nil {
+		return err
+	} else if len(dbSettings._hosts) == 0 {
+		if err := mongodbSection.stringValue(utils.MONGODB_HOST_JSON_KEY, false, &host); err != nil {
+			return err
+		} else if host == "" {
+			return mongodbSection.error(utils.MONGODB_HOSTS_JSON_KEY, "is missing")
+		}
+		dbSettings._hosts = []string{host}
+	}
+
+	switch dbSettings._scheme {
+	case mongodbSrvScheme:
+		if len(dbSettings._hosts) != 1 || strings.Contains(dbSettings._hosts[0], ":") {
+			return mongodbSection.error(utils.MONGODB_HOSTS_JSON_KEY,
+				"must have a single host without port when the scheme is "+mongodbSrvScheme)
+		}
+	case mongodbScheme:
+		for i, host := range dbSettings._hosts {
+			if host == "" {
+				return mongodbSection.error(utils.MONGODB_HOSTS_JSON_KEY, "cannot have empty hosts")
+			} else if !strings.Contains(host, ":") {
+				dbSettings._hosts[i] = fmt.Sprintf("%s:%d", host, dbSettings._port)
+			}
+		}
+	default:
+		return mongodbSection.error(utils.MONGODB_SCHEME_JSON_KEY,
+			fmt.Sprintf("must be \"%s\" or \"%s\"", mongodbScheme, mongodbSrvScheme))
+	}
+
+	return nil
+}
+
+func (dbSettings *dbSettingsImp) loadTLS(mongodbSection *settingsSection) error {
+	if err := mongodbSection.boolValue(utils.MONGODB_TLS_JSON_KEY, false, &dbSettings._tls); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(
+		utils.MONGODB_TLS_CA_FILE_JSON_KEY, false, &dbSettings._tlsCAFile); err != nil {
+		return err
+	} else if err = mongodbSection.stringValue(
+		utils.MONGODB_TLS_CERTIFICATE_KEY_FILE_JSON_KEY, false, &dbSettings._tlsCertificateKeyFile); err != nil {
+		return err
+	} else if err = mongodbSection.boolValue(
+		utils.MONGODB_TLS_INSECURE_JSON_KEY, false, &dbSettings._tlsInsecure); err != nil {
+		return err
+	} else if !dbSettings._tls &&
+		(dbSettings._tlsCAFile != "" || dbSettings._tlsCertificateKeyFile != "" || dbSettings._tlsInsecure) {
+		return mongodbSection.error(utils.MONGODB_TLS_JSON_KEY, "must be true to use the other TLS options")
 	}
 
 	return nil
 }
 
-func (dbSettings *dbSettingsImp) encryptPassword() {
-	hash := sha256.New()
-	hash.Write(([]byte)(dbSettings._password))
+func (dbSettings *dbSettingsImp) loadConcerns(mongodbSection *settingsSection) error {
+	if err := mongodbSection.stringValue(
+		utils.MONGODB_READ_PREFERENCE_JSON_KEY, false, &dbSettings._readPreference); err != nil {
+		return err
+	} else if dbSettings._readPreference != "" && !containsString(mongodbReadPreferences, dbSettings._readPreference) {
+		return mongodbSection.error(utils.MONGODB_READ_PREFERENCE_JSON_KEY,
+			"must be one of "+strings.Join(mongodbReadPreferences, ", "))
+	}
+
+	if err := mongodbSection.stringValue(
+		utils.MONGODB_READ_CONCERN_JSON_KEY, false, &dbSettings._readConcern); err != nil {
+		return err
+	} else if dbSettings._readConcern != "" && !containsString(mongodbReadConcerns, dbSettings._readConcern) {
+		return mongodbSection.error(utils.MONGODB_READ_CONCERN_JSON_KEY,
+			"must be one of "+strings.Join(mongodbReadConcerns, ", "))
+	}
+
+	if err := mongodbSection.stringValue(
+		utils.MONGODB_WRITE_CONCERN_JSON_KEY, false, &dbSettings._writeConcern); err != nil {
+		return err
+	} else if _, err := strconv.Atoi(dbSettings._writeConcern); dbSettings._writeConcern != "" &&
+		dbSettings._writeConcern != "majority" && err != nil {
+		return mongodbSection.error(utils.MONGODB_WRITE_CONCERN_JSON_KEY, "must be \"majority\" or a number of nodes")
+	}
+
+	return mongodbSection.boolValue(utils.MONGODB_RETRY_WRITES_JSON_KEY, false, &dbSettings._retryWrites)
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (dbSettings *dbSettingsImp) loadDriverType(dbSection *settingsSection) error {
+	driver := utils.DB_DRIVER_MONGODB
+	if err := dbSection.stringValue(utils.DB_DRIVER_JSON_KEY, false, &driver); err != nil {
+		return err
+	}
+
+	switch driver {
+	case utils.DB_DRIVER_MONGODB:
+		dbSettings._driverType = utils.DBType_MONGODB
+	case utils.DB_DRIVER_MEMORY:
+		dbSettings._driverType = utils.DBType_MEMORY
+	default:
+		return dbSection.error(utils.DB_DRIVER_JSON_KEY, fmt.Sprintf("must be \"%s\" or \"%s\"",
+			utils.DB_DRIVER_MONGODB, utils.DB_DRIVER_MEMORY))
+	}
+
+	return nil
+}
+
+// loadOnDelete reads the delete rules of the relations between the projects and their customer and owner. Deleting a
+// customer or a user with projects is rejected unless another rule is configured.
+func (dbSettings *dbSettingsImp) loadOnDelete(dbSection *settingsSection) error {
+	dbSettings._onDeleteCustomer = utils.ON_DELETE_RESTRICT
+	dbSettings._onDeleteOwner = utils.ON_DELETE_RESTRICT
+
+	onDeleteSection, err := dbSection.subsection(utils.DB_ON_DELETE_JSON_KEY, false)
+	if err != nil {
+		return err
+	}
+
+	if err = onDeleteSection.onDeleteValue(
+		utils.DB_ON_DELETE_CUSTOMER_PROJECTS_JSON_KEY, &dbSettings._onDeleteCustomer); err != nil {
+		return err
+	}
+
+	return onDeleteSection.onDeleteValue(utils.DB_ON_DELETE_OWNER_PROJECTS_JSON_KEY, &dbSettings._onDeleteOwner)
+}
 
-	dbSettings._password = base64.URLEncoding.EncodeToString(hash.Sum(nil))
+func onDeleteName(rule utils.OnDeleteEnum) string {
+	switch rule {
+	case utils.ON_DELETE_CASCADE:
+		return utils.ON_DELETE_CASCADE_VALUE
+	case utils.ON_DELETE_SET_NULL:
+		return utils.ON_DELETE_SET_NULL_VALUE
+	default:
+		return utils.ON_DELETE_RESTRICT_VALUE
+	}
 }
 
 // ******************************* dbSettingsImp ***********************************
 
 type settingsImp struct {
-	dbSettings  *dbSettingsImp
-	apiSettings *apiSettingsImp
+	dbSettings   *dbSettingsImp
+	apiSettings  *apiSettingsImp
+	authSettings *authSettingsImp
+	logLevel     utils.LogLevelEnum
+	loaded       bool
 }
 
 func (settings *settingsImp) APISettings() APISettings {
 	return settings.apiSettings
 }
 
+func (settings *settingsImp) AuthSettings() AuthSettings {
+	return settings.authSettings
+}
+
 func (settings *settingsImp) DBSettingsValues() DBSettings {
 	return settings.dbSettings
 }
 
+// LogLevel returns the level of the lines written to the log.
+func (settings *settingsImp) LogLevel() utils.LogLevelEnum {
+	return settings.logLevel
+}
+
 func (settings *settingsImp) ToString() string {
-	return settings.dbSettings.ToString() + settings.apiSettings.ToString()
+	return settings.dbSettings.ToString() + settings.apiSettings.ToString() + settings.authSettings.ToString()
 }
 
+// filename returns the settings file selected with the -config flag or the PICNIC_CONFIG environment variable. By
+// default it is config/settings.json in the working directory, or in the source tree when the server runs from it.
 func (settings *settingsImp) filename() string {
-	_, filename, _, ok := runtime.Caller(0)
+	if configFile != "" {
+		return configFile
+	} else if filename := os.Getenv(utils.CONFIG_FILE_ENV_VAR); filename != "" {
+		return filename
+	} else if _, err := os.Stat(CONFIG_FILE_PATH); err == nil {
+		return CONFIG_FILE_PATH
+	}
 
+	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
-		panic("settings.json file not found")
-		return ""
+		return CONFIG_FILE_PATH
 	}
 
 	baseDir := path.Dir(filename)
-	result := baseDir + string(os.PathSeparator) + ".." + string(os.PathSeparator) + path.Join("config", "settings.json")
-
-	return result
+	return baseDir + string(os.PathSeparator) + ".." + string(os.PathSeparator) + path.Join("config", "settings.json")
 }
 
 func (settings *settingsImp) fileContent() ([]byte, error) {
@@ -229,12 +918,11 @@ func (settings *settingsImp) fileContent() ([]byte, error) {
 	var content, err = ioutil.ReadFile(filename)
 
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
 
 	if err != nil {
-		msg := fmt.Sprintf("Error reading file %s", filename)
+		msg := fmt.Sprintf("Error reading settings file %s: %s", filename, err.Error())
 		loggerObj.Error(msg)
-		return nil, err
+		return nil, errors.New(msg)
 	}
 
 	return content, nil
@@ -243,14 +931,16 @@ func (settings *settingsImp) fileContent() ([]byte, error) {
 func (settings *settingsImp) load() error {
 	if content, err := settings.fileContent(); err != nil {
 		return err
-	} else {
-		return settings.loadContent(content)
+	} else if err = settings.loadContent(content); err != nil {
+		return err
 	}
+
+	settings.loaded = true
+	return nil
 }
 
 func (settings *settingsImp) loadContent(content []byte) error {
 	loggerObj := utils.LoggerObj()
-	defer loggerObj.Close()
 
 	if content == nil || len(content) == 0 {
 		msg := "invalid setting.json file content"
@@ -260,14 +950,20 @@ func (settings *settingsImp) loadContent(content []byte) error {
 
 		var data map[string]interface{}
 		if err := json.Unmarshal(content, &data); err != nil {
-			const msg = "error parsing content of settings.json"
+			msg := fmt.Sprintf("error parsing content of settings.json: %s", err.Error())
 			loggerObj.Error(msg)
 			return errors.New(msg)
 		}
-		if err := settings.loadDbSettings(data); err != nil {
+		if err := applyEnvOverrides(data); err != nil {
+			return err
+		} else if err := settings.loadDbSettings(data); err != nil {
 			return err
 		} else if err = settings.loadApiSettings(data); err != nil {
 			return err
+		} else if err = settings.loadAuthSettings(data); err != nil {
+			return err
+		} else if err = settings.loadLogSettings(data); err != nil {
+			return err
 		}
 	}
 
@@ -284,9 +980,51 @@ func (settings *settingsImp) loadApiSettings(data map[string]interface{}) error
 	return settings.apiSettings.loadData(data)
 }
 
+func (settings *settingsImp) loadAuthSettings(data map[string]interface{}) error {
+	settings.authSettings = &authSettingsImp{}
+	return settings.authSettings.loadData(data)
+}
+
+func (settings *settingsImp) loadLogSettings(data map[string]interface{}) error {
+	levelName := utils.LOG_LEVEL_INFO_NAME
+
+	if logSection, err := newSettingsSection(data, utils.LOG_JSON_KEY, utils.LOG_JSON_KEY, false); err != nil {
+		return err
+	} else if err = logSection.stringValue(utils.LOG_LEVEL_JSON_KEY, false, &levelName); err != nil {
+		return err
+	} else if level, ok := utils.LogLevelFromName(levelName); !ok {
+		return logSection.error(utils.LOG_LEVEL_JSON_KEY, fmt.Sprintf("must be \"%s\", \"%s\", \"%s\" or \"%s\"",
+			utils.LOG_LEVEL_DEBUG_NAME, utils.LOG_LEVEL_INFO_NAME, utils.LOG_LEVEL_WARNING_NAME,
+			utils.LOG_LEVEL_ERROR_NAME))
+	} else {
+		settings.logLevel = level
+	}
+
+	return nil
+}
+
 // ******************************* Public Functions ***********************************
 
 var settingsSingleton *settingsImp
+var configFile string
+
+// SetConfigFile selects the settings file. It takes precedence over the PICNIC_CONFIG environment variable and must
+// be called before the settings are loaded.
+func SetConfigFile(filename string) {
+	configFile = filename
+}
+
+// Loaded returns true when the settings were loaded without errors.
+func Loaded() bool {
+	return settingsSingleton != nil && settingsSingleton.loaded
+}
+
+// Load reads the settings file and the environment overrides, and returns the validation errors. SettingsObj loads
+// the settings the first time it is called, but it cannot report errors, so the server calls Load when it starts.
+func Load() error {
+	settingsSingleton = &settingsImp{}
+	return settingsSingleton.load()
+}
 
 func SettingsObj() Settings {
 
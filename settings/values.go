@@ -0,0 +1,186 @@
+package settings
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/freddy311082/picnic-server/utils"
+)
+
+// settingsSection reads the values of an object of settings.json. The read methods keep the current value of the
+// destination when an optional key is missing, so defaults are assigned before reading, and return an error that
+// names the key when the value is missing or has the wrong type.
+type settingsSection struct {
+	name   string
+	values map[string]interface{}
+}
+
+// newSettingsSection reads the object of the key. name is the full name of the key, used in the errors.
+func newSettingsSection(data map[string]interface{}, key, name string, required bool) (*settingsSection, error) {
+	section := &settingsSection{name: name, values: map[string]interface{}{}}
+
+	if value, ok := data[key]; !ok || value == nil {
+		if required {
+			return nil, settingError(name, "is missing")
+		}
+	} else if values, ok := value.(map[string]interface{}); !ok {
+		return nil, settingError(name, "must be an object")
+	} else {
+		section.values = values
+	}
+
+	return section, nil
+}
+
+func (section *settingsSection) subsection(key string, required bool) (*settingsSection, error) {
+	return newSettingsSection(section.values, key, section.name+"."+key, required)
+}
+
+// value returns the value of the key, or nil when it is missing. An error is returned for missing required keys.
+func (section *settingsSection) value(key string, required bool) (interface{}, error) {
+	if value, ok := section.values[key]; ok && value != nil {
+		return value, nil
+	} else if required {
+		return nil, section.error(key, "is missing")
+	}
+
+	return nil, nil
+}
+
+func (section *settingsSection) stringValue(key string, required bool, result *string) error {
+	if value, err := section.value(key, required); err != nil || value == nil {
+		return err
+	} else if text, ok := value.(string); !ok {
+		return section.error(key, "must be a string")
+	} else if required && text == "" {
+		return section.error(key, "cannot be empty")
+	} else {
+		*result = text
+	}
+
+	return nil
+}
+
+func (section *settingsSection) boolValue(key string, required bool, result *bool) error {
+	if value, err := section.value(key, required); err != nil || value == nil {
+		return err
+	} else if flag, ok := value.(bool); !ok {
+		return section.error(key, "must be true or false")
+	} else {
+		*result = flag
+	}
+
+	return nil
+}
+
+// intValue reads a whole number between min and max.
+func (section *settingsSection) intValue(key string, required bool, min, max int, result *int) error {
+	if value, err := section.value(key, required); err != nil || value == nil {
+		return err
+	} else if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+		return section.error(key, "must be a whole number")
+	} else if number < float64(min) || number > float64(max) {
+		return section.error(key, fmt.Sprintf("must be between %d and %d", min, max))
+	} else {
+		*result = int(number)
+	}
+
+	return nil
+}
+
+// durationValue reads a positive number of units, like the seconds of a timeout.
+func (section *settingsSection) durationValue(key string, unit time.Duration, result *time.Duration) error {
+	if value, err := section.value(key, false); err != nil || value == nil {
+		return err
+	} else if number, ok := value.(float64); !ok || number <= 0 {
+		return section.error(key, "must be a positive number")
+	} else {
+		*result = time.Duration(number * float64(unit))
+	}
+
+	return nil
+}
+
+func (section *settingsSection) stringListValue(key string, result *[]string) error {
+	if value, err := section.value(key, false); err != nil || value == nil {
+		return err
+	} else if items, ok := value.([]interface{}); !ok {
+		return section.error(key, "must be a list of strings")
+	} else {
+		list := []string{}
+		for _, item := range items {
+			if text, ok := item.(string); !ok {
+				return section.error(key, "must be a list of strings")
+			} else {
+				list = append(list, text)
+			}
+		}
+		*result = list
+	}
+
+	return nil
+}
+
+// intMapValue reads an object whose values are whole numbers between min and max.
+func (section *settingsSection) intMapValue(key string, min, max int, result *map[string]int) error {
+	values, err := section.subsection(key, false)
+	if err != nil {
+		return err
+	}
+
+	numbers := map[string]int{}
+	for name := range values.values {
+		var number int
+		if err := values.intValue(name, true, min, max, &number); err != nil {
+			return err
+		}
+		numbers[name] = number
+	}
+	*result = numbers
+
+	return nil
+}
+
+// onDeleteValue reads the delete rule of a relation: "restrict", "cascade" or "set-null".
+func (section *settingsSection) onDeleteValue(key string, result *utils.OnDeleteEnum) error {
+	rule := ""
+	if err := section.stringValue(key, false, &rule); err != nil || rule == "" {
+		return err
+	}
+
+	switch rule {
+	case utils.ON_DELETE_RESTRICT_VALUE:
+		*result = utils.ON_DELETE_RESTRICT
+	case utils.ON_DELETE_CASCADE_VALUE:
+		*result = utils.ON_DELETE_CASCADE
+	case utils.ON_DELETE_SET_NULL_VALUE:
+		*result = utils.ON_DELETE_SET_NULL
+	default:
+		return section.error(key, fmt.Sprintf("must be \"%s\", \"%s\" or \"%s\"",
+			utils.ON_DELETE_RESTRICT_VALUE, utils.ON_DELETE_CASCADE_VALUE, utils.ON_DELETE_SET_NULL_VALUE))
+	}
+
+	return nil
+}
+
+func (section *settingsSection) error(key, problem string) error {
+	return settingError(section.name+"."+key, problem)
+}
+
+type settingsError struct {
+	key     string
+	problem string
+}
+
+func (err *settingsError) Error() string {
+	return fmt.Sprintf("invalid settings: %q %s", err.key, err.problem)
+}
+
+func settingError(key, problem string) error {
+	loggerObj := utils.LoggerObj()
+
+	err := &settingsError{key: key, problem: problem}
+	loggerObj.Error(err.Error())
+	return err
+}
@@ -1,11 +1,114 @@
 package utils
 
+// SETTINGS FILE
+const CONFIG_FILE_FLAG = "config"
+const CONFIG_FILE_ENV_VAR = "PICNIC_CONFIG"
+const ENCRYPT_SECRET_FLAG = "encrypt-secret"
+
+// COMMANDS
+const CHECK_COMMAND = "check"
+const FIX_FLAG = "fix"
+
+// owner of the orphaned projects repaired by the check command
+const ORPHANED_PROJECTS_OWNER_EMAIL = "orphaned-projects@picnic.invalid"
+const ORPHANED_PROJECTS_OWNER_NAME = "Orphaned projects"
+
+// HTTP HEADERS
+const REQUEST_ID_HEADER = "X-Request-ID"
+
 // JSON Keys
 
 // WEBSERVER SECTION
 const WEBSERVER_JSON_KEY = "webserver"
 const GRAPHIQL_JSON_KEY = "graphiql"
 const HTTP_PORT_JSON_KEY = "http-port"
+const ALLOWED_ORIGINS_JSON_KEY = "allowed-origins"
+const READ_TIMEOUT_JSON_KEY = "read-timeout-seconds"
+const WRITE_TIMEOUT_JSON_KEY = "write-timeout-seconds"
+const IDLE_TIMEOUT_JSON_KEY = "idle-timeout-seconds"
+const SHUTDOWN_TIMEOUT_JSON_KEY = "shutdown-timeout-seconds"
+const MAX_BODY_BYTES_JSON_KEY = "max-body-bytes"
+const MAX_BATCH_SIZE_JSON_KEY = "max-batch-size"
+const QUERY_CACHE_SIZE_JSON_KEY = "query-cache-size"
+const MAX_QUERY_DEPTH_JSON_KEY = "max-query-depth"
+const MAX_QUERY_COMPLEXITY_JSON_KEY = "max-query-complexity"
+const DEFAULT_LIST_SIZE_JSON_KEY = "default-list-size"
+const FIELD_COSTS_JSON_KEY = "field-costs"
+const SUBSCRIPTION_KEEP_ALIVE_JSON_KEY = "subscription-keep-alive-seconds"
+const METRICS_TOKEN_JSON_KEY = "metrics-token"
+const PERSISTED_QUERIES_JSON_KEY = "persisted-queries"
+const PERSISTED_QUERIES_STORE_JSON_KEY = "store"
+const PERSISTED_QUERIES_CACHE_SIZE_JSON_KEY = "cache-size"
+const PERSISTED_QUERIES_STRICT_JSON_KEY = "strict"
+const PERSISTED_QUERIES_ALLOWLIST_FILE_JSON_KEY = "allowlist-file"
+
+const PERSISTED_QUERIES_STORE_MEMORY = "memory"
+const PERSISTED_QUERIES_STORE_MONGODB = "mongodb"
+
+// LOG SECTION
+const LOG_JSON_KEY = "log"
+const LOG_LEVEL_JSON_KEY = "level"
+
+const LOG_LEVEL_DEBUG_NAME = "debug"
+const LOG_LEVEL_INFO_NAME = "info"
+const LOG_LEVEL_WARNING_NAME = "warning"
+const LOG_LEVEL_ERROR_NAME = "error"
+
+// AUTH SECTION
+const AUTH_JSON_KEY = "auth"
+const AUTH_REQUIRED_JSON_KEY = "required"
+const AUTH_SECRET_JSON_KEY = "secret"
+const AUTH_TOKEN_TTL_JSON_KEY = "token-ttl-minutes"
+const AUTH_CODE_TTL_JSON_KEY = "code-ttl-minutes"
+const AUTH_ADMIN_EMAILS_JSON_KEY = "admin-emails"
+
+// DATABASE SECTION
+const DB_JSON_KEY = "db"
+const DB_DRIVER_JSON_KEY = "driver"
+const DB_OPERATION_TIMEOUT_JSON_KEY = "operation-timeout-seconds"
+const DB_DELETED_RETENTION_JSON_KEY = "deleted-retention-days"
+const DB_PURGE_INTERVAL_JSON_KEY = "purge-interval-minutes"
+const DB_ON_DELETE_JSON_KEY = "on-delete"
+const DB_ON_DELETE_CUSTOMER_PROJECTS_JSON_KEY = "customer-projects"
+const DB_ON_DELETE_OWNER_PROJECTS_JSON_KEY = "owner-projects"
+const MONGODB_JSON_KEY = "mongodb"
+const MONGODB_URI_JSON_KEY = "uri"
+const MONGODB_SCHEME_JSON_KEY = "scheme"
+const MONGODB_HOSTS_JSON_KEY = "hosts"
+const MONGODB_HOST_JSON_KEY = "host"
+const MONGODB_PORT_JSON_KEY = "port"
+const MONGODB_DBNAME_JSON_KEY = "dbname"
+const MONGODB_USER_JSON_KEY = "user"
+const MONGODB_PASSWORD_JSON_KEY = "password"
+const MONGODB_PASSWORD_SECRET_JSON_KEY = "password-secret"
+const MONGODB_AUTH_SOURCE_JSON_KEY = "auth-source"
+const MONGODB_REPLICA_SET_JSON_KEY = "replica-set"
+const MONGODB_TLS_JSON_KEY = "tls"
+const MONGODB_TLS_CA_FILE_JSON_KEY = "tls-ca-file"
+const MONGODB_TLS_CERTIFICATE_KEY_FILE_JSON_KEY = "tls-certificate-key-file"
+const MONGODB_TLS_INSECURE_JSON_KEY = "tls-insecure"
+const MONGODB_READ_PREFERENCE_JSON_KEY = "read-preference"
+const MONGODB_READ_CONCERN_JSON_KEY = "read-concern"
+const MONGODB_WRITE_CONCERN_JSON_KEY = "write-concern"
+const MONGODB_RETRY_WRITES_JSON_KEY = "retry-writes"
+
+const DB_DRIVER_MONGODB = "mongodb"
+const DB_DRIVER_MEMORY = "memory"
+
+const ON_DELETE_RESTRICT_VALUE = "restrict"
+const ON_DELETE_CASCADE_VALUE = "cascade"
+const ON_DELETE_SET_NULL_VALUE = "set-null"
+
+// SECRETS SECTION
+const SECRETS_JSON_KEY = "secrets"
+const SECRETS_PROVIDER_JSON_KEY = "provider"
+const SECRETS_DIR_JSON_KEY = "dir"
+const SECRETS_KEY_FILE_JSON_KEY = "key-file"
+const SECRETS_FILE_JSON_KEY = "file"
+
+const SECRETS_PROVIDER_ENV = "env"
+const SECRETS_PROVIDER_FILE = "file"
+const SECRETS_PROVIDER_KEYFILE = "keyfile"
 
 // MONGODB
 
@@ -14,14 +117,69 @@ const USER_ID_FIELD = "_id"
 const USER_NAME_FIELD = "name"
 const USER_LASTNAME_FIELD = "last_name"
 const USER_EMAIL_FIELD = "email"
+const USER_ROLE_FIELD = "role"
+
+const USER_ROLE_USER = "user"
+const USER_ROLE_ADMIN = "admin"
 
 const PROJECTS_COLLECTION = "projects"
 const PROJECT_ID_FIELD = "_id"
 const PROJECT_NAME_FIELD = "name"
+const PROJECT_DESCRIPTION_FIELD = "description"
 const PROJECT_CREATED_AT_FIELD = "created_at"
 const PROJECT_OWNER_ID_FIELD = "owner_id"
 const PROJECT_FIELDS_LIST_FIELD = "fields"
 const PROJECT_CUSTOMER_ID_FIELD = "customer_id"
+const PROJECT_VERSION_FIELD = "version"
+
+const PROJECT_FIELD_TYPE_TEXT = "text"
+const PROJECT_FIELD_TYPE_NUMBER = "number"
+const PROJECT_FIELD_TYPE_DATE = "date"
+const PROJECT_FIELD_TYPE_ENUM = "enum"
+const PROJECT_FIELD_TYPE_BOOLEAN = "boolean"
 
 const CUSTOMERS_COLLECTION = "customers"
 const CUSTOMER_ID_FIELD = "_id"
+const CUSTOMER_NAME_FIELD = "name"
+const CUSTOMER_CUIT_FIELD = "cuit"
+const CUSTOMER_VERSION_FIELD = "version"
+const CUSTOMER_PROJECTS_FIELD = "projects"
+
+// DELETED_AT_FIELD marks the soft deleted documents of the users, projects and customers collections.
+const DELETED_AT_FIELD = "deleted_at"
+
+const AUDIT_LOG_COLLECTION = "audit_log"
+const AUDIT_ID_FIELD = "_id"
+const AUDIT_ACTOR_ID_FIELD = "actor_id"
+const AUDIT_TIMESTAMP_FIELD = "timestamp"
+const AUDIT_ENTITY_TYPE_FIELD = "entity_type"
+const AUDIT_ENTITY_ID_FIELD = "entity_id"
+const AUDIT_OPERATION_FIELD = "operation"
+const AUDIT_CHANGES_FIELD = "changes"
+
+const AUDIT_ENTITY_USER = "user"
+const AUDIT_ENTITY_PROJECT = "project"
+const AUDIT_ENTITY_CUSTOMER = "customer"
+
+const AUDIT_OPERATION_CREATE = "create"
+const AUDIT_OPERATION_UPDATE = "update"
+const AUDIT_OPERATION_DELETE = "delete"
+const AUDIT_OPERATION_RESTORE = "restore"
+
+const PERSISTED_QUERIES_COLLECTION = "persisted_queries"
+const PERSISTED_QUERY_HASH_FIELD = "_id"
+const PERSISTED_QUERY_QUERY_FIELD = "query"
+const PERSISTED_QUERY_CREATED_AT_FIELD = "created_at"
+
+// PERSISTED_QUERIES_TTL_SECONDS is how long the registered queries are kept. The clients register the expired ones
+// again the next time they send them.
+const PERSISTED_QUERIES_TTL_SECONDS = 30 * 24 * 60 * 60
+
+// SORTING
+
+const SORT_FIELD_ID = "id"
+const SORT_FIELD_NAME = "name"
+const SORT_FIELD_LASTNAME = "last_name"
+const SORT_FIELD_EMAIL = "email"
+const SORT_FIELD_CUIT = "cuit"
+const SORT_FIELD_CREATED_AT = "created_at"
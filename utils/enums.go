@@ -4,6 +4,7 @@ type DBTypeEnum int
 
 const (
 	DBType_MONGODB = iota
+	DBType_MEMORY
 )
 
 type EnvTypeEnum int
@@ -12,3 +13,84 @@ const (
 	PRODUCTION = iota
 	TESTING
 )
+
+type UserRoleEnum int
+
+const (
+	ROLE_USER = iota
+	ROLE_ADMIN
+)
+
+type SortDirectionEnum int
+
+const (
+	SORT_ASC = iota
+	SORT_DESC
+)
+
+type ProjectFieldTypeEnum int
+
+const (
+	FIELD_TYPE_TEXT = iota
+	FIELD_TYPE_NUMBER
+	FIELD_TYPE_DATE
+	FIELD_TYPE_ENUM
+	FIELD_TYPE_BOOLEAN
+)
+
+type LogLevelEnum int
+
+const (
+	LOG_LEVEL_DEBUG = iota
+	LOG_LEVEL_INFO
+	LOG_LEVEL_WARNING
+	LOG_LEVEL_ERROR
+)
+
+type EventTypeEnum int
+
+const (
+	EVENT_PROJECT_CREATED = iota
+	EVENT_PROJECT_UPDATED
+	EVENT_PROJECT_DELETED
+	EVENT_CUSTOMER_CREATED
+	EVENT_CUSTOMER_UPDATED
+	EVENT_CUSTOMER_DELETED
+)
+
+type AuditEntityTypeEnum int
+
+const (
+	AUDIT_USER = iota
+	AUDIT_PROJECT
+	AUDIT_CUSTOMER
+)
+
+type AuditOperationEnum int
+
+const (
+	AUDIT_CREATE = iota
+	AUDIT_UPDATE
+	AUDIT_DELETE
+	AUDIT_RESTORE
+)
+
+// OnDeleteEnum is what happens to the projects that reference a customer or an owner when it is deleted.
+type OnDeleteEnum int
+
+const (
+	ON_DELETE_RESTRICT = iota
+	ON_DELETE_CASCADE
+	ON_DELETE_SET_NULL
+)
+
+// InconsistencyEnum is a kind of problem in the stored data found by the check command.
+type InconsistencyEnum int
+
+const (
+	INCONSISTENCY_MISSING_OWNER = iota
+	INCONSISTENCY_MISSING_CUSTOMER
+	INCONSISTENCY_DELETED_CUSTOMER_PROJECTS
+	INCONSISTENCY_UNLISTED_CUSTOMER_PROJECTS
+	INCONSISTENCY_DUPLICATE_USERS
+)
@@ -1,13 +1,163 @@
 package utils
 
 import (
-	"github.com/google/logger"
-	"io/ioutil"
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
 )
 
-func LoggerObj() *logger.Logger {
-	logger.SetFlags(log.LstdFlags | log.Lshortfile)
-	return logger.Init("PICNIC", true, false, ioutil.Discard)
+// Logger writes JSON lines to the standard output. The loggers returned by ContextLogger add the request ID of the
+// context to every line, so all the lines of a request can be found with it.
+type Logger struct {
+	requestID string
+	// callerSkip is the number of frames of logging helpers between the caller reported and the level method.
+	callerSkip int
+}
+
+type logEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Message   string `json:"msg"`
+	RequestID string `json:"request_id,omitempty"`
+	Caller    string `json:"caller,omitempty"`
+}
+
+var logLevelNames = map[LogLevelEnum]string{
+	LOG_LEVEL_DEBUG:   LOG_LEVEL_DEBUG_NAME,
+	LOG_LEVEL_INFO:    LOG_LEVEL_INFO_NAME,
+	LOG_LEVEL_WARNING: LOG_LEVEL_WARNING_NAME,
+	LOG_LEVEL_ERROR:   LOG_LEVEL_ERROR_NAME,
+}
+
+var logState = struct {
+	mutex  sync.Mutex
+	level  LogLevelEnum
+	output io.Writer
+}{level: LOG_LEVEL_INFO, output: os.Stdout}
+
+var processLogger = &Logger{}
+
+type requestIDCtxKey struct{}
+
+// LoggerObj returns the logger of the process, for the lines that do not belong to a request.
+func LoggerObj() *Logger {
+	return processLogger
+}
+
+// ContextLogger returns a logger that adds the request ID of the context to its lines.
+func ContextLogger(ctx context.Context) *Logger {
+	if id := RequestID(ctx); id != "" {
+		return &Logger{requestID: id}
+	}
+
+	return processLogger
+}
+
+// CallerSkip returns a logger that reports the caller skip frames above the one calling its level methods. Helpers
+// that log on behalf of their caller, like a function that logs and returns an error, use CallerSkip(1), so the
+// lines report where the helper was called instead of the line of the helper.
+func (loggerObj *Logger) CallerSkip(skip int) *Logger {
+	return &Logger{requestID: loggerObj.requestID, callerSkip: loggerObj.callerSkip + skip}
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestID returns the request ID of the context, or an empty string if it does not have one.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// SetLogLevel discards the lines below the level.
+func SetLogLevel(level LogLevelEnum) {
+	logState.mutex.Lock()
+	defer logState.mutex.Unlock()
+	logState.level = level
+}
+
+// SetLogOutput changes where the lines are written. It is meant for the tests.
+func SetLogOutput(output io.Writer) {
+	logState.mutex.Lock()
+	defer logState.mutex.Unlock()
+	logState.output = output
+}
+
+// LogLevelFromName returns the level of a name like "info".
+func LogLevelFromName(name string) (LogLevelEnum, bool) {
+	for level, levelName := range logLevelNames {
+		if levelName == name {
+			return level, true
+		}
+	}
+
+	return LOG_LEVEL_INFO, false
+}
+
+func (loggerObj *Logger) Debug(v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_DEBUG, fmt.Sprint(v...))
+}
+
+func (loggerObj *Logger) Debugf(format string, v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_DEBUG, fmt.Sprintf(format, v...))
+}
+
+func (loggerObj *Logger) Info(v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_INFO, fmt.Sprint(v...))
+}
+
+func (loggerObj *Logger) Infof(format string, v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_INFO, fmt.Sprintf(format, v...))
+}
+
+func (loggerObj *Logger) Warning(v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_WARNING, fmt.Sprint(v...))
+}
+
+func (loggerObj *Logger) Warningf(format string, v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_WARNING, fmt.Sprintf(format, v...))
+}
+
+func (loggerObj *Logger) Error(v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_ERROR, fmt.Sprint(v...))
+}
+
+func (loggerObj *Logger) Errorf(format string, v ...interface{}) {
+	loggerObj.write(LOG_LEVEL_ERROR, fmt.Sprintf(format, v...))
+}
+
+func (loggerObj *Logger) write(level LogLevelEnum, msg string) {
+	logState.mutex.Lock()
+	defer logState.mutex.Unlock()
+
+	if level < logState.level {
+		return
+	}
+
+	entry := logEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     logLevelNames[level],
+		Message:   msg,
+		RequestID: loggerObj.requestID,
+	}
+
+	// skip write, the level method and the logging helpers
+	if _, file, line, ok := runtime.Caller(2 + loggerObj.callerSkip); ok {
+		entry.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
 
+	if content, err := json.Marshal(entry); err == nil {
+		logState.output.Write(append(content, '\n'))
+	}
 }
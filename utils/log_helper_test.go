@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestContextLoggerWritesRequestID(t *testing.T) {
+	var output bytes.Buffer
+	SetLogOutput(&output)
+	defer SetLogOutput(os.Stdout)
+
+	ContextLogger(WithRequestID(context.Background(), "req-1")).Errorf("user %s not found", "42")
+
+	var entry logEntry
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Level != LOG_LEVEL_ERROR_NAME || entry.Message != "user 42 not found" || entry.RequestID != "req-1" {
+		t.Error("Invalid log entry: ", output.String())
+	} else if !strings.HasPrefix(entry.Caller, "log_helper_test.go:") {
+		t.Error("Invalid caller: ", entry.Caller)
+	}
+}
+
+func TestLoggerDiscardsLinesBelowLevel(t *testing.T) {
+	var output bytes.Buffer
+	SetLogOutput(&output)
+	SetLogLevel(LOG_LEVEL_WARNING)
+	defer SetLogOutput(os.Stdout)
+	defer SetLogLevel(LOG_LEVEL_INFO)
+
+	LoggerObj().Info("discarded")
+	LoggerObj().Warning("written")
+
+	if bytes.Contains(output.Bytes(), []byte("discarded")) || !bytes.Contains(output.Bytes(), []byte("written")) {
+		t.Error("Invalid log output: ", output.String())
+	}
+}
+
+func logHelperError(loggerObj *Logger, msg string) {
+	loggerObj.CallerSkip(1).Error(msg)
+}
+
+func TestCallerSkipReportsTheCallerOfTheHelper(t *testing.T) {
+	var output bytes.Buffer
+	SetLogOutput(&output)
+	defer SetLogOutput(os.Stdout)
+
+	_, _, line, _ := runtime.Caller(0)
+	logHelperError(ContextLogger(WithRequestID(context.Background(), "req-1")), "user not found")
+
+	var entry logEntry
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := fmt.Sprintf("log_helper_test.go:%d", line+1); entry.Caller != expected {
+		t.Errorf("Expected caller %s. Value received: %s", expected, entry.Caller)
+	} else if entry.RequestID != "req-1" {
+		t.Error("CallerSkip must keep the request ID: ", output.String())
+	}
+}